@@ -12,7 +12,10 @@ import (
 	"github.com/miu200521358/walk/pkg/declarative"
 	"github.com/miu200521358/walk/pkg/walk"
 
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
 	"github.com/miu200521358/mu_tree_viewer/pkg/infra/controller/ui"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/filehash"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/tagstore"
 	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
 
 	"github.com/miu200521358/mlib_go/pkg/adapter/audio_api"
@@ -44,6 +47,9 @@ var appI18nFiles embed.FS
 // main はmu_tree_viewerを起動する。
 func main() {
 	initialMotionPath := app.FindInitialPath(os.Args, ".vmd", ".vpd")
+	// アーカイブ内のモデルを一時展開したファイルは終了時に削除する。
+	archiveExtractor := archive.NewExtractor("")
+	defer archiveExtractor.Cleanup()
 
 	app.Run(app.RunOptions{
 		ViewerCount: 1,
@@ -56,11 +62,22 @@ func main() {
 			return ui.NewMenuItems(baseServices.I18n(), baseServices.Logger())
 		},
 		BuildTabPages: func(widgets *controller.MWidgets, baseServices base.IBaseServices, audioPlayer audio_api.IAudioPlayer) []declarative.TabPage {
+			// モデルキャッシュとタグ、重複検出でファイル情報と内容ハッシュのキャッシュを共有する。
+			hasher := filehash.NewHasher()
 			viewerUsecase := minteractor.NewTreeViewerUsecase(minteractor.TreeViewerUsecaseDeps{
-				ModelReader:  io_model.NewModelRepository(),
-				MotionReader: io_motion.NewVmdVpdRepository(),
+				ModelReader:     io_model.NewModelRepository(),
+				MotionReader:    io_motion.NewVmdVpdRepository(),
+				ArchiveResolver: archiveExtractor,
+				Files:           hasher,
+				Hasher:          hasher,
+				Logger:          baseServices.Logger(),
 			})
-			return ui.NewTabPages(widgets, baseServices, initialMotionPath, audioPlayer, viewerUsecase)
+			tagUsecase := minteractor.NewModelTagUsecase(minteractor.ModelTagUsecaseDeps{
+				Store:  tagstore.NewStore(""),
+				Hasher: hasher,
+			})
+			duplicateUsecase := minteractor.NewDuplicateUsecase(minteractor.DuplicateUsecaseDeps{Hasher: hasher})
+			return ui.NewTabPages(widgets, baseServices, initialMotionPath, audioPlayer, viewerUsecase, tagUsecase, duplicateUsecase)
 		},
 	})
 }
@@ -20,9 +20,9 @@ require (
 	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71 // indirect
 	github.com/miu200521358/dds v0.0.1 // indirect
 	github.com/miu200521358/win v0.0.2
-	github.com/tiendc/go-deepcopy v1.7.2 // indirect
-	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/text v0.33.0 // indirect
+	github.com/tiendc/go-deepcopy v1.7.2
+	golang.org/x/sys v0.39.0
+	golang.org/x/text v0.33.0
 	gonum.org/v1/gonum v0.16.0 // indirect
 )
 
@@ -26,4 +26,130 @@ const (
 	LogScreenshotFailure = "スクリーンショット保存に失敗しました"
 	LogTreeBuildFailure  = "ツリー構築に失敗しました"
 	LogTreeEmpty         = "対象モデルが見つかりません"
+
+	LabelTreeBuilding             = "ツリー構築中"
+	LabelTreeBuildProgress        = "ツリー構築進捗"
+	LabelTreeBuildCancel          = "ツリー構築キャンセル"
+	LogTreeBuildCanceled          = "ツリー構築をキャンセルしました"
+	LabelRescan                   = "再走査"
+	LabelLazyMode                 = "遅延読み込み"
+	LabelLazyModeTip              = "遅延読み込み説明"
+	LabelCompactMode              = "フォルダをまとめて表示"
+	LabelCompactModeTip           = "フォルダをまとめて表示説明"
+	LabelSortMode                 = "並び順"
+	LabelSortJapanese             = "並び順_日本語"
+	LabelSortNatural              = "並び順_自然順"
+	LabelSortModified             = "並び順_更新日時"
+	LabelSortSize                 = "並び順_サイズ"
+	LabelSortModelName            = "並び順_モデル名"
+	LabelFoldersFirst             = "フォルダを先に表示"
+	LabelNodeLabel                = "表示名"
+	LabelNodeLabelFile            = "表示名_ファイル名"
+	LabelNodeLabelModel           = "表示名_モデル名"
+	LabelNodeLabelEnglish         = "表示名_英語モデル名"
+	LabelRootSummary              = "ルート集計"
+	LabelWorkspace                = "ワークスペース"
+	LabelWorkspaceTip             = "ワークスペース説明"
+	LabelWorkspaceSave            = "ワークスペース保存"
+	LabelWorkspaceEdit            = "ワークスペース編集"
+	LabelWorkspaceDelete          = "ワークスペース削除"
+	LabelWorkspaceName            = "ワークスペース名"
+	LabelWorkspaceRootSettings    = "ルート設定"
+	LabelWorkspaceRemoveRoot      = "ルートを外す"
+	LabelWorkspaceAlias           = "ルートの表示名"
+	LabelWorkspaceOwnRules        = "このルート独自の走査条件を使う"
+	MessageWorkspaceNoRoots       = "ワークスペース保存対象なし"
+	MessageWorkspaceDeleteConfirm = "ワークスペース削除確認"
+	LogWorkspaceNoFolders         = "ワークスペースのフォルダが見つかりません"
+	LabelFavorites                = "お気に入り"
+	LabelBookmarkAdd              = "ブックマークに追加"
+	LabelBookmarkRemove           = "ブックマークを解除"
+	LabelBookmarkMissing          = "見つかりません"
+	LabelRecent                   = "最近見たモデル"
+	LabelRecentForget             = "最近見たモデルから削除"
+	LabelTags                     = "タグ"
+	LabelTagsTip                  = "タグ説明"
+	LabelTagsKnown                = "登録済みのタグ"
+	LabelNote                     = "メモ"
+	LabelTagsEdit                 = "タグ・メモを編集"
+	LabelTagFilter                = "タグで絞り込み"
+	LabelTagFilterAll             = "タグ絞り込みなし"
+	LabelSearch                   = "絞り込み"
+	LabelSearchTip                = "絞り込み説明"
+	LabelSearchSubstring          = "部分一致"
+	LabelSearchGlob               = "ワイルドカード"
+	LabelSearchRegex              = "正規表現"
+	LabelSearchInvalid            = "絞り込み条件の誤り"
+	LabelSearchQuery              = "クエリ"
+	LabelQueryTip                 = "クエリ説明"
+	LabelQuerySaved               = "保存済みクエリ"
+	LabelQuerySave                = "クエリ保存"
+	LabelQuerySaveTip             = "クエリ保存説明"
+	LabelQueryDelete              = "クエリ削除"
+	LabelQueryDeleteTip           = "クエリ削除説明"
+	LabelQueryLoading             = "クエリ照合中"
+	LabelQueryUnreadable          = "クエリ読み込み失敗"
+	LabelDuplicates               = "重複ファイル"
+	LabelDuplicatesFind           = "重複検出"
+	LabelDuplicatesFindTip        = "重複検出説明"
+	LabelDuplicatesCancel         = "重複検出中止"
+	LabelDuplicatesScanning       = "重複探索中"
+	LabelDuplicatesHashing        = "重複照合中"
+	LabelDuplicatesSummary        = "重複集計"
+	LabelDuplicatesNone           = "重複なし"
+	LabelDuplicatesFailed         = "重複検出失敗"
+	LabelVersions                 = "バージョン整理"
+	LabelVersionsFind             = "バージョン整理開始"
+	LabelVersionsFindTip          = "バージョン整理説明"
+	LabelVersionsCancel           = "バージョン整理中止"
+	LabelVersionsScanning         = "バージョン探索中"
+	LabelVersionsReading          = "バージョン読込中"
+	LabelVersionsFamily           = "バージョン系統"
+	LabelVersionsSummary          = "バージョン集計"
+	LabelVersionsNone             = "バージョンなし"
+	LabelVersionsFailed           = "バージョン整理失敗"
+	LabelVersionsUnversioned      = "版表記なし"
+	LabelVersionsReferenced       = "旧版参照中"
+	LabelVersionsStale            = "旧版参照あり"
+	LabelVersionsCopyReport       = "旧版参照レポートをコピー"
+	LabelVersionsReportNewest     = "旧版参照レポート最新"
+	LabelVersionsReportStale      = "旧版参照レポート旧版"
+	LabelSlideshow                = "スライドショー"
+	LabelSlideshowPlay            = "スライドショー再生"
+	LabelSlideshowPlayTip         = "スライドショー再生説明"
+	LabelSlideshowPause           = "スライドショー一時停止"
+	LabelSlideshowResume          = "スライドショー再開"
+	LabelSlideshowSkip            = "スライドショー次へ"
+	LabelSlideshowStop            = "スライドショー停止"
+	LabelSlideshowInterval        = "スライドショー間隔"
+	LabelSlideshowMotionEnd       = "スライドショーモーション終了"
+	LabelSlideshowMotionEndTip    = "スライドショーモーション終了説明"
+	LabelSlideshowShuffle         = "スライドショーシャッフル"
+	LabelSlideshowRestart         = "スライドショー先頭から"
+	LabelSlideshowStatus          = "スライドショー状況"
+	LabelSlideshowHere            = "ここからスライドショー"
+	LabelOpenFolder               = "フォルダを開く"
+	LabelPinnedClose              = "一覧を閉じる"
+	LabelCopyGroupPaths           = "同じ内容のパスをコピー"
+	LabelScanRules                = "走査条件"
+	LabelScanRulesTip             = "走査条件説明"
+	LabelScanInclude              = "対象パターン"
+	LabelScanExclude              = "除外パターン"
+	LabelScanPatternTip           = "パターン説明"
+	LabelScanMaxDepth             = "階層上限"
+	LabelScanSkipHidden           = "隠しフォルダを除外"
+	LabelScanFollowLinks          = "リンク先のフォルダも走査"
+	LabelScanIgnoreFileTip        = "除外規則ファイル説明"
+	LabelExclusions               = "除外の内訳"
+	LabelExclusionsEmpty          = "除外なし"
+	LabelExclusionsTotal          = "除外件数"
+	LabelVisibleKinds             = "表示するファイル種別"
+	LabelKindModel                = "種別モデル"
+	LabelKindAccessory            = "種別アクセサリ"
+	LabelKindMotion               = "種別モーション"
+	LabelKindPose                 = "種別ポーズ"
+	LabelKindImage                = "種別画像"
+	LabelKindReadme               = "種別説明書"
+	LabelApplyToModel             = "現在のモデルに適用"
+	LabelOpenFile                 = "ファイルを開く"
 )
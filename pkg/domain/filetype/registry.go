@@ -0,0 +1,146 @@
+// 指示: miu200521358
+// Package filetype はファイル拡張子とツリー上のノード種別の対応を管理する。
+package filetype
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kind はツリー上のノード種別を表す。
+type Kind string
+
+const (
+	// KindUnknown は登録されていない種別を表す。
+	KindUnknown Kind = ""
+	// KindModel はモデルを表す。
+	KindModel Kind = "model"
+	// KindAccessory はアクセサリを表す。
+	KindAccessory Kind = "accessory"
+	// KindMotion はモーションを表す。
+	KindMotion Kind = "motion"
+	// KindPose はポーズを表す。
+	KindPose Kind = "pose"
+	// KindImage は画像を表す。
+	KindImage Kind = "image"
+	// KindReadme は説明書きを表す。
+	KindReadme Kind = "readme"
+)
+
+// Kinds は既定の種別を表示順で返す。
+func Kinds() []Kind {
+	return []Kind{KindModel, KindAccessory, KindMotion, KindPose, KindImage, KindReadme}
+}
+
+// DefaultVisibleKinds はツリーに既定で表示する種別を返す。
+func DefaultVisibleKinds() []Kind {
+	return []Kind{KindModel}
+}
+
+// Registry は拡張子と種別の対応を保持する。
+type Registry struct {
+	mu    sync.RWMutex
+	kinds map[string]Kind
+}
+
+// NewRegistry は空のRegistryを生成する。
+func NewRegistry() *Registry {
+	return &Registry{kinds: map[string]Kind{}}
+}
+
+// NewDefaultRegistry は既定の拡張子を登録したRegistryを生成する。
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(KindModel, ".pmx", ".pmd", ".x")
+	r.Register(KindAccessory, ".vac")
+	r.Register(KindMotion, ".vmd")
+	r.Register(KindPose, ".vpd")
+	r.Register(KindImage, ".png", ".jpg", ".jpeg", ".bmp", ".tga", ".gif", ".dds", ".spa", ".sph")
+	r.Register(KindReadme, ".txt", ".md")
+	return r
+}
+
+// Register は拡張子を種別に対応付ける。登録済みの拡張子は上書きする。
+func (r *Registry) Register(kind Kind, exts ...string) {
+	if r == nil || kind == KindUnknown {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ext := range exts {
+		key := normalizeExt(ext)
+		if key == "" {
+			continue
+		}
+		r.kinds[key] = kind
+	}
+}
+
+// KindOf はパスの拡張子に対応する種別を返す。
+func (r *Registry) KindOf(path string) Kind {
+	if r == nil || path == "" {
+		return KindUnknown
+	}
+	key := normalizeExt(filepath.Ext(path))
+	if key == "" {
+		return KindUnknown
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.kinds[key]
+}
+
+// Extensions は種別に対応する拡張子を昇順で返す。
+func (r *Registry) Extensions(kind Kind) []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var exts []string
+	for ext, registered := range r.kinds {
+		if registered == kind {
+			exts = append(exts, ext)
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Match は指定種別のいずれかに該当するか判定する関数を返す。
+func (r *Registry) Match(kinds ...Kind) func(path string) bool {
+	targets := map[Kind]struct{}{}
+	for _, kind := range kinds {
+		if kind != KindUnknown {
+			targets[kind] = struct{}{}
+		}
+	}
+	return func(path string) bool {
+		_, ok := targets[r.KindOf(path)]
+		return ok
+	}
+}
+
+// Signature は指定種別の判定条件を表す文字列を返す。登録内容が変わると値も変わる。
+func (r *Registry) Signature(kinds ...Kind) string {
+	var exts []string
+	for _, kind := range kinds {
+		exts = append(exts, r.Extensions(kind)...)
+	}
+	sort.Strings(exts)
+	return strings.Join(exts, ",")
+}
+
+// normalizeExt は拡張子を比較用に正規化する。
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" {
+		return ""
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
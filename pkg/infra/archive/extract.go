@@ -0,0 +1,253 @@
+// 指示: miu200521358
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// extractDirName は一時展開先の既定フォルダ名を表す。
+	extractDirName = "mu_tree_viewer_archive"
+	// sessionDirPattern は起動ごとの展開先フォルダ名のパターンを表す。
+	sessionDirPattern = "session-*"
+	// staleSessionAge は前回以前の展開先を削除するまでの経過時間を表す。
+	staleSessionAge = 24 * time.Hour
+)
+
+// ErrEntryNotFound はアーカイブ内にエントリが無いことを表す。
+var ErrEntryNotFound = errors.New("archive entry not found")
+
+// Extractor はアーカイブ内のモデルを一時フォルダへ展開する。
+type Extractor struct {
+	baseDir string
+
+	mu         sync.Mutex
+	sessionDir string
+	archiveSeq int
+	archiveDir map[string]string
+	extracted  map[string]string
+}
+
+// NewExtractor はExtractorを生成する。baseDirが空の場合はOSの一時フォルダ配下を使う。
+func NewExtractor(baseDir string) *Extractor {
+	if baseDir == "" {
+		baseDir = filepath.Join(os.TempDir(), extractDirName)
+	}
+	return &Extractor{
+		baseDir:    baseDir,
+		archiveDir: map[string]string{},
+		extracted:  map[string]string{},
+	}
+}
+
+// Resolve は仮想パスを展開済みのローカルパスに変換する。
+// アーカイブ内でない場合はokにfalseを返す。
+func (e *Extractor) Resolve(virtualPath string) (string, bool, error) {
+	if e == nil {
+		return "", false, nil
+	}
+	archivePath, inner, ok := SplitPath(virtualPath)
+	if !ok || inner == "" {
+		return "", false, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := strings.ToLower(JoinPath(archivePath, inner))
+	if localPath, ok := e.extracted[key]; ok {
+		if _, err := os.Stat(localPath); err == nil {
+			return localPath, true, nil
+		}
+		delete(e.extracted, key)
+	}
+	destDir, err := e.archiveDirFor(archivePath)
+	if err != nil {
+		return "", true, err
+	}
+	localPath, err := extractModel(archivePath, inner, destDir)
+	if err != nil {
+		return "", true, err
+	}
+	e.extracted[key] = localPath
+	return localPath, true, nil
+}
+
+// Cleanup は今回の起動で展開したファイルを削除する。
+func (e *Extractor) Cleanup() error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.sessionDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(e.sessionDir)
+	e.sessionDir = ""
+	e.archiveDir = map[string]string{}
+	e.extracted = map[string]string{}
+	return err
+}
+
+// archiveDirFor はアーカイブごとの展開先フォルダを返す。
+func (e *Extractor) archiveDirFor(archivePath string) (string, error) {
+	key := strings.ToLower(archivePath)
+	if dir, ok := e.archiveDir[key]; ok {
+		return dir, nil
+	}
+	if e.sessionDir == "" {
+		if err := os.MkdirAll(e.baseDir, 0o755); err != nil {
+			return "", err
+		}
+		// 異常終了で残った過去の展開先を片付ける。
+		sweepStaleSessions(e.baseDir)
+		sessionDir, err := os.MkdirTemp(e.baseDir, sessionDirPattern)
+		if err != nil {
+			return "", err
+		}
+		e.sessionDir = sessionDir
+	}
+	e.archiveSeq++
+	name := strings.TrimSuffix(filepath.Base(archivePath), filepath.Ext(archivePath))
+	dir := filepath.Join(e.sessionDir, fmt.Sprintf("%03d_%s", e.archiveSeq, name))
+	e.archiveDir[key] = dir
+	return dir, nil
+}
+
+// sweepStaleSessions は一定時間以上経過した展開先を削除する。
+func sweepStaleSessions(baseDir string) {
+	matches, err := filepath.Glob(filepath.Join(baseDir, sessionDirPattern))
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < staleSessionAge {
+			continue
+		}
+		_ = os.RemoveAll(match)
+	}
+}
+
+// archiveFile は展開対象のエントリと正規化済みの名前を表す。
+type archiveFile struct {
+	file *zip.File
+	name string
+}
+
+// extractModel はモデルと参照テクスチャを展開し、展開したモデルのパスを返す。
+// 参照を読み取れない場合はモデルのフォルダ配下をまとめて展開する。
+func extractModel(archivePath string, inner string, destDir string) (string, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	files := map[string]archiveFile{}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name, ok := cleanEntryName(decodeName(file))
+		if !ok {
+			continue
+		}
+		files[strings.ToLower(name)] = archiveFile{file: file, name: name}
+	}
+	modelName, ok := cleanEntryName(inner)
+	if !ok {
+		return "", ErrEntryNotFound
+	}
+	model, ok := files[strings.ToLower(modelName)]
+	if !ok {
+		return "", ErrEntryNotFound
+	}
+	modelPath, err := extractFile(model.file, model.name, destDir)
+	if err != nil {
+		return "", err
+	}
+
+	modelDir := path.Dir(model.name)
+	refs, err := readModelTextureRefs(modelPath)
+	if err != nil {
+		for key, entry := range files {
+			if modelDir == "." || strings.HasPrefix(key, strings.ToLower(modelDir)+"/") {
+				if _, err := extractFile(entry.file, entry.name, destDir); err != nil {
+					return "", err
+				}
+			}
+		}
+		return modelPath, nil
+	}
+	for _, ref := range refs {
+		refName, ok := cleanEntryName(path.Join(modelDir, strings.ReplaceAll(ref, `\`, "/")))
+		if !ok {
+			continue
+		}
+		entry, ok := files[strings.ToLower(refName)]
+		if !ok {
+			// 参照先が無いテクスチャは読み込み側で扱う。
+			continue
+		}
+		if _, err := extractFile(entry.file, entry.name, destDir); err != nil {
+			return "", err
+		}
+	}
+	return modelPath, nil
+}
+
+// readModelTextureRefs は展開済みモデルのテクスチャ参照を読み込む。
+func readModelTextureRefs(modelPath string) ([]string, error) {
+	file, err := os.Open(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readTextureRefs(modelPath, file, info.Size())
+}
+
+// extractFile はエントリを展開先へ書き出す。展開先の外へ出るパスは拒否する。
+func extractFile(file *zip.File, name string, destDir string) (string, error) {
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid archive entry: %s", name)
+	}
+	if info, err := os.Stat(target); err == nil && !info.IsDir() && info.Size() == int64(file.UncompressedSize64) {
+		return target, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,68 @@
+// 指示: miu200521358
+// Package archive はZIPアーカイブ内のファイルを仮想フォルダとして扱う。
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// zipExt はZIPアーカイブの拡張子を表す。
+	zipExt = ".zip"
+)
+
+// IsArchive はZIPアーカイブの拡張子か判定する。
+func IsArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), zipExt)
+}
+
+// SplitPath はアーカイブ内の仮想パスをアーカイブのパスと内部パスに分割する。
+// 内部パスはスラッシュ区切りで、アーカイブ自体を指す場合は空文字を返す。
+func SplitPath(path string) (archivePath string, inner string, ok bool) {
+	if path == "" || !strings.Contains(strings.ToLower(path), zipExt) {
+		// 大半のパスはここで判定を終え、ファイル確認を行わない。
+		return "", "", false
+	}
+	cleaned := filepath.Clean(path)
+	parts := strings.Split(cleaned, string(filepath.Separator))
+	for i, part := range parts {
+		if !IsArchive(part) {
+			continue
+		}
+		candidate := strings.Join(parts[:i+1], string(filepath.Separator))
+		if candidate == "" {
+			continue
+		}
+		if filepath.VolumeName(candidate) == candidate {
+			candidate += string(filepath.Separator)
+		}
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return candidate, strings.Join(parts[i+1:], "/"), true
+	}
+	return "", "", false
+}
+
+// JoinPath はアーカイブのパスと内部パスから仮想パスを組み立てる。
+func JoinPath(archivePath string, inner string) string {
+	if inner == "" {
+		return archivePath
+	}
+	return filepath.Join(archivePath, filepath.FromSlash(inner))
+}
+
+// HasArchiveSegment はアーカイブ拡張子のフォルダを経由するパスか、ファイルを確認せずに判定する。
+func HasArchiveSegment(path string) bool {
+	dir := strings.ToLower(filepath.Dir(path)) + string(filepath.Separator)
+	return strings.Contains(dir, zipExt+string(filepath.Separator))
+}
+
+// IsVirtualPath は指定パスがアーカイブ内を指すか判定する。
+func IsVirtualPath(path string) bool {
+	_, inner, ok := SplitPath(path)
+	return ok && inner != ""
+}
@@ -0,0 +1,159 @@
+// 指示: miu200521358
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/japanese"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+const (
+	// maxTextureCount はテクスチャ参照として読み込む件数の上限を表す。
+	maxTextureCount = 4096
+	// pmdHeaderSize はPMDのヘッダサイズを表す。
+	pmdHeaderSize = 3 + 4 + 20 + 256
+	// pmdVertexSize はPMDの頂点1件のサイズを表す。
+	pmdVertexSize = 38
+	// pmdMaterialSize はPMDの材質1件のサイズを表す。
+	pmdMaterialSize = 70
+	// pmdTextureOffset はPMDの材質内のテクスチャ名の位置を表す。
+	pmdTextureOffset = 50
+	// pmdTextureSize はPMDのテクスチャ名のサイズを表す。
+	pmdTextureSize = 20
+)
+
+// errUnsupportedModel はテクスチャ参照を読み取れない形式を表す。
+var errUnsupportedModel = errors.New("unsupported model format")
+
+// xTexturePattern はX形式のテクスチャ参照を表す。
+var xTexturePattern = regexp.MustCompile(`(?i)TextureFilename\s*\{\s*"([^"]*)"`)
+
+// readTextureRefs はモデルが参照するテクスチャの相対パスを返す。sizeはモデルのファイルサイズを表す。
+// PMXはモデル情報の読み込みと同じ読み込み処理で読む。
+func readTextureRefs(modelPath string, r io.Reader, size int64) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(modelPath)) {
+	case ".pmx":
+		return minteractor.ReadPmxTextures(modelPath, r, size)
+	case ".pmd":
+		return readPmdTextures(bufio.NewReader(r))
+	case ".x":
+		return readXTextures(r)
+	default:
+		return nil, errUnsupportedModel
+	}
+}
+
+// readPmdTextures はPMDの材質からテクスチャ・スフィアの参照を読み込む。
+func readPmdTextures(r *bufio.Reader) ([]string, error) {
+	signature := make([]byte, 3)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return nil, err
+	}
+	if string(signature) != "Pmd" {
+		return nil, fmt.Errorf("%w: invalid pmd signature", errUnsupportedModel)
+	}
+	if err := discard(r, pmdHeaderSize-len(signature)); err != nil {
+		return nil, err
+	}
+	vertexCount, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := discard(r, vertexCount*pmdVertexSize); err != nil {
+		return nil, err
+	}
+	faceCount, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := discard(r, faceCount*2); err != nil {
+		return nil, err
+	}
+	materialCount, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if materialCount > maxTextureCount {
+		return nil, fmt.Errorf("%w: too many materials", errUnsupportedModel)
+	}
+	var textures []string
+	material := make([]byte, pmdMaterialSize)
+	for i := 0; i < materialCount; i++ {
+		if _, err := io.ReadFull(r, material); err != nil {
+			return nil, err
+		}
+		raw := material[pmdTextureOffset : pmdTextureOffset+pmdTextureSize]
+		if end := bytes.IndexByte(raw, 0); end >= 0 {
+			raw = raw[:end]
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		name, err := japanese.ShiftJIS.NewDecoder().Bytes(raw)
+		if err != nil {
+			name = raw
+		}
+		// 「テクスチャ*スフィア」形式で2つを参照する場合がある。
+		for _, part := range strings.Split(string(name), "*") {
+			if part != "" {
+				textures = append(textures, part)
+			}
+		}
+	}
+	return textures, nil
+}
+
+// readXTextures はX形式のテクスチャ参照を読み込む。
+func readXTextures(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("xof ")) || !bytes.Contains(data[:min(len(data), 16)], []byte("txt")) {
+		// バイナリ形式のXは参照を読み取れない。
+		return nil, fmt.Errorf("%w: binary x", errUnsupportedModel)
+	}
+	text, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		text = data
+	}
+	var textures []string
+	for _, match := range xTexturePattern.FindAllSubmatch(text, -1) {
+		name := strings.ReplaceAll(string(match[1]), `\\`, `\`)
+		if name != "" {
+			textures = append(textures, name)
+		}
+	}
+	return textures, nil
+}
+
+// readCount は4バイトの件数を読み込む。
+func readCount(r io.Reader) (int, error) {
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("%w: negative count", errUnsupportedModel)
+	}
+	return int(count), nil
+}
+
+// discard は指定バイト数を読み飛ばす。
+func discard(r *bufio.Reader, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	_, err := r.Discard(n)
+	return err
+}
@@ -0,0 +1,257 @@
+// 指示: miu200521358
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+const (
+	// maxCachedArchives は一覧を保持するアーカイブ数の上限を表す。
+	maxCachedArchives = 64
+	// utf8NameFlag はエントリ名がUTF-8であることを示すZIPの汎用フラグを表す。
+	utf8NameFlag = 0x800
+)
+
+// Entry はアーカイブ内のエントリを表す。
+type Entry struct {
+	// Name はスラッシュ区切りの内部パス。
+	Name  string
+	IsDir bool
+}
+
+// listCacheEntry はアーカイブ一覧のキャッシュを表す。
+type listCacheEntry struct {
+	modTime time.Time
+	size    int64
+	entries []Entry
+	used    uint64
+}
+
+var (
+	listCacheMu  sync.Mutex
+	listCache    = map[string]*listCacheEntry{}
+	listCacheSeq uint64
+)
+
+// List はアーカイブ内のエントリ一覧を返す。更新日時とサイズが同じ間は読み直さない。
+// 中間フォルダのエントリが省略されたアーカイブでも、フォルダを補って返す。
+func List(archivePath string) ([]Entry, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := lookupList(archivePath, info.ModTime(), info.Size()); ok {
+		return cached, nil
+	}
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	seen := map[string]struct{}{}
+	var entries []Entry
+	add := func(name string, isDir bool) {
+		key := strings.ToLower(name)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		entries = append(entries, Entry{Name: name, IsDir: isDir})
+	}
+	for _, file := range reader.File {
+		name, ok := cleanEntryName(decodeName(file))
+		if !ok {
+			continue
+		}
+		isDir := file.FileInfo().IsDir()
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			add(dir, true)
+		}
+		add(name, isDir)
+	}
+	storeList(archivePath, info.ModTime(), info.Size(), entries)
+	return entries, nil
+}
+
+// decodeName はエントリ名を復号する。UTF-8フラグが無く不正なUTF-8の場合はShift-JISとして扱う。
+func decodeName(file *zip.File) string {
+	name := file.Name
+	if file.Flags&utf8NameFlag != 0 || utf8.ValidString(name) {
+		return name
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().String(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// cleanEntryName はエントリ名を正規化する。アーカイブ外を指す名前はfalseを返す。
+func cleanEntryName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" || name == "." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// lookupList はキャッシュ済みの一覧を返す。
+func lookupList(archivePath string, modTime time.Time, size int64) ([]Entry, bool) {
+	listCacheMu.Lock()
+	defer listCacheMu.Unlock()
+	cached := listCache[strings.ToLower(archivePath)]
+	if cached == nil || !cached.modTime.Equal(modTime) || cached.size != size {
+		return nil, false
+	}
+	listCacheSeq++
+	cached.used = listCacheSeq
+	return cached.entries, true
+}
+
+// storeList は一覧をキャッシュし、上限を超えた場合は最も古く使われたものを破棄する。
+func storeList(archivePath string, modTime time.Time, size int64, entries []Entry) {
+	listCacheMu.Lock()
+	defer listCacheMu.Unlock()
+	listCacheSeq++
+	listCache[strings.ToLower(archivePath)] = &listCacheEntry{modTime: modTime, size: size, entries: entries, used: listCacheSeq}
+	if len(listCache) <= maxCachedArchives {
+		return
+	}
+	oldestKey := ""
+	var oldestUsed uint64
+	for key, cached := range listCache {
+		if oldestKey == "" || cached.used < oldestUsed {
+			oldestKey = key
+			oldestUsed = cached.used
+		}
+	}
+	delete(listCache, oldestKey)
+}
+
+// Exists は指定パスが実在するか判定する。アーカイブ内の仮想パスはエントリの有無で判定する。
+func Exists(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	archivePath, inner, ok := SplitPath(path)
+	if !ok {
+		return false
+	}
+	if inner == "" {
+		return true
+	}
+	entries, err := List(archivePath)
+	if err != nil {
+		return false
+	}
+	// フォルダのエントリを持たないアーカイブもあるため、配下のエントリがあればフォルダとみなす。
+	prefix := strings.ToLower(inner) + "/"
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name, inner) || strings.HasPrefix(strings.ToLower(entry.Name), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryReader はアーカイブ内のエントリを読み込み、閉じる際にアーカイブも閉じる。
+type entryReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+// Close はエントリとアーカイブを閉じる。
+func (r *entryReader) Close() error {
+	err := r.ReadCloser.Close()
+	if closeErr := r.archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// OpenEntry はアーカイブ内のエントリを開く。エントリのサイズと更新日時も返す。
+func OpenEntry(archivePath string, inner string) (io.ReadCloser, os.FileInfo, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range reader.File {
+		name, ok := cleanEntryName(decodeName(file))
+		if !ok || !strings.EqualFold(name, inner) || file.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			reader.Close()
+			return nil, nil, err
+		}
+		return &entryReader{ReadCloser: entry, archive: reader}, file.FileInfo(), nil
+	}
+	reader.Close()
+	return nil, nil, ErrEntryNotFound
+}
+
+// Open はファイルを開く。アーカイブ内の仮想パスはエントリを開く。ファイル情報も返す。
+func Open(path string) (io.ReadCloser, os.FileInfo, error) {
+	file, err := os.Open(path)
+	if err == nil {
+		info, statErr := file.Stat()
+		if statErr != nil {
+			file.Close()
+			return nil, nil, statErr
+		}
+		return file, info, nil
+	}
+	archivePath, inner, ok := SplitPath(path)
+	if !ok || inner == "" {
+		return nil, nil, err
+	}
+	return OpenEntry(archivePath, inner)
+}
+
+// Stat はファイル情報を返す。アーカイブ内の仮想パスはエントリの情報を返し、
+// エントリを持たないフォルダはアーカイブ自体の情報を返す。
+func Stat(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		return info, nil
+	}
+	archivePath, inner, ok := SplitPath(path)
+	if !ok || inner == "" {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	prefix := strings.ToLower(inner) + "/"
+	isDir := false
+	for _, file := range reader.File {
+		name, ok := cleanEntryName(decodeName(file))
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(name, inner) {
+			return file.FileInfo(), nil
+		}
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			isDir = true
+		}
+	}
+	if !isDir {
+		return nil, ErrEntryNotFound
+	}
+	return os.Stat(archivePath)
+}
@@ -37,6 +37,7 @@ type FolderPicker struct {
 	historyDialog     *walk.Dialog
 	historyListBox    *walk.ListBox
 	prevPaths         []string
+	settingText       bool
 	minSize           declarative.Size
 	maxSize           declarative.Size
 	stretchFactor     int
@@ -167,6 +168,10 @@ func (fp *FolderPicker) Widgets() declarative.Composite {
 
 // handlePathChanged はパス変更時の処理を行う。
 func (fp *FolderPicker) handlePathChanged(path string) {
+	if fp.settingText {
+		// 複数フォルダ反映時の表示更新で先頭フォルダのみに戻さない。
+		return
+	}
 	// パス変更時は同一パスを再適用しない。
 	fp.applyPaths([]string{path}, false)
 }
@@ -331,7 +336,9 @@ func (fp *FolderPicker) applyPaths(paths []string, allowSame bool) {
 	}
 	fp.prevPaths = cleaned
 	if fp.pathEdit != nil {
+		fp.settingText = true
 		fp.pathEdit.SetText(cleaned[0])
+		fp.settingText = false
 	}
 	if fp.onPathsChanged != nil {
 		fp.onPathsChanged(fp.window, cleaned)
@@ -5,7 +5,12 @@
 package ui
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
 )
 
 // logInfoLine は情報ログを1行として出力する。
@@ -45,3 +50,27 @@ func logErrorWithTitle(logger logging.ILogger, title string, err error) {
 	}
 	logger.Error("%s: %s", title, err.Error())
 }
+
+// logScanSummary はフォルダ走査の完了結果をデバッグログへ出力する。
+func logScanSummary(logger logging.ILogger, progress scanner.Progress) {
+	if !progress.Done {
+		return
+	}
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+	logger.Debug("フォルダ走査完了: %s (フォルダ数=%d, 再利用=%d, モデル数=%d, 除外数=%d, エラー数=%d, 経過=%s)",
+		progress.Root, progress.Dirs, progress.Reused, progress.Found, progress.Excluded, progress.Errors, progress.Elapsed)
+}
+
+// resolveUserDataPath はユーザー設定と同じ実行ファイルのフォルダに置くデータファイルのパスを返す。
+func resolveUserDataPath(name string) string {
+	if name == "" {
+		return ""
+	}
+	exePath, err := os.Executable()
+	if err != nil || exePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exePath), name)
+}
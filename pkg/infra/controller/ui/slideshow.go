@@ -0,0 +1,481 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"time"
+
+	"github.com/miu200521358/mlib_go/pkg/domain/motion"
+	"github.com/miu200521358/mlib_go/pkg/infra/controller"
+	"github.com/miu200521358/mlib_go/pkg/infra/controller/widget"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+	"github.com/miu200521358/walk/pkg/declarative"
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+)
+
+const (
+	// slideshowPollInterval は切り替え時期を確認する間隔を表す。
+	slideshowPollInterval = 200 * time.Millisecond
+	// defaultSlideshowSeconds は切り替え間隔(秒)の初期値を表す。
+	defaultSlideshowSeconds = 10
+	// maxSlideshowSeconds は切り替え間隔(秒)の上限を表す。
+	maxSlideshowSeconds = 3600
+)
+
+// SlideshowControl はモデルを一定間隔、またはモーションの終了ごとに切り替えて表示するウィジェットを表す。
+type SlideshowControl struct {
+	window     *controller.ControlWindow
+	translator i18n.II18n
+	logger     logging.ILogger
+	userConfig config.IUserConfig
+	player     *widget.MotionPlayer
+	// collect は開始時の対象となるモデルのパス一覧を求め、UIスレッドでdoneへ渡す。
+	collect func(done func(paths []string))
+	// show はモデルを読み込んで表示する。UIスレッドで呼び出す。
+	show func(path string) error
+
+	paths    []string
+	order    []int
+	position int
+	running  bool
+	paused   bool
+	seq      uint64
+	// done は実行中のrunを終了させる。Stopとウィジェットの破棄で閉じる。
+	done chan struct{}
+	// switchedAt は表示を切り替えた時刻。一時停止中の時間は含めない。
+	switchedAt time.Time
+	pausedAt   time.Time
+	lastFrame  motion.Frame
+	// collecting は開始時の対象を求めている途中か。
+	collecting bool
+	// disposeHooked はウィジェットの破棄時の処理を登録済みか。
+	disposeHooked bool
+
+	seconds     int
+	onMotionEnd bool
+	shuffle     bool
+	restart     bool
+
+	playButton   *walk.PushButton
+	skipButton   *walk.PushButton
+	stopButton   *walk.PushButton
+	intervalEdit *walk.NumberEdit
+	motionCheck  *walk.CheckBox
+	shuffleCheck *walk.CheckBox
+	restartCheck *walk.CheckBox
+	statusLabel  *walk.TextLabel
+}
+
+// NewSlideshowControl はSlideshowControlを生成する。
+func NewSlideshowControl(userConfig config.IUserConfig, translator i18n.II18n, logger logging.ILogger, player *widget.MotionPlayer, collect func(done func(paths []string)), show func(path string) error) *SlideshowControl {
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+	seconds := loadConfigInt(userConfig, userConfigKeySlideshowSeconds, defaultSlideshowSeconds)
+	if seconds <= 0 || seconds > maxSlideshowSeconds {
+		seconds = defaultSlideshowSeconds
+	}
+	return &SlideshowControl{
+		translator:  translator,
+		logger:      logger,
+		userConfig:  userConfig,
+		player:      player,
+		collect:     collect,
+		show:        show,
+		seconds:     seconds,
+		onMotionEnd: loadConfigBool(userConfig, userConfigKeySlideshowMotionEnd, false),
+		shuffle:     loadConfigBool(userConfig, userConfigKeySlideshowShuffle, false),
+		restart:     loadConfigBool(userConfig, userConfigKeySlideshowRestart, true),
+	}
+}
+
+// SetWindow はウィンドウ参照を設定する。
+func (sc *SlideshowControl) SetWindow(window *controller.ControlWindow) {
+	if sc == nil {
+		return
+	}
+	sc.window = window
+}
+
+// SetEnabledInPlaying は再生中の有効状態を設定する。スライドショーはモーション再生中に操作するため常に有効にする。
+func (sc *SlideshowControl) SetEnabledInPlaying(_ bool) {
+}
+
+// Widgets はUI構成を返す。
+func (sc *SlideshowControl) Widgets() declarative.Composite {
+	buttonSize := declarative.Size{Width: 70, Height: 20}
+	return declarative.Composite{
+		Layout: declarative.HBox{},
+		Children: []declarative.Widget{
+			declarative.TextLabel{
+				Text: sc.t(messages.LabelSlideshow),
+			},
+			declarative.PushButton{
+				AssignTo:    &sc.playButton,
+				Text:        sc.t(messages.LabelSlideshowPlay),
+				ToolTipText: sc.t(messages.LabelSlideshowPlayTip),
+				OnClicked:   sc.handlePlay,
+				MinSize:     buttonSize,
+				MaxSize:     buttonSize,
+			},
+			declarative.PushButton{
+				AssignTo:  &sc.skipButton,
+				Text:      sc.t(messages.LabelSlideshowSkip),
+				Enabled:   false,
+				OnClicked: sc.handleSkip,
+				MinSize:   buttonSize,
+				MaxSize:   buttonSize,
+			},
+			declarative.PushButton{
+				AssignTo:  &sc.stopButton,
+				Text:      sc.t(messages.LabelSlideshowStop),
+				Enabled:   false,
+				OnClicked: sc.Stop,
+				MinSize:   buttonSize,
+				MaxSize:   buttonSize,
+			},
+			declarative.TextLabel{
+				Text: sc.t(messages.LabelSlideshowInterval),
+			},
+			declarative.NumberEdit{
+				AssignTo:       &sc.intervalEdit,
+				Value:          float64(sc.seconds),
+				MinValue:       1,
+				MaxValue:       maxSlideshowSeconds,
+				Decimals:       0,
+				OnValueChanged: sc.handleIntervalChanged,
+				MinSize:        declarative.Size{Width: 50},
+				MaxSize:        declarative.Size{Width: 50},
+			},
+			declarative.CheckBox{
+				AssignTo:         &sc.motionCheck,
+				Text:             sc.t(messages.LabelSlideshowMotionEnd),
+				ToolTipText:      sc.t(messages.LabelSlideshowMotionEndTip),
+				Checked:          sc.onMotionEnd,
+				OnCheckedChanged: sc.handleMotionEndChanged,
+			},
+			declarative.CheckBox{
+				AssignTo:         &sc.shuffleCheck,
+				Text:             sc.t(messages.LabelSlideshowShuffle),
+				Checked:          sc.shuffle,
+				OnCheckedChanged: sc.handleShuffleChanged,
+			},
+			declarative.CheckBox{
+				AssignTo:         &sc.restartCheck,
+				Text:             sc.t(messages.LabelSlideshowRestart),
+				Checked:          sc.restart,
+				OnCheckedChanged: sc.handleRestartChanged,
+			},
+			declarative.TextLabel{
+				AssignTo: &sc.statusLabel,
+			},
+			declarative.HSpacer{},
+		},
+	}
+}
+
+// Start は指定したモデルを順に表示するスライドショーを開始する。実行中の場合は対象を差し替える。UIスレッドで呼び出す。
+func (sc *SlideshowControl) Start(paths []string) {
+	if sc == nil {
+		return
+	}
+	paths = uniquePaths(paths)
+	if len(paths) == 0 {
+		logInfoLine(sc.logger, sc.t(messages.LogTreeEmpty))
+		return
+	}
+	if sc.window == nil {
+		return
+	}
+	sc.paths = paths
+	sc.order = sc.buildOrder(-1)
+	sc.position = 0
+	sc.running = true
+	sc.paused = false
+	sc.seq++
+	sc.hookDispose()
+	sc.closeDone()
+	sc.done = make(chan struct{})
+	sc.updateButtons()
+	sc.showCurrent()
+	go sc.run(sc.seq, sc.done)
+}
+
+// Stop はスライドショーを終了する。表示中のモデルはそのまま残す。UIスレッドで呼び出す。
+func (sc *SlideshowControl) Stop() {
+	if sc == nil || !sc.running {
+		return
+	}
+	sc.running = false
+	sc.paused = false
+	sc.seq++
+	sc.closeDone()
+	sc.paths = nil
+	sc.order = nil
+	sc.updateButtons()
+	sc.setStatus("")
+}
+
+// run は一定間隔で切り替え時期を確認する。スライドショーが終了または再開始された場合や、doneが閉じられた場合は抜ける。
+func (sc *SlideshowControl) run(seq uint64, done <-chan struct{}) {
+	ticker := time.NewTicker(slideshowPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		alive := make(chan bool, 1)
+		sc.window.Synchronize(func() {
+			alive <- sc.tick(seq)
+		})
+		// ウィンドウが閉じられるとSynchronizeの処理は実行されないため、doneでも待機を抜ける。
+		select {
+		case ok := <-alive:
+			if !ok {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// closeDone は実行中のrunを終了させる。UIスレッドで呼び出す。
+func (sc *SlideshowControl) closeDone() {
+	if sc.done == nil {
+		return
+	}
+	close(sc.done)
+	sc.done = nil
+}
+
+// hookDispose はウィジェットの破棄時にスライドショーを終了させる処理を一度だけ登録する。
+func (sc *SlideshowControl) hookDispose() {
+	if sc.disposeHooked || sc.playButton == nil {
+		return
+	}
+	sc.disposeHooked = true
+	sc.playButton.Disposing().Attach(func() {
+		sc.running = false
+		sc.seq++
+		sc.closeDone()
+	})
+}
+
+// tick は切り替え時期であれば次のモデルへ進める。スライドショーが続いているかを返す。UIスレッドで呼び出す。
+func (sc *SlideshowControl) tick(seq uint64) bool {
+	if seq != sc.seq || !sc.running {
+		return false
+	}
+	if !sc.paused && sc.shouldAdvance() {
+		sc.advance(1)
+	}
+	return true
+}
+
+// shouldAdvance は次のモデルへ進める時期か判定する。
+// モーション終了で進める場合、モーションが末尾に達するか先頭へ戻った時点で進める。モーションが無い場合は間隔で進める。
+func (sc *SlideshowControl) shouldAdvance() bool {
+	if sc.onMotionEnd && sc.player != nil && sc.player.MaxFrame() > 0 {
+		frame := sc.player.Frame()
+		looped := frame < sc.lastFrame
+		sc.lastFrame = frame
+		return looped || frame >= sc.player.MaxFrame()
+	}
+	return time.Since(sc.switchedAt) >= time.Duration(sc.seconds)*time.Second
+}
+
+// advance は表示順でdelta件先のモデルへ進める。末尾の次は先頭へ戻り、シャッフル時は並びを作り直す。
+func (sc *SlideshowControl) advance(delta int) {
+	if len(sc.order) == 0 {
+		return
+	}
+	next := sc.position + delta
+	if next >= len(sc.order) && sc.shuffle {
+		sc.order = sc.buildOrder(-1)
+	}
+	sc.position = (next%len(sc.order) + len(sc.order)) % len(sc.order)
+	sc.showCurrent()
+}
+
+// showCurrent は現在位置のモデルを表示し、モーションを再生する。
+func (sc *SlideshowControl) showCurrent() {
+	path := sc.paths[sc.order[sc.position]]
+	if sc.show != nil {
+		if err := sc.show(path); err != nil {
+			// 読み込めないモデルは表示を変えずに次の切り替えを待つ。
+			logErrorWithTitle(sc.logger, sc.t(messages.MessageLoadFailed), err)
+		}
+	}
+	if sc.player != nil && sc.player.MaxFrame() > 0 {
+		if sc.restart || sc.player.Frame() >= sc.player.MaxFrame() {
+			// 末尾で止まったモーションは、先頭から再生し直さないと次の切り替え時期の判定に使えない。
+			sc.player.SetFrame(0)
+		}
+		if !sc.paused {
+			sc.player.SetPlaying(true)
+		}
+		sc.lastFrame = sc.player.Frame()
+	}
+	sc.switchedAt = time.Now()
+	sc.setStatus(fmt.Sprintf(sc.t(messages.LabelSlideshowStatus), sc.position+1, len(sc.order), filepath.Base(path)))
+}
+
+// buildOrder は表示順を作る。シャッフル時は無作為に並べる。firstが0以上の場合はそのモデルを先頭にする。
+func (sc *SlideshowControl) buildOrder(first int) []int {
+	order := make([]int, len(sc.paths))
+	for i := range order {
+		order[i] = i
+	}
+	if sc.shuffle {
+		rand.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	if first >= 0 {
+		for i, index := range order {
+			if index == first {
+				copy(order[1:i+1], order[:i])
+				order[0] = first
+				break
+			}
+		}
+	}
+	return order
+}
+
+// handlePlay は停止中であれば選択中のフォルダ配下でスライドショーを開始し、実行中であれば一時停止・再開する。
+func (sc *SlideshowControl) handlePlay() {
+	if sc == nil {
+		return
+	}
+	if !sc.running {
+		if sc.collect != nil && !sc.collecting {
+			sc.collecting = true
+			sc.collect(func(paths []string) {
+				sc.collecting = false
+				sc.Start(paths)
+			})
+		}
+		return
+	}
+	sc.paused = !sc.paused
+	if sc.paused {
+		sc.pausedAt = time.Now()
+	} else {
+		// 一時停止していた時間は切り替え間隔に含めない。
+		sc.switchedAt = sc.switchedAt.Add(time.Since(sc.pausedAt))
+	}
+	if sc.player != nil && sc.player.MaxFrame() > 0 {
+		sc.player.SetPlaying(!sc.paused)
+		sc.lastFrame = sc.player.Frame()
+	}
+	sc.updateButtons()
+}
+
+// handleSkip は次のモデルへ進める。
+func (sc *SlideshowControl) handleSkip() {
+	if sc == nil || !sc.running {
+		return
+	}
+	sc.advance(1)
+}
+
+// handleIntervalChanged は切り替え間隔の変更を反映して保存する。
+func (sc *SlideshowControl) handleIntervalChanged() {
+	if sc == nil || sc.intervalEdit == nil {
+		return
+	}
+	seconds := int(sc.intervalEdit.Value())
+	if seconds <= 0 {
+		return
+	}
+	sc.seconds = seconds
+	if err := saveConfigInt(sc.userConfig, userConfigKeySlideshowSeconds, seconds); err != nil {
+		sc.logger.Warn("スライドショー設定の保存に失敗しました: %s", logging.FormatError(err, sc.logger))
+	}
+}
+
+// handleMotionEndChanged はモーション終了で進めるかの変更を反映して保存する。
+func (sc *SlideshowControl) handleMotionEndChanged() {
+	if sc == nil || sc.motionCheck == nil {
+		return
+	}
+	sc.onMotionEnd = sc.motionCheck.Checked()
+	if sc.player != nil {
+		sc.lastFrame = sc.player.Frame()
+	}
+	sc.saveBool(userConfigKeySlideshowMotionEnd, sc.onMotionEnd)
+}
+
+// handleShuffleChanged はシャッフルの変更を反映して保存する。実行中の場合は表示中のモデルを先頭に並べ直す。
+func (sc *SlideshowControl) handleShuffleChanged() {
+	if sc == nil || sc.shuffleCheck == nil {
+		return
+	}
+	sc.shuffle = sc.shuffleCheck.Checked()
+	if sc.running {
+		sc.order = sc.buildOrder(sc.order[sc.position])
+		sc.position = 0
+	}
+	sc.saveBool(userConfigKeySlideshowShuffle, sc.shuffle)
+}
+
+// handleRestartChanged は切り替え時に先頭から再生するかの変更を反映して保存する。
+func (sc *SlideshowControl) handleRestartChanged() {
+	if sc == nil || sc.restartCheck == nil {
+		return
+	}
+	sc.restart = sc.restartCheck.Checked()
+	sc.saveBool(userConfigKeySlideshowRestart, sc.restart)
+}
+
+// saveBool は真偽値の設定を保存する。
+func (sc *SlideshowControl) saveBool(key string, value bool) {
+	if err := saveConfigBool(sc.userConfig, key, value); err != nil {
+		sc.logger.Warn("スライドショー設定の保存に失敗しました: %s", logging.FormatError(err, sc.logger))
+	}
+}
+
+// updateButtons は実行状態に応じてボタンの表示と有効状態を更新する。
+func (sc *SlideshowControl) updateButtons() {
+	if sc.playButton != nil {
+		key := messages.LabelSlideshowPlay
+		switch {
+		case sc.running && sc.paused:
+			key = messages.LabelSlideshowResume
+		case sc.running:
+			key = messages.LabelSlideshowPause
+		}
+		_ = sc.playButton.SetText(sc.t(key))
+	}
+	for _, button := range []*walk.PushButton{sc.skipButton, sc.stopButton} {
+		if button != nil {
+			button.SetEnabled(sc.running)
+		}
+	}
+}
+
+// setStatus は表示中のモデルの位置を表示する。
+func (sc *SlideshowControl) setStatus(text string) {
+	if sc.statusLabel == nil {
+		return
+	}
+	_ = sc.statusLabel.SetText(text)
+}
+
+// t は翻訳済み文言を返す。
+func (sc *SlideshowControl) t(key string) string {
+	return i18n.TranslateOrMark(sc.translator, key)
+}
@@ -5,6 +5,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -23,6 +24,8 @@ import (
 	"github.com/miu200521358/walk/pkg/walk"
 
 	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
 	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
 )
 
@@ -45,8 +48,10 @@ type treeViewerState struct {
 	window       *controller.ControlWindow
 	player       *widget.MotionPlayer
 	folderPicker *FolderPicker
+	workspaces   *WorkspacePicker
 	motionPicker *widget.FilePicker
 	treeView     *TreeViewWidget
+	slideshow    *SlideshowControl
 
 	folderPaths []string
 	motionPath  string
@@ -108,7 +113,7 @@ func (s *treeViewerState) handleDropFiles(cw *controller.ControlWindow, files []
 }
 
 // handleFolderPathsChanged はフォルダパス変更を処理する。
-func (s *treeViewerState) handleFolderPathsChanged(cw *controller.ControlWindow, paths []string) {
+func (s *treeViewerState) handleFolderPathsChanged(_ *controller.ControlWindow, paths []string) {
 	if s == nil {
 		return
 	}
@@ -116,27 +121,68 @@ func (s *treeViewerState) handleFolderPathsChanged(cw *controller.ControlWindow,
 	if s.treeView == nil {
 		return
 	}
-	targetWindow := cw
-	if targetWindow == nil {
-		targetWindow = s.controlWindow()
+	if ws, ok := s.workspaces.Current(); !ok || !sameStringSlice(cleanPaths(ws.paths()), paths) {
+		// ワークスペース以外のフォルダを選んだ場合はルート単位の設定を解除する。
+		s.workspaces.ClearCurrent()
+		s.treeView.SetRootOptions(nil)
 	}
-	setModelPaths := func() error {
-		return s.treeView.SetModelPaths(paths)
+	// ツリー構築はバックグラウンドで行い、完了時にUIスレッドで結果を受け取る。
+	s.treeView.SetModelPaths(paths, s.handleTreeBuildFinished)
+}
+
+// currentFolderPaths は表示中のルートパス一覧を返す。
+func (s *treeViewerState) currentFolderPaths() []string {
+	if s == nil {
+		return nil
 	}
-	err := error(nil)
-	if targetWindow != nil {
-		// ツリー構築中は再生時と同じ無効化で操作を抑止する。
-		err = base.RunWithBoolState(targetWindow.SetEnabledInPlaying, true, targetWindow.Playing(), setModelPaths)
-	} else {
-		err = setModelPaths()
+	return append([]string{}, s.folderPaths...)
+}
+
+// defaultScanRules は全体の走査条件を返す。
+func (s *treeViewerState) defaultScanRules() scanner.Rules {
+	if s == nil || s.treeView == nil {
+		return scanner.Rules{}
 	}
-	if err != nil {
-		logErrorWithTitle(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeBuildFailure), err)
+	rules, _ := s.treeView.scanRulesSnapshot()
+	return rules
+}
+
+// handleWorkspaceApplied はワークスペースのルートとルート単位の設定でツリーを構築する。
+func (s *treeViewerState) handleWorkspaceApplied(ws workspace) {
+	if s == nil {
+		return
 	}
+	paths := cleanPaths(ws.paths())
 	if len(paths) == 0 {
+		logInfoLine(s.logger, i18n.TranslateOrMark(s.translator, messages.LogWorkspaceNoFolders), ws.Name)
+		return
+	}
+	if s.treeView != nil {
+		s.treeView.SetRootOptions(ws.rootOptions())
+	}
+	if s.folderPicker != nil {
+		s.folderPicker.SetPaths(paths)
+		return
+	}
+	s.handleFolderPathsChanged(s.window, paths)
+}
+
+// handleTreeBuildFinished はツリー構築完了時の処理を行う。
+func (s *treeViewerState) handleTreeBuildFinished(result TreeBuildResult) {
+	if s == nil {
+		return
+	}
+	if result.Canceled {
+		logInfoLine(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeBuildCanceled))
 		return
 	}
-	if s.treeView.model == nil || s.treeView.model.RootCount() == 0 {
+	if result.Err != nil {
+		logErrorWithTitle(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeBuildFailure), result.Err)
+	}
+	if len(result.Paths) == 0 {
+		return
+	}
+	if result.RootCount == 0 {
 		logInfoLine(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeEmpty))
 	}
 }
@@ -189,6 +235,90 @@ func (s *treeViewerState) handleTreeFileSelected(path string) {
 	if err := s.loadModelInternal(path, true); err != nil {
 		logErrorWithTitle(s.logger, i18n.TranslateOrMark(s.translator, messages.MessageLoadFailed), err)
 	}
+	// 上下キーで続けて表示する前後のモデルを裏で読み込んでおく。
+	if s.usecase != nil && s.treeView != nil {
+		s.usecase.PrefetchModels(s.treeView.AdjacentModelPaths())
+	}
+}
+
+// slideshowTargets はスライドショーの対象として、ツリーで選択中のフォルダ配下のモデルを求めてdoneへ渡す。
+// 未選択の場合は全ルート配下のモデルを対象にする。
+func (s *treeViewerState) slideshowTargets(done func(paths []string)) {
+	if s == nil {
+		return
+	}
+	if s.treeView != nil {
+		if path := s.treeView.SelectedFolderPath(); path != "" {
+			s.collectFolderTargets([]string{path}, done)
+			return
+		}
+	}
+	s.collectFolderTargets(s.folderPaths, done)
+}
+
+// startSlideshowAt は指定フォルダ配下のモデルでスライドショーを開始する。
+func (s *treeViewerState) startSlideshowAt(path string) {
+	if s == nil || s.slideshow == nil {
+		return
+	}
+	s.collectModelTargets(path, true, s.slideshow.Start)
+}
+
+// showSlideshowModel はスライドショーで表示するモデルを読み込み、ツリーの選択を合わせる。UIスレッドで呼び出す。
+func (s *treeViewerState) showSlideshowModel(path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.treeView != nil {
+		s.treeView.RevealModel(path)
+	}
+	return s.loadModelInternal(path, false)
+}
+
+// registerTreeKindHandlers はモデル以外のノード種別の処理をツリーへ登録する。
+func (s *treeViewerState) registerTreeKindHandlers() {
+	if s == nil || s.treeView == nil {
+		return
+	}
+	applyMotion := kindHandler{
+		onSelect: s.applyMotionPath,
+		actions:  []nodeAction{{textKey: messages.LabelApplyToModel, run: s.applyMotionPath}},
+	}
+	s.treeView.registerKindHandler(filetype.KindMotion, applyMotion)
+	s.treeView.registerKindHandler(filetype.KindPose, applyMotion)
+
+	openFile := func(path string) {
+		if s.usecase != nil {
+			// アーカイブ内のファイルは一時展開してから関連付けで開く。
+			localPath, err := s.usecase.ResolveLocalPath(path)
+			if err != nil {
+				s.logger.Warn("ファイルを開けませんでした: %s", logging.FormatError(err, s.logger))
+				return
+			}
+			path = localPath
+		}
+		openWithShell(s.logger, path)
+	}
+	external := kindHandler{
+		onActivate: openFile,
+		actions:    []nodeAction{{textKey: messages.LabelOpenFile, run: openFile}},
+	}
+	s.treeView.registerKindHandler(filetype.KindAccessory, external)
+	s.treeView.registerKindHandler(filetype.KindImage, external)
+	s.treeView.registerKindHandler(filetype.KindReadme, external)
+}
+
+// applyMotionPath はツリーで選択されたモーション・ポーズを現在のモデルへ適用する。
+func (s *treeViewerState) applyMotionPath(path string) {
+	if s == nil || path == "" {
+		return
+	}
+	if s.motionPicker != nil {
+		// 入力欄の表示と読み込みを揃えるためファイル選択欄経由で反映する。
+		s.motionPicker.SetPath(path)
+		return
+	}
+	s.handleMotionPathChanged(s.controlWindow(), nil, path)
 }
 
 // loadModelInternal はモデルを読み込み、共有状態へ反映する。
@@ -258,16 +388,17 @@ func (s *treeViewerState) handleScreenshotSave(path string, isDir bool) {
 	if s == nil || path == "" {
 		return
 	}
-	targets := s.collectScreenshotTargets(path, isDir)
-	if len(targets) == 0 {
-		logInfoLine(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeEmpty))
-		return
-	}
-	if !s.beginScreenshotSequence(targets) {
-		if s.logger != nil {
-			s.logger.Warn("スクリーンショット処理中のため新しい要求を無視しました")
+	s.collectModelTargets(path, isDir, func(targets []string) {
+		if len(targets) == 0 {
+			logInfoLine(s.logger, i18n.TranslateOrMark(s.translator, messages.LogTreeEmpty))
+			return
 		}
-	}
+		if !s.beginScreenshotSequence(targets) {
+			if s.logger != nil {
+				s.logger.Warn("スクリーンショット処理中のため新しい要求を無視しました")
+			}
+		}
+	})
 }
 
 // beginScreenshotSequence はスクリーンショット連続処理を開始する。
@@ -332,24 +463,79 @@ func (s *treeViewerState) runScreenshotSequence(paths []string) {
 	}
 }
 
-// collectScreenshotTargets はスクリーンショット対象のモデルパス一覧を返す。
-func (s *treeViewerState) collectScreenshotTargets(path string, isDir bool) []string {
+// collectModelTargets はスクリーンショット・スライドショーの対象のモデルパス一覧を求め、UIスレッドでdoneへ渡す。
+// UIスレッドで呼び出す。
+func (s *treeViewerState) collectModelTargets(path string, isDir bool, done func(paths []string)) {
 	if s == nil || path == "" {
-		return nil
+		return
 	}
 	if !isDir {
-		return []string{path}
+		if !isModelFile(path) {
+			done(nil)
+			return
+		}
+		done([]string{path})
+		return
 	}
-	if s.treeView != nil {
-		if paths := s.treeView.CollectModelPathsUnder(path); len(paths) > 0 {
-			return paths
+	s.collectFolderTargets([]string{path}, done)
+}
+
+// collectFolderTargets はフォルダ配下のモデルパス一覧を求め、UIスレッドでdoneへ渡す。
+// ツリーに無いフォルダの走査とクエリの照合はバックグラウンドで行う。UIスレッドで呼び出す。
+func (s *treeViewerState) collectFolderTargets(dirs []string, done func(paths []string)) {
+	if s == nil {
+		return
+	}
+	results := make([][]string, len(dirs))
+	var pending []int
+	for i, dir := range dirs {
+		if s.treeView != nil {
+			if paths := s.treeView.CollectModelPathsUnder(dir); len(paths) > 0 {
+				results[i] = paths
+				continue
+			}
 		}
+		pending = append(pending, i)
 	}
-	paths, err := collectModelPaths(path)
-	if err != nil && s.logger != nil {
-		s.logger.Warn("スクリーンショット対象の探索に失敗しました: %s", err.Error())
+	join := func() []string {
+		var paths []string
+		for _, result := range results {
+			paths = append(paths, result...)
+		}
+		return paths
+	}
+	if len(pending) == 0 {
+		done(join())
+		return
+	}
+	opts := make([]treeBuildOptions, len(dirs))
+	filter := func(paths []string) []string { return paths }
+	if s.treeView != nil {
+		for _, i := range pending {
+			opts[i] = s.treeView.scanOptionsFor(dirs[i])
+		}
+		// クエリで絞り込んでいる場合は一致するモデルのみを対象にする。
+		filter = s.treeView.modelPathFilter()
 	}
-	return paths
+	go func() {
+		for _, i := range pending {
+			paths, err := collectModelPaths(context.Background(), dirs[i], opts[i], func(progress scanner.Progress) {
+				logScanSummary(s.logger, progress)
+			})
+			if err != nil && s.logger != nil {
+				s.logger.Warn("対象モデルの探索に失敗しました: %s", err.Error())
+			}
+			results[i] = filter(paths)
+		}
+		paths := join()
+		if s.treeView == nil {
+			done(paths)
+			return
+		}
+		s.treeView.synchronize(func() {
+			done(paths)
+		})
+	}()
 }
 
 // executeOnUIThread はUIスレッドで処理を実行して結果を返す。
@@ -24,7 +24,7 @@ const (
 )
 
 // NewTabPages はmu_tree_viewer用のタブページを生成する。
-func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices, initialMotionPath string, audioPlayer audio_api.IAudioPlayer, viewerUsecase *minteractor.TreeViewerUsecase) []declarative.TabPage {
+func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices, initialMotionPath string, audioPlayer audio_api.IAudioPlayer, viewerUsecase *minteractor.TreeViewerUsecase, tagUsecase *minteractor.ModelTagUsecase, duplicateUsecase *minteractor.DuplicateUsecase) []declarative.TabPage {
 	var fileTab *walk.TabPage
 
 	var translator i18n.II18n
@@ -58,6 +58,15 @@ func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices,
 		state.handleFolderPathsChanged,
 	)
 
+	state.workspaces = NewWorkspacePicker(
+		userConfig,
+		translator,
+		logger,
+		state.currentFolderPaths,
+		state.defaultScanRules,
+		state.handleWorkspaceApplied,
+	)
+
 	state.motionPicker = widget.NewVmdVpdLoadFilePicker(
 		userConfig,
 		translator,
@@ -70,13 +79,24 @@ func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices,
 	state.treeView = NewTreeViewWidget(translator, logger, state.handleTreeFileSelected, state.handleCopyPath, state.handleScreenshotSave)
 	state.treeView.SetMinSize(declarative.Size{Width: 400, Height: treeViewFixedHeight})
 	state.treeView.SetStretchFactor(1)
+	state.treeView.SetUserConfig(userConfig)
+	state.registerTreeKindHandlers()
+	state.treeView.setModelNameReader(viewerUsecase.ReadModelNames)
+	state.treeView.setModelMetadataReader(viewerUsecase.ReadModelMetadata)
+	state.treeView.setTagUsecase(tagUsecase)
+	state.treeView.setDuplicateUsecase(duplicateUsecase)
+	state.treeView.setSlideshowHandler(state.startSlideshowAt)
+
+	state.slideshow = NewSlideshowControl(userConfig, translator, logger, state.player, state.slideshowTargets, state.showSlideshowModel)
 
 	if mWidgets != nil {
 		mWidgets.Widgets = append(mWidgets.Widgets,
 			state.folderPicker,
+			state.workspaces,
 			state.motionPicker,
 			state.treeView,
 			state.player,
+			state.slideshow,
 		)
 		mWidgets.SetOnLoaded(func() {
 			if mWidgets == nil || mWidgets.Window() == nil {
@@ -104,6 +124,7 @@ func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices,
 				Layout: declarative.VBox{},
 				Children: []declarative.Widget{
 					state.folderPicker.Widgets(),
+					state.workspaces.Widgets(),
 					state.motionPicker.Widgets(),
 					declarative.VSeparator{},
 					declarative.Composite{
@@ -115,6 +136,7 @@ func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices,
 					},
 					declarative.VSeparator{},
 					state.player.Widgets(),
+					state.slideshow.Widgets(),
 				},
 			},
 		},
@@ -124,6 +146,6 @@ func NewTabPages(mWidgets *controller.MWidgets, baseServices base.IBaseServices,
 }
 
 // NewTabPage はmu_tree_viewer用の単一タブを生成する。
-func NewTabPage(mWidgets *controller.MWidgets, baseServices base.IBaseServices, initialMotionPath string, audioPlayer audio_api.IAudioPlayer, viewerUsecase *minteractor.TreeViewerUsecase) declarative.TabPage {
-	return NewTabPages(mWidgets, baseServices, initialMotionPath, audioPlayer, viewerUsecase)[0]
+func NewTabPage(mWidgets *controller.MWidgets, baseServices base.IBaseServices, initialMotionPath string, audioPlayer audio_api.IAudioPlayer, viewerUsecase *minteractor.TreeViewerUsecase, tagUsecase *minteractor.ModelTagUsecase, duplicateUsecase *minteractor.DuplicateUsecase) declarative.TabPage {
+	return NewTabPages(mWidgets, baseServices, initialMotionPath, audioPlayer, viewerUsecase, tagUsecase, duplicateUsecase)[0]
 }
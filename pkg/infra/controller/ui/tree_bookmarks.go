@@ -0,0 +1,183 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+// favoritesLabelPrefix はお気に入りルートの表示名に付ける印を表す。
+const favoritesLabelPrefix = "★ "
+
+// bookmark はブックマークしたファイル・フォルダを表す。
+type bookmark struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+// loadBookmarks はユーザー設定からブックマーク一覧を読み込む。読めない項目は無視する。
+func loadBookmarks(userConfig config.IUserConfig) []bookmark {
+	values := loadConfigList(userConfig, userConfigKeyBookmarks)
+	bookmarks := make([]bookmark, 0, len(values))
+	for _, value := range values {
+		var mark bookmark
+		if err := json.Unmarshal([]byte(value), &mark); err != nil || mark.Path == "" {
+			continue
+		}
+		bookmarks = append(bookmarks, mark)
+	}
+	return bookmarks
+}
+
+// saveBookmarks はユーザー設定へブックマーク一覧を保存する。
+func saveBookmarks(userConfig config.IUserConfig, bookmarks []bookmark) error {
+	values := make([]string, 0, len(bookmarks))
+	for _, mark := range bookmarks {
+		data, err := json.Marshal(mark)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(data))
+	}
+	return saveConfigList(userConfig, userConfigKeyBookmarks, values)
+}
+
+// bookmarkIndex は指定パスのブックマークの位置を返す。見つからない場合は-1を返す。
+func (tw *TreeViewWidget) bookmarkIndex(path string) int {
+	for i, mark := range tw.bookmarks {
+		if sameFilePath(mark.Path, path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleContextBookmarkAdd はコンテキストメニューの対象をブックマークに追加する。
+func (tw *TreeViewWidget) handleContextBookmarkAdd() {
+	if tw == nil || tw.contextPath == "" || tw.bookmarkIndex(tw.contextPath) >= 0 {
+		return
+	}
+	tw.bookmarks = append(tw.bookmarks, bookmark{Path: tw.contextPath, Dir: tw.contextIsDir})
+	tw.saveBookmarks()
+	tw.refreshFavorites()
+}
+
+// handleContextBookmarkRemove はコンテキストメニューの対象をブックマークから外す。
+func (tw *TreeViewWidget) handleContextBookmarkRemove() {
+	if tw == nil || tw.contextPath == "" {
+		return
+	}
+	index := tw.bookmarkIndex(tw.contextPath)
+	if index < 0 {
+		return
+	}
+	tw.bookmarks = append(tw.bookmarks[:index], tw.bookmarks[index+1:]...)
+	tw.saveBookmarks()
+	tw.refreshFavorites()
+}
+
+// saveBookmarks はブックマーク一覧を保存する。
+func (tw *TreeViewWidget) saveBookmarks() {
+	if err := saveBookmarks(tw.userConfig, tw.bookmarks); err != nil && tw.logger != nil {
+		tw.logger.Warn("ブックマークの保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+}
+
+// refreshFavorites はブックマークからお気に入りルートを作り直す。ブックマークが無い場合はルートを表示しない。
+// UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshFavorites() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	if len(tw.bookmarks) == 0 {
+		tw.model.SetFavorites(nil)
+		return
+	}
+	if tw.favoritesRoot == nil {
+		tw.favoritesRoot = NewTreeNode(favoritesLabelPrefix+i18n.TranslateOrMark(tw.translator, messages.LabelFavorites), "", nil, true)
+	}
+	root := tw.favoritesRoot
+	root.children = root.children[:0]
+	opts := tw.buildOptions()
+	missingLabel := i18n.TranslateOrMark(tw.translator, messages.LabelBookmarkMissing)
+	for _, mark := range tw.bookmarks {
+		node := NewTreeNode(filepath.Base(mark.Path), mark.Path, root, mark.Dir)
+		if !archive.Exists(mark.Path) {
+			node.status = missingLabel
+		} else if mark.Dir {
+			// 配下は展開時に探索する。除外規則は所属するルートを基準にする。
+			nodeOpts := opts.forRoot(tw.filterRootOf(mark.Path))
+			nodeOpts.filter = scanner.NewFilter(tw.filterRootOf(mark.Path), nodeOpts.rules)
+			node.loader = &lazyLoader{opts: nodeOpts}
+			node.filter = nodeOpts.filter
+		}
+		root.addChild(node)
+	}
+	var changed []*TreeNode
+	root.updateCounts(&changed)
+	tw.model.SetFavorites(root)
+	if tw.treeView != nil {
+		_ = tw.treeView.SetExpanded(root, true)
+	}
+	tw.requestModelLabels(root.children)
+	tw.requestModelTags(root.children)
+}
+
+// filterRootOf は指定パスの除外規則の基準となるルートを返す。表示中のルート外の場合はパス自身を返す。
+func (tw *TreeViewWidget) filterRootOf(path string) string {
+	if tw.model != nil {
+		if root := findRootPathOf(tw.model.rootPaths, path); root != "" {
+			return root
+		}
+	}
+	return path
+}
+
+// moveSelectionInPinned はお気に入りなど固定表示のルート内でモデル選択を進める。
+// 端に達した場合はそこで止める。
+func (tw *TreeViewWidget) moveSelectionInPinned(move selectionMove, base *TreeNode) {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	pinned := tw.model.pinnedRootOf(base)
+	if pinned == nil {
+		return
+	}
+	nodes := collectFileNodes([]*TreeNode{pinned})
+	if len(nodes) == 0 {
+		return
+	}
+	current := -1
+	for i, node := range nodes {
+		if node == base {
+			current = i
+			break
+		}
+		if base.IsDir() && isAncestorNode(base, node) {
+			// フォルダ・組のノードからは、その先頭のモデルを基準に移動する。
+			current = i
+			if move.delta > 0 && !move.edge && !move.folder {
+				current = i - 1
+			}
+			break
+		}
+	}
+	tw.selectFileNode(nodes[move.targetIndex(nodes, current)])
+}
+
+// isBookmarked は指定パスがブックマーク済みか判定する。
+func (tw *TreeViewWidget) isBookmarked(path string) bool {
+	return path != "" && tw.bookmarkIndex(strings.TrimSpace(path)) >= 0
+}
@@ -0,0 +1,326 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+const (
+	// scanIndexFileName は走査インデックスの保存ファイル名を表す。
+	scanIndexFileName = "tree_scan_index.json"
+)
+
+// TreeBuildResult はツリー構築の結果を表す。
+type TreeBuildResult struct {
+	Paths     []string
+	RootCount int
+	Canceled  bool
+	Err       error
+}
+
+// treeBuildProgress は複数ルートの走査進捗を集計する。
+type treeBuildProgress struct {
+	mu    sync.Mutex
+	roots map[string]scanner.Progress
+}
+
+// newTreeBuildProgress はtreeBuildProgressを生成する。
+func newTreeBuildProgress() *treeBuildProgress {
+	return &treeBuildProgress{roots: map[string]scanner.Progress{}}
+}
+
+// update はルート単位の進捗を反映し、全体の合計を返す。
+func (p *treeBuildProgress) update(progress scanner.Progress) scanner.Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roots[progress.Root] = progress
+	total := scanner.Progress{}
+	for _, rootProgress := range p.roots {
+		total.Dirs += rootProgress.Dirs
+		total.Found += rootProgress.Found
+		total.Errors += rootProgress.Errors
+		total.Excluded += rootProgress.Excluded
+		if rootProgress.Elapsed > total.Elapsed {
+			total.Elapsed = rootProgress.Elapsed
+		}
+	}
+	return total
+}
+
+// SetModelPaths はルートパス一覧からツリーをバックグラウンドで再構築する。
+// 構築中に再度呼ばれた場合は先行の構築をキャンセルし、完了通知は最新の構築のみ行う。
+func (tw *TreeViewWidget) SetModelPaths(paths []string, onDone func(TreeBuildResult)) {
+	if tw == nil {
+		return
+	}
+	targets := append([]string{}, paths...)
+	if tw.model == nil {
+		tw.model = NewTreeModel()
+		if tw.treeView != nil {
+			if err := tw.treeView.SetModel(tw.model); err != nil {
+				notifyTreeBuildDone(onDone, TreeBuildResult{Paths: targets, Err: err})
+				return
+			}
+		}
+	}
+	tw.buildDone = onDone
+	ctx, seq := tw.beginBuild()
+	tw.showBuildProgress(true)
+	progress := newTreeBuildProgress()
+	go func() {
+		tw.loadScanIndex()
+		opts := tw.buildOptions()
+		roots, err := buildRoots(ctx, targets, opts, func(rootProgress scanner.Progress) {
+			logScanSummary(tw.logger, rootProgress)
+			total := progress.update(rootProgress)
+			tw.synchronize(func() {
+				if tw.isCurrentBuild(seq) {
+					tw.updateBuildProgress(total)
+				}
+			})
+		})
+		if saveErr := opts.index.Save(); saveErr != nil && tw.logger != nil {
+			tw.logger.Warn("走査インデックスの保存に失敗しました: %s", logging.FormatError(saveErr, tw.logger))
+		}
+		tw.synchronize(func() {
+			tw.finishBuild(ctx, seq, targets, roots, err, onDone)
+		})
+	}()
+}
+
+// RescanRoot は指定パスを含むルートの走査インデックスを破棄してツリーを再構築する。
+func (tw *TreeViewWidget) RescanRoot(path string) {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	rootPaths := append([]string{}, tw.model.rootPaths...)
+	if root := findRootPathOf(rootPaths, path); root != "" {
+		tw.loadScanIndex()
+		tw.buildOptions().index.InvalidateRoot(root)
+	}
+	tw.SetModelPaths(rootPaths, tw.buildDone)
+}
+
+// loadScanIndex は走査インデックスを初回のみ読み込む。
+func (tw *TreeViewWidget) loadScanIndex() {
+	tw.scanIndexOnce.Do(func() {
+		indexPath := resolveUserDataPath(scanIndexFileName)
+		if indexPath == "" {
+			return
+		}
+		index, err := scanner.LoadIndex(indexPath)
+		if err != nil && tw.logger != nil {
+			// 破損時は空のインデックスで作り直す。
+			tw.logger.Warn("走査インデックスを読み込めなかったため作り直します: %s", logging.FormatError(err, tw.logger))
+		}
+		tw.buildMu.Lock()
+		tw.scanIndex = index
+		tw.buildMu.Unlock()
+	})
+}
+
+// buildOptions は現在のツリー構築条件を返す。
+func (tw *TreeViewWidget) buildOptions() treeBuildOptions {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	return treeBuildOptions{
+		index:   tw.scanIndex,
+		lazy:    tw.lazyMode,
+		compact: tw.compactMode,
+		rules:   tw.scanRules,
+		order:   nodeOrder{mode: tw.sortMode, foldersFirst: tw.foldersFirst, modelName: tw.readModelName},
+		kinds:   tw.visibleKinds,
+		roots:   tw.rootOptions,
+		onPopulated: func(node *TreeNode) {
+			// 展開処理中の通知を避けるため、表示名と件数の反映は展開後に行う。
+			tw.synchronize(func() {
+				tw.model.filterPopulated(node)
+				tw.requestModelLabels(node.children)
+				tw.requestModelTags(node.children)
+				tw.requestModelMetadata(node.children)
+				tw.refreshModelCounts()
+			})
+		},
+		onEmptyDirs: func(parent *TreeNode, dirs []*TreeNode) {
+			tw.synchronize(func() {
+				tw.model.removeEmptyDirs(parent, dirs)
+				tw.refreshModelCounts()
+			})
+		},
+	}
+}
+
+// findRootPathOf は指定パスを含むルートパスを返す。
+func findRootPathOf(rootPaths []string, path string) string {
+	for _, root := range rootPaths {
+		if sameFilePath(root, path) {
+			return root
+		}
+		prefix := strings.TrimSuffix(root, string(os.PathSeparator)) + string(os.PathSeparator)
+		if len(path) > len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+			return root
+		}
+	}
+	return ""
+}
+
+// CancelBuild は実行中のツリー構築をキャンセルする。
+func (tw *TreeViewWidget) CancelBuild() {
+	if tw == nil {
+		return
+	}
+	tw.buildMu.Lock()
+	cancel := tw.buildCancel
+	tw.buildMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// beginBuild は先行の構築をキャンセルし、新しい構築の識別子を発行する。
+func (tw *TreeViewWidget) beginBuild() (context.Context, uint64) {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	if tw.buildCancel != nil {
+		tw.buildCancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tw.buildSeq++
+	tw.buildCancel = cancel
+	return ctx, tw.buildSeq
+}
+
+// endBuild は最新の構築であれば構築状態を解除してtrueを返す。
+func (tw *TreeViewWidget) endBuild(seq uint64) bool {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	if seq != tw.buildSeq {
+		return false
+	}
+	if tw.buildCancel != nil {
+		tw.buildCancel()
+		tw.buildCancel = nil
+	}
+	return true
+}
+
+// isCurrentBuild は指定の構築が最新か判定する。
+func (tw *TreeViewWidget) isCurrentBuild(seq uint64) bool {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	return seq == tw.buildSeq && tw.buildCancel != nil
+}
+
+// finishBuild は構築結果をツリーへ反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) finishBuild(ctx context.Context, seq uint64, paths []string, roots []*TreeNode, err error, onDone func(TreeBuildResult)) {
+	canceled := ctx.Err() != nil
+	if !tw.endBuild(seq) {
+		// 後続の構築に置き換えられたため結果を破棄する。
+		return
+	}
+	tw.showBuildProgress(false)
+	if canceled {
+		// キャンセル時は構築前のツリーを維持する。
+		notifyTreeBuildDone(onDone, TreeBuildResult{Paths: paths, RootCount: len(tw.model.roots), Canceled: true})
+		return
+	}
+	lazy := len(roots) > 0 && roots[0].loader != nil
+	// 差し替え前に数えて、初回の描画から件数を表示する。
+	tw.updateModelCounts(roots)
+	lazyChanged := tw.model.LazyPopulation() != lazy
+	if setErr := tw.model.SetRoots(roots, paths, lazy, tw.buildOptions()); setErr != nil {
+		notifyTreeBuildDone(onDone, TreeBuildResult{Paths: paths, Err: setErr})
+		return
+	}
+	if lazyChanged && tw.treeView != nil {
+		// 遅延読み込みの有無はモデル設定時に参照されるため再設定する。
+		if setErr := tw.treeView.SetModel(tw.model); setErr != nil {
+			notifyTreeBuildDone(onDone, TreeBuildResult{Paths: paths, Err: setErr})
+			return
+		}
+	}
+	tw.refreshModelLabels()
+	tw.refreshModelTags()
+	tw.refreshQueryMetadata()
+	// 全体の再描画でお気に入りの展開状態が失われるため作り直す。ブックマーク先の有無もここで確認し直す。
+	tw.refreshFavorites()
+	tw.refreshRecent()
+	// 構築後の変更は監視で差分反映する。
+	tw.restartWatchers(paths)
+	tw.updateLayout()
+	if tw.treeView != nil && len(tw.model.roots) > 0 {
+		if lazy {
+			// 遅延読み込み時は全展開で探索が走らないようルートのみ展開する。
+			tw.expandRootNodes()
+		} else {
+			// フォルダ読み込み直後は全展開して操作負荷を下げる。
+			tw.expandAllDirNodes()
+		}
+		tw.scrollToTop()
+	}
+	notifyTreeBuildDone(onDone, TreeBuildResult{Paths: paths, RootCount: len(tw.model.roots), Err: err})
+}
+
+// showBuildProgress は構築中表示の表示状態を切り替える。
+func (tw *TreeViewWidget) showBuildProgress(visible bool) {
+	if tw == nil || tw.progressComposite == nil {
+		return
+	}
+	if visible {
+		tw.updateBuildProgress(scanner.Progress{})
+	}
+	if tw.progressBar != nil {
+		if err := tw.progressBar.SetMarqueeMode(visible); err != nil && tw.logger != nil {
+			tw.logger.Warn("進捗表示の更新に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+	}
+	if tw.cancelButton != nil {
+		tw.cancelButton.SetEnabled(visible)
+	}
+	tw.progressComposite.SetVisible(visible)
+}
+
+// updateBuildProgress は構築中の進捗表示を更新する。
+func (tw *TreeViewWidget) updateBuildProgress(progress scanner.Progress) {
+	if tw == nil || tw.progressLabel == nil {
+		return
+	}
+	text := fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelTreeBuildProgress),
+		progress.Dirs, progress.Found, progress.Errors, progress.Excluded)
+	if err := tw.progressLabel.SetText(text); err != nil && tw.logger != nil {
+		tw.logger.Warn("進捗表示の更新に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+}
+
+// synchronize はUIスレッドで処理を実行する。
+func (tw *TreeViewWidget) synchronize(action func()) {
+	if tw == nil || action == nil {
+		return
+	}
+	if tw.treeView == nil {
+		action()
+		return
+	}
+	tw.treeView.Synchronize(action)
+}
+
+// notifyTreeBuildDone は構築完了を通知する。
+func notifyTreeBuildDone(onDone func(TreeBuildResult), result TreeBuildResult) {
+	if onDone == nil {
+		return
+	}
+	onDone(result)
+}
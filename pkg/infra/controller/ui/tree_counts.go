@@ -0,0 +1,114 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+)
+
+// partialCountSuffix は未探索のフォルダを含む件数に付ける印を表す。
+const partialCountSuffix = "+"
+
+// nodeCounts はフォルダ配下のモデル数とフォルダ数を表す。
+type nodeCounts struct {
+	models  int
+	folders int
+	// partial は未探索のフォルダを含み、件数が下限であるか。
+	partial bool
+}
+
+// formatCount は件数を表示用の文字列にする。未探索のフォルダを含む場合は印を付ける。
+func formatCount(count int, partial bool) string {
+	text := strconv.Itoa(count)
+	if partial {
+		return text + partialCountSuffix
+	}
+	return text
+}
+
+// countBadge はフォルダの表示名に付けるモデル数を返す。件数が分からない場合は空文字を返す。
+func (n *TreeNode) countBadge() string {
+	if n == nil || !n.isDir || (n.modelCount == 0 && n.countPartial) {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", formatCount(n.modelCount, n.countPartial))
+}
+
+// updateCounts は子孫を含めてフォルダのモデル数を数え直し、件数が変わったフォルダをchangedへ追加する。
+// 絞り込み中は表示対象のノードのみ数える。
+func (n *TreeNode) updateCounts(changed *[]*TreeNode) nodeCounts {
+	if n == nil {
+		return nodeCounts{}
+	}
+	if !n.isDir {
+		if n.kind == filetype.KindModel {
+			return nodeCounts{models: 1}
+		}
+		return nodeCounts{}
+	}
+	counts := nodeCounts{partial: n.isLazy()}
+	if !counts.partial {
+		for _, child := range n.visibleChildren() {
+			childCounts := child.updateCounts(changed)
+			counts.models += childCounts.models
+			counts.folders += childCounts.folders
+			counts.partial = counts.partial || childCounts.partial
+			if child.isDir {
+				counts.folders++
+			}
+		}
+	}
+	if n.modelCount != counts.models || n.countPartial != counts.partial {
+		n.modelCount = counts.models
+		n.countPartial = counts.partial
+		*changed = append(*changed, n)
+	}
+	return counts
+}
+
+// updateModelCounts はルートごとにモデル数を数え直し、ルートの表示名に集計を設定する。
+// 表示名が変わったノードを返す。
+func (tw *TreeViewWidget) updateModelCounts(roots []*TreeNode) []*TreeNode {
+	var changed []*TreeNode
+	format := i18n.TranslateOrMark(tw.translator, messages.LabelRootSummary)
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		counts := root.updateCounts(&changed)
+		summary := fmt.Sprintf(format, formatCount(counts.models, counts.partial), formatCount(counts.folders, counts.partial))
+		if root.summary != summary {
+			root.summary = summary
+			changed = append(changed, root)
+		}
+	}
+	return changed
+}
+
+// refreshModelCounts はツリー全体のモデル数を数え直して表示を更新する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshModelCounts() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	changed := tw.updateModelCounts(tw.model.roots)
+	// 固定表示のルートはルート集計を出さず、フォルダのモデル数のみ表示する。
+	for _, pinned := range tw.model.pinnedRoots() {
+		pinned.updateCounts(&changed)
+	}
+	published := map[*TreeNode]struct{}{}
+	for _, node := range changed {
+		if _, ok := published[node]; ok {
+			continue
+		}
+		published[node] = struct{}{}
+		tw.model.PublishItemChanged(node)
+	}
+}
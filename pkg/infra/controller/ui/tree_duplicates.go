@@ -0,0 +1,238 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+const (
+	// duplicatesLabelPrefix は重複ファイルのルートの表示名に付ける印を表す。
+	duplicatesLabelPrefix = "⧉ "
+	// duplicateHashLength は組の表示名に付ける内容ハッシュの桁数を表す。
+	duplicateHashLength = 8
+	// duplicateProgressStep は照合の進捗を表示に反映する間隔(件数)を表す。
+	duplicateProgressStep = 50
+)
+
+// setDuplicateUsecase は重複検出の処理を設定する。
+func (tw *TreeViewWidget) setDuplicateUsecase(usecase *minteractor.DuplicateUsecase) {
+	if tw == nil {
+		return
+	}
+	tw.duplicateUsecase = usecase
+}
+
+// formatByteSize はバイト数を単位付きの文字列に変換する。
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		value /= unit
+		if value < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// handleFindDuplicates は全ルートのモデルから重複ファイルを探す。探索中の場合は中止する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) handleFindDuplicates() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	if tw.duplicateCancel != nil {
+		tw.duplicateCancel()
+		return
+	}
+	if tw.duplicateUsecase == nil || len(tw.model.rootPaths) == 0 {
+		return
+	}
+	tw.duplicateSeq++
+	seq := tw.duplicateSeq
+	ctx, cancel := context.WithCancel(context.Background())
+	tw.duplicateCancel = cancel
+	tw.setDuplicateButtonRunning(true)
+
+	root := NewTreeNode(duplicatesLabelPrefix+i18n.TranslateOrMark(tw.translator, messages.LabelDuplicates), "", nil, true)
+	root.status = i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesScanning)
+	tw.model.SetDuplicates(root)
+
+	roots := append([]string{}, tw.model.rootPaths...)
+	opts := make([]treeBuildOptions, len(roots))
+	for i, path := range roots {
+		opts[i] = tw.scanOptionsFor(path)
+	}
+	go tw.findDuplicates(ctx, seq, root, roots, opts)
+}
+
+// findDuplicates はルート配下のモデルを探索し、重複ファイルを検出して反映する。
+func (tw *TreeViewWidget) findDuplicates(ctx context.Context, seq uint64, root *TreeNode, roots []string, opts []treeBuildOptions) {
+	var paths []string
+	for i, path := range roots {
+		found, err := collectModelPaths(ctx, path, opts[i], nil)
+		if ctx.Err() != nil {
+			tw.synchronize(func() {
+				tw.applyDuplicates(seq, root, nil, ctx.Err())
+			})
+			return
+		}
+		if err != nil && tw.logger != nil {
+			// 探索できなかったルートは飛ばして続ける。
+			tw.logger.Warn("重複検出の探索に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+		paths = append(paths, found...)
+	}
+	format := i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesHashing)
+	groups, err := tw.duplicateUsecase.Find(ctx, paths, func(progress minteractor.DuplicateProgress) {
+		if progress.Hashed%duplicateProgressStep != 0 && progress.Hashed != progress.Total {
+			return
+		}
+		status := fmt.Sprintf(format, progress.Hashed, progress.Total)
+		tw.synchronize(func() {
+			if seq != tw.duplicateSeq {
+				return
+			}
+			root.status = status
+			tw.model.PublishItemChanged(root)
+		})
+	})
+	tw.synchronize(func() {
+		tw.applyDuplicates(seq, root, groups, err)
+	})
+}
+
+// applyDuplicates は検出した重複ファイルの組を重複ファイルのルートへ反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyDuplicates(seq uint64, root *TreeNode, groups []minteractor.DuplicateGroup, err error) {
+	if tw == nil || tw.model == nil || seq != tw.duplicateSeq {
+		return
+	}
+	tw.duplicateCancel = nil
+	tw.setDuplicateButtonRunning(false)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			tw.model.SetDuplicates(nil)
+			return
+		}
+		tw.logger.Warn("重複検出に失敗しました: %s", logging.FormatError(err, tw.logger))
+		root.status = i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesFailed)
+		tw.model.PublishItemChanged(root)
+		return
+	}
+	root.status = ""
+	root.children = nil
+	var files []*TreeNode
+	var wasted int64
+	for _, group := range groups {
+		hash := group.Hash
+		if len(hash) > duplicateHashLength {
+			hash = hash[:duplicateHashLength]
+		}
+		groupNode := NewTreeNode(fmt.Sprintf("%s × %d  #%s", formatByteSize(group.Size), len(group.Paths), hash), "", root, true)
+		for _, path := range group.Paths {
+			// 同名のファイルが並ぶため、フルパスを表示名にする。
+			file := NewTreeNode(path, path, groupNode, false)
+			groupNode.addChild(file)
+			files = append(files, file)
+		}
+		root.addChild(groupNode)
+		wasted += group.Wasted()
+	}
+	if len(groups) == 0 {
+		root.status = i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesNone)
+	} else {
+		root.summary = fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesSummary), len(groups), formatByteSize(wasted))
+	}
+	var changed []*TreeNode
+	root.updateCounts(&changed)
+	tw.model.SetDuplicates(root)
+	if tw.treeView != nil {
+		_ = tw.treeView.SetExpanded(root, true)
+	}
+	tw.requestModelLabels(files)
+	tw.requestModelTags(files)
+}
+
+// setDuplicateButtonRunning は重複検出ボタンの表示を探索中・待機中に切り替える。
+func (tw *TreeViewWidget) setDuplicateButtonRunning(running bool) {
+	if tw.duplicateButton == nil {
+		return
+	}
+	key := messages.LabelDuplicatesFind
+	if running {
+		key = messages.LabelDuplicatesCancel
+	}
+	_ = tw.duplicateButton.SetText(i18n.TranslateOrMark(tw.translator, key))
+}
+
+// duplicateGroupOf は重複ファイルの組のノード、または組に含まれるファイルノードから組のノードを返す。
+func (tw *TreeViewWidget) duplicateGroupOf(node *TreeNode) *TreeNode {
+	if tw.model == nil || tw.model.duplicates == nil || node == nil {
+		return nil
+	}
+	if node.parent == tw.model.duplicates {
+		return node
+	}
+	if node.parent != nil && node.parent.parent == tw.model.duplicates {
+		return node.parent
+	}
+	return nil
+}
+
+// handleContextCopyGroup はコンテキストメニューの対象と同じ内容のファイルのパスを全てコピーする。
+func (tw *TreeViewWidget) handleContextCopyGroup() {
+	if tw == nil || tw.onCopyPath == nil {
+		return
+	}
+	group := tw.duplicateGroupOf(tw.contextNode)
+	if group == nil {
+		return
+	}
+	paths := make([]string, 0, len(group.children))
+	for _, child := range group.children {
+		paths = append(paths, child.fullPath)
+	}
+	tw.onCopyPath(strings.Join(paths, "\r\n"))
+}
+
+// handleContextOpenFolder はコンテキストメニューの対象のフォルダ(ファイルの場合は含むフォルダ)を開く。
+func (tw *TreeViewWidget) handleContextOpenFolder() {
+	if tw == nil || tw.contextPath == "" {
+		return
+	}
+	path := tw.contextPath
+	if archivePath, _, ok := archive.SplitPath(path); ok {
+		// 書庫内のファイルは書庫のあるフォルダを開く。
+		path = filepath.Dir(archivePath)
+	} else if !tw.contextIsDir {
+		path = filepath.Dir(path)
+	}
+	openWithShell(tw.logger, path)
+}
+
+// closeDuplicates は重複ファイルのルートを閉じる。探索中の場合は中止する。
+func (tw *TreeViewWidget) closeDuplicates() {
+	if tw.duplicateCancel != nil {
+		tw.duplicateCancel()
+		tw.duplicateCancel = nil
+		tw.setDuplicateButtonRunning(false)
+	}
+	tw.duplicateSeq++
+	tw.model.SetDuplicates(nil)
+}
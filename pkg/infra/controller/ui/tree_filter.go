@@ -0,0 +1,188 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import "github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+
+// nodeFilter はツリーに残すファイルノードを判定する。
+type nodeFilter func(node *TreeNode) bool
+
+// visibleChildren は絞り込み後に表示する子ノードを返す。絞り込みが無い場合は全ての子ノードを返す。
+func (n *TreeNode) visibleChildren() []*TreeNode {
+	if n == nil {
+		return nil
+	}
+	if n.filtered {
+		return n.shown
+	}
+	return n.children
+}
+
+// applyFilter はfilterに一致するファイルと、それを含むフォルダのみを表示対象にする。
+// 一致するノードを含むか返す。filterがnilの場合は絞り込みを解除する。
+func (n *TreeNode) applyFilter(filter nodeFilter) bool {
+	if n == nil {
+		return false
+	}
+	if !n.isDir {
+		if filter == nil {
+			n.match = nil
+			return true
+		}
+		return filter(n)
+	}
+	n.shown = nil
+	n.filtered = false
+	if filter == nil {
+		for _, child := range n.children {
+			child.applyFilter(nil)
+		}
+		return true
+	}
+	if n.isLazy() {
+		// 未探索のフォルダは展開時に判定する。
+		return true
+	}
+	shown := make([]*TreeNode, 0, len(n.children))
+	for _, child := range n.children {
+		if child.applyFilter(filter) {
+			shown = append(shown, child)
+		}
+	}
+	n.shown = shown
+	n.filtered = true
+	return len(shown) > 0
+}
+
+// SetFilter はツリーの絞り込み条件を設定して全体を再描画する。nilの場合は絞り込みを解除する。
+func (m *TreeModel) SetFilter(filter nodeFilter) {
+	if m == nil {
+		return
+	}
+	m.filter = filter
+	m.reapplyFilter()
+	m.PublishItemsReset(nil)
+}
+
+// reapplyFilter は現在の絞り込み条件をルート全体へ適用し直す。再描画は呼び出し側で行う。
+func (m *TreeModel) reapplyFilter() {
+	if m == nil {
+		return
+	}
+	m.shownRoots = nil
+	for _, root := range m.roots {
+		// 一致するモデルを含まないルートは表示しない。
+		if root.applyFilter(m.filter) && m.filter != nil {
+			m.shownRoots = append(m.shownRoots, root)
+		}
+	}
+}
+
+// visibleRoots は絞り込み後に表示するルートノードを返す。
+func (m *TreeModel) visibleRoots() []*TreeNode {
+	if m == nil {
+		return nil
+	}
+	if m.filter != nil {
+		return m.shownRoots
+	}
+	return m.roots
+}
+
+// isVisible は絞り込みで隠れていないノードか判定する。
+func (m *TreeModel) isVisible(node *TreeNode) bool {
+	if m == nil || node == nil {
+		return false
+	}
+	current := node
+	for ; current.parent != nil; current = current.parent {
+		if !containsNode(current.parent.visibleChildren(), current) {
+			return false
+		}
+	}
+	return containsNode(m.pinnedRoots(), current) || containsNode(m.visibleRoots(), current)
+}
+
+// containsNode はノード一覧に指定ノードが含まれるか判定する。
+func containsNode(nodes []*TreeNode, node *TreeNode) bool {
+	for _, current := range nodes {
+		if current == node {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPopulated は展開時に探索したフォルダへ絞り込み条件を適用し、配下を再描画する。UIスレッドで呼び出す。
+func (m *TreeModel) filterPopulated(node *TreeNode) {
+	if m == nil || m.filter == nil || node == nil || m.pinnedRootOf(node) != nil {
+		return
+	}
+	node.applyFilter(m.filter)
+	m.PublishItemsReset(node)
+}
+
+// currentFilter は選択中のタグと絞り込み文字列・クエリから絞り込み条件を返す。絞り込まない場合はnilを返す。
+// クエリで絞り込む場合、情報を読み込むまでのモデルは表示しない。
+func (tw *TreeViewWidget) currentFilter() nodeFilter {
+	tag := tw.tagFilter
+	matcher := tw.searchMatcher
+	query := tw.searchQuery
+	if tag == "" && matcher == nil && query == nil {
+		return nil
+	}
+	return func(node *TreeNode) bool {
+		node.match = nil
+		if tag != "" && !(minteractor.ModelTags{Tags: node.tags}).HasTag(tag) {
+			return false
+		}
+		if query != nil {
+			meta, ok := tw.queryMetadataOf(node, query)
+			if !ok || !query.Match(meta) {
+				return false
+			}
+		}
+		if matcher == nil {
+			return true
+		}
+		loc, ok := matcher.match(node)
+		node.match = loc
+		return ok
+	}
+}
+
+// refreshFilter は現在の絞り込み条件でツリーを再描画する。UIスレッドで呼び出す。
+// 絞り込み開始時の展開状態を記録し、絞り込み解除時に復元する。
+func (tw *TreeViewWidget) refreshFilter() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	filter := tw.currentFilter()
+	state := tw.captureViewState()
+	switch {
+	case tw.model.filter == nil && filter != nil:
+		saved := state
+		tw.preFilterState = &saved
+	case tw.model.filter != nil && filter == nil && tw.preFilterState != nil:
+		selected := state.selected
+		state = *tw.preFilterState
+		tw.preFilterState = nil
+		if selected != "" {
+			state.selected = selected
+		}
+	}
+	// 再描画後の選択の付け直しでモデルを読み込まないようにする。
+	tw.silentSelect = true
+	defer func() {
+		tw.silentSelect = false
+	}()
+	tw.model.SetFilter(filter)
+	tw.restoreViewState(state)
+	if filter != nil && !tw.model.LazyPopulation() {
+		// 絞り込み結果は全て見えるよう展開する。
+		tw.expandAllDirNodes()
+	}
+	tw.refreshModelCounts()
+}
@@ -0,0 +1,307 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"path/filepath"
+	"syscall"
+	"time"
+	"unicode/utf16"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+	"github.com/miu200521358/win"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+)
+
+const (
+	// recentLabelPrefix は最近見たモデルのルートの表示名に付ける印を表す。
+	recentLabelPrefix = "◷ "
+	// maxRecentModels は最近見たモデルとして保持する件数の上限を表す。
+	maxRecentModels = 20
+	// maxHistoryLength は戻る・進むの履歴として保持する件数の上限を表す。
+	maxHistoryLength = 100
+	// recentSaveDelay は最近見たモデルの一覧を保存するまでの待ち時間を表す。
+	recentSaveDelay = 2 * time.Second
+	// appCommandBrowserBackward はマウスの戻るボタン(ボタン4)によるWM_APPCOMMANDのコマンドを表す。
+	appCommandBrowserBackward = 1
+	// appCommandBrowserForward はマウスの進むボタン(ボタン5)によるWM_APPCOMMANDのコマンドを表す。
+	appCommandBrowserForward = 2
+	// appCommandDeviceMask はWM_APPCOMMANDのlParam上位語に含まれる入力機器の種別を表す。
+	appCommandDeviceMask = 0xF000
+)
+
+// recordViewed はツリーで選択したモデルを戻る・進むの履歴と最近見たモデルへ記録する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) recordViewed(node *TreeNode) {
+	if tw == nil || node == nil {
+		return
+	}
+	path := node.Path()
+	if !tw.navigating {
+		tw.pushHistory(path)
+	}
+	if tw.inRecent(node) {
+		// 最近見たモデルの中を移動している間は並びを変えない。
+		return
+	}
+	tw.rememberRecent(path)
+}
+
+// pushHistory は戻る・進むの履歴へパスを追加する。戻った位置から選択した場合は先の履歴を捨てる。
+func (tw *TreeViewWidget) pushHistory(path string) {
+	if len(tw.history) > 0 && sameFilePath(tw.history[tw.historyIndex], path) {
+		return
+	}
+	if len(tw.history) > 0 {
+		tw.history = tw.history[:tw.historyIndex+1]
+	}
+	tw.history = append(tw.history, path)
+	if len(tw.history) > maxHistoryLength {
+		tw.history = tw.history[len(tw.history)-maxHistoryLength:]
+	}
+	tw.historyIndex = len(tw.history) - 1
+}
+
+// rememberRecent は最近見たモデルの先頭へパスを移す。既に先頭の場合は何もしない。
+// 選択を続けて変える間に保存と作り直しを繰り返さないよう、ルートの作り直しと保存は操作が止まってから行う。
+func (tw *TreeViewWidget) rememberRecent(path string) {
+	if len(tw.recent) > 0 && sameFilePath(tw.recent[0], path) {
+		return
+	}
+	recent := make([]string, 0, len(tw.recent)+1)
+	recent = append(recent, path)
+	for _, current := range tw.recent {
+		if !sameFilePath(current, path) {
+			recent = append(recent, current)
+		}
+	}
+	if len(recent) > maxRecentModels {
+		recent = recent[:maxRecentModels]
+	}
+	tw.recent = recent
+	tw.recentSeq++
+	tw.recentPending = true
+	seq := tw.recentSeq
+	time.AfterFunc(recentSaveDelay, func() {
+		tw.synchronize(func() {
+			if seq != tw.recentSeq {
+				return
+			}
+			tw.flushRecent()
+			tw.refreshRecent()
+		})
+	})
+}
+
+// flushRecent は保存を待っている最近見たモデルの一覧を保存する。
+func (tw *TreeViewWidget) flushRecent() {
+	if !tw.recentPending {
+		return
+	}
+	tw.recentPending = false
+	tw.saveRecent()
+}
+
+// saveRecent は最近見たモデルの一覧を保存する。
+func (tw *TreeViewWidget) saveRecent() {
+	if err := saveConfigList(tw.userConfig, userConfigKeyRecentModels, tw.recent); err != nil && tw.logger != nil {
+		tw.logger.Warn("最近見たモデルの保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+}
+
+// refreshRecent は最近見たモデルのルートを作り直す。一覧が空の場合はルートを表示しない。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshRecent() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	if len(tw.recent) == 0 {
+		tw.model.SetRecent(nil)
+		return
+	}
+	if tw.recentRoot == nil {
+		tw.recentRoot = NewTreeNode(recentLabelPrefix+i18n.TranslateOrMark(tw.translator, messages.LabelRecent), "", nil, true)
+	}
+	root := tw.recentRoot
+	root.children = root.children[:0]
+	missingLabel := i18n.TranslateOrMark(tw.translator, messages.LabelBookmarkMissing)
+	for _, path := range tw.recent {
+		node := NewTreeNode(filepath.Base(path), path, root, false)
+		if !archive.Exists(path) {
+			node.status = missingLabel
+		}
+		root.addChild(node)
+	}
+	var changed []*TreeNode
+	root.updateCounts(&changed)
+	tw.model.SetRecent(root)
+	if tw.treeView != nil {
+		_ = tw.treeView.SetExpanded(root, true)
+	}
+	tw.requestModelLabels(root.children)
+	tw.requestModelTags(root.children)
+}
+
+// inRecent はノードが最近見たモデルのルート配下にあるか判定する。
+func (tw *TreeViewWidget) inRecent(node *TreeNode) bool {
+	return tw.model != nil && tw.model.recent != nil && tw.model.pinnedRootOf(node) == tw.model.recent
+}
+
+// handleContextForgetRecent はコンテキストメニューの対象を最近見たモデルから外す。ルートの場合は全て外す。
+func (tw *TreeViewWidget) handleContextForgetRecent() {
+	if tw == nil || !tw.inRecent(tw.contextNode) {
+		return
+	}
+	if tw.contextNode == tw.model.recent {
+		tw.recent = nil
+	} else {
+		recent := make([]string, 0, len(tw.recent))
+		for _, path := range tw.recent {
+			if !sameFilePath(path, tw.contextNode.fullPath) {
+				recent = append(recent, path)
+			}
+		}
+		tw.recent = recent
+	}
+	tw.recentSeq++
+	tw.recentPending = false
+	tw.saveRecent()
+	tw.refreshRecent()
+}
+
+// navigateHistory は戻る・進むの履歴を移動し、移動先のモデルを選択して読み込む。deltaが負の場合は戻る。
+func (tw *TreeViewWidget) navigateHistory(delta int) {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	index := tw.historyIndex + delta
+	if index < 0 || index >= len(tw.history) {
+		return
+	}
+	tw.historyIndex = index
+	tw.navigating = true
+	defer func() {
+		tw.navigating = false
+	}()
+	path := tw.history[index]
+	node := tw.locateFileNode(path)
+	if node == nil {
+		// 絞り込みなどでツリーに表示されていないモデルは、選択を変えずに読み込む。
+		if tw.onFileSelected != nil {
+			tw.onFileSelected(path)
+		}
+		tw.rememberRecent(path)
+		return
+	}
+	if current, ok := tw.treeView.CurrentItem().(*TreeNode); ok && current == node {
+		// 選択中のノードは選択変更が通知されないため、直接読み込む。
+		tw.handleCurrentItemChanged()
+		return
+	}
+	tw.lastSelected = path
+	tw.selectFileNode(node)
+}
+
+// locateFileNode は表示中のルートから指定パスのファイルノードを探す。遅延読み込み時は経路上のフォルダを探索する。
+func (tw *TreeViewWidget) locateFileNode(path string) *TreeNode {
+	for _, root := range tw.model.visibleRoots() {
+		node := root
+		for node != nil && node.IsDir() {
+			if findRootPathOf([]string{node.fullPath}, path) == "" {
+				node = nil
+				break
+			}
+			node.ensurePopulated()
+			var next *TreeNode
+			for _, child := range node.children {
+				if sameFilePath(child.fullPath, path) || (child.IsDir() && findRootPathOf([]string{child.fullPath}, path) != "") {
+					next = child
+					break
+				}
+			}
+			node = next
+		}
+		if node != nil && sameFilePath(node.fullPath, path) && tw.model.isVisible(node) {
+			return node
+		}
+	}
+	return nil
+}
+
+// installNavigationHook はツリービューとメインウィンドウのウィンドウプロシージャを差し替える。
+// ツリービューではAlt+←/→と文字入力による選択を、メインウィンドウではマウスの戻る・進むボタンを受け付ける。
+// 初回のみ差し替え、ツリービューの破棄時に元へ戻す。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) installNavigationHook() {
+	if tw == nil || tw.treeView == nil || tw.origWndProc != 0 {
+		return
+	}
+	hwnd := tw.treeView.Handle()
+	if hwnd == 0 {
+		return
+	}
+	tw.navigationProc = syscall.NewCallback(tw.navigationWndProc)
+	tw.origWndProc = win.SetWindowLongPtr(hwnd, win.GWLP_WNDPROC, tw.navigationProc)
+	// マウスの戻る・進むボタンは、子ウィンドウの既定処理によりWM_APPCOMMANDとして親へ伝わる。
+	if mainWindow := win.GetAncestor(hwnd, win.GA_ROOT); mainWindow != 0 && mainWindow != hwnd {
+		tw.mainWindow = mainWindow
+		tw.mainWindowProc = syscall.NewCallback(tw.mainWindowWndProc)
+		tw.origMainWndProc = win.SetWindowLongPtr(mainWindow, win.GWLP_WNDPROC, tw.mainWindowProc)
+	}
+	tw.treeView.Disposing().Attach(func() {
+		tw.uninstallNavigationHook(hwnd)
+	})
+}
+
+// uninstallNavigationHook は差し替えたウィンドウプロシージャを元に戻し、保存を待っている最近見たモデルを保存する。
+// 後から別の差し替えが行われている場合は、その差し替えを壊さないよう戻さない。
+func (tw *TreeViewWidget) uninstallNavigationHook(hwnd win.HWND) {
+	if tw.origWndProc != 0 && win.GetWindowLongPtr(hwnd, win.GWLP_WNDPROC) == tw.navigationProc {
+		win.SetWindowLongPtr(hwnd, win.GWLP_WNDPROC, tw.origWndProc)
+	}
+	if tw.origMainWndProc != 0 && win.GetWindowLongPtr(tw.mainWindow, win.GWLP_WNDPROC) == tw.mainWindowProc {
+		win.SetWindowLongPtr(tw.mainWindow, win.GWLP_WNDPROC, tw.origMainWndProc)
+	}
+	tw.origMainWndProc = 0
+	tw.mainWindow = 0
+	tw.recentSeq++
+	tw.flushRecent()
+}
+
+// navigationWndProc はAlt+←/→による戻る・進むの操作と文字入力による選択を処理し、それ以外は元のウィンドウプロシージャへ渡す。
+func (tw *TreeViewWidget) navigationWndProc(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	switch msg {
+	case win.WM_SYSKEYDOWN:
+		switch wParam {
+		case win.VK_LEFT:
+			tw.navigateHistory(-1)
+			return 0
+		case win.VK_RIGHT:
+			tw.navigateHistory(1)
+			return 0
+		}
+	case win.WM_CHAR:
+		// 標準のインクリメンタル検索はフォルダも選択するため、モデルのみを対象に検索し直す。
+		if char := rune(wParam); char >= ' ' && !utf16.IsSurrogate(char) && tw.handleTypeAhead(char) {
+			return 0
+		}
+	}
+	return win.CallWindowProc(tw.origWndProc, hwnd, msg, wParam, lParam)
+}
+
+// mainWindowWndProc はメインウィンドウ内のどこで押されたマウスの戻る・進むボタンも処理し、それ以外は元のウィンドウプロシージャへ渡す。
+func (tw *TreeViewWidget) mainWindowWndProc(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	if msg == win.WM_APPCOMMAND {
+		switch win.HIWORD(uint32(lParam)) &^ appCommandDeviceMask {
+		case appCommandBrowserBackward:
+			tw.navigateHistory(-1)
+			return 1
+		case appCommandBrowserForward:
+			tw.navigateHistory(1)
+			return 1
+		}
+	}
+	return win.CallWindowProc(tw.origMainWndProc, hwnd, msg, wParam, lParam)
+}
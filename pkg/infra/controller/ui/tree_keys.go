@@ -0,0 +1,176 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miu200521358/walk/pkg/walk"
+	"github.com/miu200521358/win"
+)
+
+const (
+	// modelPageSize はPage Up/Page Downで移動するモデルの件数を表す。
+	modelPageSize = 10
+	// typeAheadTimeout は入力した文字を続けて検索に使う間隔を表す。
+	typeAheadTimeout = time.Second
+	// adjacentModelSearchLimit は先読みする前後のモデルを探す際に、表示順でたどるファイルの件数の上限を表す。
+	adjacentModelSearchLimit = 50
+)
+
+// selectionMove はキー操作によるモデル選択の移動を表す。
+type selectionMove struct {
+	// delta は表示順で進める件数。負の場合は戻る。
+	delta int
+	// edge は先頭(deltaが負)・末尾(deltaが正)のモデルへ移動するか表す。
+	edge bool
+	// folder は前後のフォルダの先頭のモデルへ移動するか表す。
+	folder bool
+}
+
+// selectionMoveOf はキーに対応するモデル選択の移動を返す。移動に使わないキーの場合はfalseを返す。
+func selectionMoveOf(key walk.Key, ctrl bool) (selectionMove, bool) {
+	switch key {
+	case walk.KeyDown:
+		return selectionMove{delta: 1, folder: ctrl}, true
+	case walk.KeyUp:
+		return selectionMove{delta: -1, folder: ctrl}, true
+	case walk.KeyNext:
+		return selectionMove{delta: modelPageSize}, true
+	case walk.KeyPrior:
+		return selectionMove{delta: -modelPageSize}, true
+	case walk.KeyEnd:
+		return selectionMove{delta: 1, edge: true}, true
+	case walk.KeyHome:
+		return selectionMove{delta: -1, edge: true}, true
+	}
+	return selectionMove{}, false
+}
+
+// targetIndex は表示順のモデル一覧での移動先の位置を返す。currentが負の場合は未選択として扱う。
+// 端に達した場合はそこで止める。
+func (m selectionMove) targetIndex(nodes []*TreeNode, current int) int {
+	last := len(nodes) - 1
+	switch {
+	case m.edge:
+		if m.delta < 0 {
+			return 0
+		}
+		return last
+	case current < 0:
+		if m.delta < 0 {
+			return last
+		}
+		return 0
+	case m.folder:
+		return folderStartIndex(nodes, current, m.delta >= 0)
+	}
+	return min(max(current+m.delta, 0), last)
+}
+
+// folderStartIndex は表示順のモデル一覧で、前後のフォルダの先頭のモデルの位置を返す。
+// 該当するフォルダが無い場合はcurrentを返す。
+func folderStartIndex(nodes []*TreeNode, current int, forward bool) int {
+	parent := nodes[current].parent
+	if forward {
+		for i := current + 1; i < len(nodes); i++ {
+			if nodes[i].parent != parent {
+				return i
+			}
+		}
+		return current
+	}
+	start := current
+	for start > 0 && nodes[start-1].parent == parent {
+		start--
+	}
+	if start == 0 {
+		return current
+	}
+	previous := start - 1
+	for previous > 0 && nodes[previous-1].parent == nodes[start-1].parent {
+		previous--
+	}
+	return previous
+}
+
+// isAncestorNode はancestorがnodeの祖先か判定する。
+func isAncestorNode(ancestor *TreeNode, node *TreeNode) bool {
+	for current := node.parent; current != nil; current = current.parent {
+		if current == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTypeAhead は入力した文字で名前が始まるモデルへ選択を移す。続けて入力した文字は前の文字に続けて検索し、
+// 同じ文字を続けて入力した場合はその文字で始まる次のモデルへ順に移す。一致するモデルが無い場合は入力を捨てて警告音を鳴らす。
+// 処理した場合はtrueを返す。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) handleTypeAhead(char rune) bool {
+	if tw == nil || tw.treeView == nil || tw.model == nil {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(tw.typeAheadAt) > typeAheadTimeout {
+		tw.typeAhead = ""
+	}
+	if char == ' ' && tw.typeAhead == "" {
+		return false
+	}
+	tw.typeAheadAt = now
+	tw.typeAhead += strings.ToLower(string(char))
+	prefix, cycle := typeAheadPrefix(tw.typeAhead)
+
+	roots := tw.model.visibleRoots()
+	current, _ := tw.treeView.CurrentItem().(*TreeNode)
+	if pinned := tw.model.pinnedRootOf(current); pinned != nil {
+		// 固定表示のルート内ではそのルート内で探す。
+		roots = []*TreeNode{pinned}
+	}
+	nodes := collectFileNodes(roots)
+	start := 0
+	for i, node := range nodes {
+		if node == current {
+			start = i
+			// 1文字目と同じ文字の連打では次のモデルから探し、一致するモデルを順に移動させる。
+			if cycle {
+				start = i + 1
+			}
+			break
+		}
+	}
+	for offset := 0; offset < len(nodes); offset++ {
+		node := nodes[(start+offset)%len(nodes)]
+		if node.matchesTypeAhead(prefix) {
+			if node != current {
+				tw.selectFileNode(node)
+			}
+			return true
+		}
+	}
+	tw.typeAhead = ""
+	win.MessageBeep(win.MB_OK)
+	return true
+}
+
+// typeAheadPrefix は入力中の文字列から検索に使う先頭文字列を返す。
+// 同じ文字だけが続く場合はその1文字を返し、次の一致へ移ることを表すtrueを返す。
+func typeAheadPrefix(buffer string) (string, bool) {
+	chars := []rune(buffer)
+	for _, char := range chars[1:] {
+		if char != chars[0] {
+			return buffer, false
+		}
+	}
+	return string(chars[0]), true
+}
+
+// matchesTypeAhead はファイル名またはモデル名が指定の文字で始まるか判定する。prefixは小文字で渡す。
+func (n *TreeNode) matchesTypeAhead(prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(n.name), prefix) ||
+		(n.label != "" && strings.HasPrefix(strings.ToLower(n.label), prefix))
+}
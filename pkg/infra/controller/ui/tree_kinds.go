@@ -0,0 +1,188 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"os/exec"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+)
+
+const (
+	// shell32IconFolder はshell32.dllのフォルダアイコン番号を表す。
+	shell32IconFolder = 3
+	// shell32IconDocument はshell32.dllの汎用文書アイコン番号を表す。
+	shell32IconDocument = 0
+)
+
+// kindIconIndexes はノード種別ごとのshell32.dllのアイコン番号を表す。
+var kindIconIndexes = map[filetype.Kind]int{
+	filetype.KindModel:     2,
+	filetype.KindAccessory: 12,
+	filetype.KindMotion:    115,
+	filetype.KindPose:      116,
+	filetype.KindImage:     325,
+	filetype.KindReadme:    70,
+}
+
+// shellIcons は読み込み済みのshell32.dllのアイコンを表す。UIスレッドからのみ参照する。
+var shellIcons = map[int]*walk.Icon{}
+
+// nodeAction はノード種別ごとのコンテキストメニュー項目を表す。
+type nodeAction struct {
+	textKey string
+	run     func(path string)
+}
+
+// kindHandler はノード種別ごとの選択・実行時の処理とメニュー項目を表す。
+type kindHandler struct {
+	// onSelect はノード選択時の処理。nilの場合は何もしない。
+	onSelect func(path string)
+	// onActivate はダブルクリック・Enter時の処理。nilの場合は何もしない。
+	onActivate func(path string)
+	actions    []nodeAction
+}
+
+// folderIcon はフォルダのアイコンを返す。
+func folderIcon() interface{} {
+	return loadShellIcon(shell32IconFolder)
+}
+
+// kindIcon はノード種別のアイコンを返す。
+func kindIcon(kind filetype.Kind) interface{} {
+	index, ok := kindIconIndexes[kind]
+	if !ok {
+		index = shell32IconDocument
+	}
+	return loadShellIcon(index)
+}
+
+// loadShellIcon はshell32.dllのアイコンを読み込んで再利用する。読み込めない場合はアイコン無しとする。
+func loadShellIcon(index int) interface{} {
+	if icon, ok := shellIcons[index]; ok {
+		if icon == nil {
+			return nil
+		}
+		return icon
+	}
+	icon, err := walk.NewIconFromSysDLL("shell32", index)
+	if err != nil {
+		icon = nil
+	}
+	shellIcons[index] = icon
+	if icon == nil {
+		return nil
+	}
+	return icon
+}
+
+// registerKindHandler はノード種別の処理を登録する。登録済みの種別は上書きする。
+func (tw *TreeViewWidget) registerKindHandler(kind filetype.Kind, handler kindHandler) {
+	if tw == nil || kind == filetype.KindUnknown {
+		return
+	}
+	if tw.kindHandlers == nil {
+		tw.kindHandlers = map[filetype.Kind]kindHandler{}
+	}
+	tw.kindHandlers[kind] = handler
+}
+
+// handleItemActivated はノードのダブルクリック・Enter時の処理を行う。
+func (tw *TreeViewWidget) handleItemActivated() {
+	if tw == nil || tw.treeView == nil {
+		return
+	}
+	node, ok := tw.treeView.CurrentItem().(*TreeNode)
+	if !ok || node == nil || node.IsDir() {
+		return
+	}
+	if handler, ok := tw.kindHandlers[node.Kind()]; ok && handler.onActivate != nil {
+		handler.onActivate(node.Path())
+	}
+}
+
+// selectNodeKind はノード種別の選択時処理を呼び出す。
+func (tw *TreeViewWidget) selectNodeKind(node *TreeNode) {
+	if handler, ok := tw.kindHandlers[node.Kind()]; ok && handler.onSelect != nil {
+		handler.onSelect(node.Path())
+	}
+}
+
+// updateKindActions はノード種別に応じたコンテキストメニュー項目を差し替える。
+func (tw *TreeViewWidget) updateKindActions(kind filetype.Kind) {
+	if tw == nil || tw.treeView == nil || tw.treeView.ContextMenu() == nil {
+		return
+	}
+	actions := tw.treeView.ContextMenu().Actions()
+	for _, action := range tw.kindActions {
+		if err := actions.Remove(action); err != nil && tw.logger != nil {
+			tw.logger.Warn("メニュー項目の削除に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+	}
+	tw.kindActions = nil
+
+	handler, ok := tw.kindHandlers[kind]
+	if !ok || len(handler.actions) == 0 {
+		return
+	}
+	separator := walk.NewSeparatorAction()
+	if err := actions.Add(separator); err == nil {
+		tw.kindActions = append(tw.kindActions, separator)
+	}
+	for _, nodeAction := range handler.actions {
+		run := nodeAction.run
+		action := walk.NewAction()
+		if err := action.SetText(i18n.TranslateOrMark(tw.translator, nodeAction.textKey)); err != nil && tw.logger != nil {
+			tw.logger.Warn("メニュー項目の設定に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+		action.Triggered().Attach(func() {
+			if run != nil && tw.contextPath != "" {
+				run(tw.contextPath)
+			}
+		})
+		if err := actions.Add(action); err != nil {
+			if tw.logger != nil {
+				tw.logger.Warn("メニュー項目の追加に失敗しました: %s", logging.FormatError(err, tw.logger))
+			}
+			continue
+		}
+		tw.kindActions = append(tw.kindActions, action)
+	}
+}
+
+// openWithShell は関連付けられたアプリケーションでファイルを開く。
+func openWithShell(logger logging.ILogger, path string) {
+	if path == "" {
+		return
+	}
+	if err := exec.Command("explorer.exe", path).Start(); err != nil && logger != nil {
+		logger.Warn("ファイルを開けませんでした: %s", logging.FormatError(err, logger))
+	}
+}
+
+// kindLabelKey はノード種別の表示名のキーを返す。
+func kindLabelKey(kind filetype.Kind) string {
+	switch kind {
+	case filetype.KindModel:
+		return messages.LabelKindModel
+	case filetype.KindAccessory:
+		return messages.LabelKindAccessory
+	case filetype.KindMotion:
+		return messages.LabelKindMotion
+	case filetype.KindPose:
+		return messages.LabelKindPose
+	case filetype.KindImage:
+		return messages.LabelKindImage
+	case filetype.KindReadme:
+		return messages.LabelKindReadme
+	default:
+		return string(kind)
+	}
+}
@@ -0,0 +1,330 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+const (
+	// modelLabelWorkers はモデル名を並列に読み込むワーカー数を表す。
+	modelLabelWorkers = 4
+	// modelLabelBatchSize はモデル名をツリーへまとめて反映する件数を表す。
+	modelLabelBatchSize = 200
+)
+
+// labelMode はファイルノードの表示名の種類を表す。
+type labelMode string
+
+const (
+	// labelByFileName はファイル名を表示する。
+	labelByFileName labelMode = "file"
+	// labelByModelName はモデル名(日本語)を表示する。
+	labelByModelName labelMode = "model"
+	// labelByEnglishName はモデル名(英語)を表示する。英語名が空の場合は日本語名を表示する。
+	labelByEnglishName labelMode = "model_en"
+)
+
+// labelModes は選択できる表示名を表示順で返す。
+func labelModes() []labelMode {
+	return []labelMode{labelByFileName, labelByModelName, labelByEnglishName}
+}
+
+// parseLabelMode は設定値を表示名の種類に変換する。不明な値はファイル名とする。
+func parseLabelMode(value string) labelMode {
+	for _, mode := range labelModes() {
+		if string(mode) == value {
+			return mode
+		}
+	}
+	return labelByFileName
+}
+
+// labelModeLabelKey は表示名の種類の表示名のキーを返す。
+func labelModeLabelKey(mode labelMode) string {
+	switch mode {
+	case labelByModelName:
+		return messages.LabelNodeLabelModel
+	case labelByEnglishName:
+		return messages.LabelNodeLabelEnglish
+	default:
+		return messages.LabelNodeLabelFile
+	}
+}
+
+// pick は表示名の種類に応じたモデル名を返す。
+func (mode labelMode) pick(names minteractor.ModelNames) string {
+	switch mode {
+	case labelByModelName:
+		return strings.TrimSpace(names.Name)
+	case labelByEnglishName:
+		if english := strings.TrimSpace(names.EnglishName); english != "" {
+			return english
+		}
+		return strings.TrimSpace(names.Name)
+	default:
+		return ""
+	}
+}
+
+// cachedModelNames は読み込み済みのモデル名と、読み込み時のファイルの状態を表す。
+type cachedModelNames struct {
+	names   minteractor.ModelNames
+	modTime int64
+	size    int64
+}
+
+// modelNameCache はファイルの更新日時とサイズが変わらない間、モデル名を保持する。
+type modelNameCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedModelNames
+}
+
+// newModelNameCache はmodelNameCacheを生成する。
+func newModelNameCache() *modelNameCache {
+	return &modelNameCache{entries: map[string]cachedModelNames{}}
+}
+
+// peek はファイルを確認せずにキャッシュ済みのモデル名を返す。
+func (c *modelNameCache) peek(path string) (minteractor.ModelNames, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[strings.ToLower(path)]
+	return cached.names, ok
+}
+
+// load はモデル名を返す。キャッシュが古い場合はreaderで読み直す。
+func (c *modelNameCache) load(path string, reader func(path string) (minteractor.ModelNames, error)) (minteractor.ModelNames, error) {
+	info, err := archive.Stat(path)
+	if err != nil {
+		return minteractor.ModelNames{}, err
+	}
+	key := strings.ToLower(path)
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && cached.modTime == info.ModTime().UnixNano() && cached.size == info.Size() {
+		return cached.names, nil
+	}
+	names, err := reader(path)
+	if err != nil {
+		// 読めないファイルも記録し、表示の度に読み直さない。
+		names = minteractor.ModelNames{}
+	}
+	c.mu.Lock()
+	c.entries[key] = cachedModelNames{names: names, modTime: info.ModTime().UnixNano(), size: info.Size()}
+	c.mu.Unlock()
+	return names, err
+}
+
+// modelLabelResult はバックグラウンドで読み込んだモデル名を表す。
+type modelLabelResult struct {
+	node  *TreeNode
+	names minteractor.ModelNames
+}
+
+// lookupModelNames はモデル名をキャッシュ経由で返す。構築中のワーカーからも呼ばれる。
+func (tw *TreeViewWidget) lookupModelNames(path string) (minteractor.ModelNames, bool) {
+	tw.buildMu.Lock()
+	reader := tw.modelNameReader
+	tw.buildMu.Unlock()
+	if reader == nil || !isModelFile(path) {
+		return minteractor.ModelNames{}, false
+	}
+	names, err := tw.modelNames.load(path, reader)
+	return names, err == nil
+}
+
+// currentLabelMode は現在の表示名の種類を返す。
+func (tw *TreeViewWidget) currentLabelMode() labelMode {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	return tw.labelMode
+}
+
+// refreshModelLabels はツリー全体のファイルノードの表示名を現在の設定で更新する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshModelLabels() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	tw.labelSeq++
+	var nodes []*TreeNode
+	stack := append([]*TreeNode{}, tw.model.roots...)
+	for len(stack) > 0 {
+		last := len(stack) - 1
+		node := stack[last]
+		stack = stack[:last]
+		if node == nil {
+			continue
+		}
+		if node.IsDir() {
+			// 未探索のフォルダは展開時に表示名を読み込む。
+			if !node.isLazy() {
+				stack = append(stack, node.children...)
+			}
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	tw.requestModelLabels(nodes)
+}
+
+// requestModelLabels は指定ノードの表示名を設定する。未読み込みのモデル名はバックグラウンドで読み込む。
+// UIスレッドで呼び出す。
+func (tw *TreeViewWidget) requestModelLabels(nodes []*TreeNode) {
+	if tw == nil || tw.model == nil || len(nodes) == 0 {
+		return
+	}
+	mode := tw.currentLabelMode()
+	var pending []*TreeNode
+	changed := false
+	for _, node := range nodes {
+		if node == nil || node.Kind() != filetype.KindModel {
+			continue
+		}
+		label := ""
+		if mode != labelByFileName {
+			names, ok := tw.modelNames.peek(node.fullPath)
+			if !ok {
+				pending = append(pending, node)
+				continue
+			}
+			label = mode.pick(names)
+		}
+		if node.label != label {
+			node.label = label
+			changed = true
+			tw.model.PublishItemChanged(node)
+		}
+	}
+	if changed && tw.searchMatcher != nil {
+		tw.refreshFilter()
+	}
+	if len(pending) == 0 {
+		return
+	}
+	seq := tw.labelSeq
+	go tw.loadModelLabels(seq, mode, pending)
+}
+
+// loadModelLabels はモデル名をバックグラウンドで読み込み、一定件数ごとにツリーへ反映する。
+func (tw *TreeViewWidget) loadModelLabels(seq uint64, mode labelMode, nodes []*TreeNode) {
+	jobs := make(chan *TreeNode)
+	results := make(chan modelLabelResult, modelLabelBatchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < modelLabelWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range jobs {
+				names, _ := tw.lookupModelNames(node.fullPath)
+				results <- modelLabelResult{node: node, names: names}
+			}
+		}()
+	}
+	go func() {
+		for _, node := range nodes {
+			jobs <- node
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	batch := make([]modelLabelResult, 0, modelLabelBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		applied := batch
+		batch = make([]modelLabelResult, 0, modelLabelBatchSize)
+		tw.synchronize(func() {
+			tw.applyModelLabels(seq, mode, applied)
+		})
+	}
+	for result := range results {
+		batch = append(batch, result)
+		if len(batch) >= modelLabelBatchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// applyModelLabels は読み込んだモデル名をノードの表示名に反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyModelLabels(seq uint64, mode labelMode, results []modelLabelResult) {
+	if tw == nil || tw.model == nil || seq != tw.labelSeq {
+		// 表示名の設定やツリーが切り替わった後の結果は破棄する。
+		return
+	}
+	changed := false
+	for _, result := range results {
+		label := mode.pick(result.names)
+		if result.node.label == label {
+			continue
+		}
+		result.node.label = label
+		changed = true
+		tw.model.PublishItemChanged(result.node)
+	}
+	if changed && tw.searchMatcher != nil {
+		// 絞り込み文字列はモデル名とも照合するため絞り込み直す。
+		tw.refreshFilter()
+	}
+}
+
+// labelModeLabels は表示名の選択肢の表示名を返す。
+func (tw *TreeViewWidget) labelModeLabels() []string {
+	modes := labelModes()
+	labels := make([]string, len(modes))
+	for i, mode := range modes {
+		labels[i] = i18n.TranslateOrMark(tw.translator, labelModeLabelKey(mode))
+	}
+	return labels
+}
+
+// labelModeIndex は現在の表示名の選択肢の位置を返す。
+func (tw *TreeViewWidget) labelModeIndex() int {
+	mode := tw.currentLabelMode()
+	for i, candidate := range labelModes() {
+		if candidate == mode {
+			return i
+		}
+	}
+	return 0
+}
+
+// handleLabelModeChanged は表示名の変更を保存してファイルノードの表示名を更新する。
+func (tw *TreeViewWidget) handleLabelModeChanged() {
+	if tw == nil || tw.labelCombo == nil {
+		return
+	}
+	index := tw.labelCombo.CurrentIndex()
+	modes := labelModes()
+	if index < 0 || index >= len(modes) {
+		return
+	}
+	mode := modes[index]
+	tw.buildMu.Lock()
+	changed := tw.labelMode != mode
+	tw.labelMode = mode
+	tw.buildMu.Unlock()
+	if !changed {
+		return
+	}
+	if err := saveConfigString(tw.userConfig, userConfigKeyTreeLabelMode, string(mode)); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.refreshModelLabels()
+}
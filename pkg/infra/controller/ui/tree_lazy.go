@@ -0,0 +1,289 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+// lazyLoader は遅延読み込みモードでディレクトリの子ノードを探索する。
+type lazyLoader struct {
+	opts treeBuildOptions
+}
+
+// newLazyRootNode は配下を探索せずにルートノードを生成する。モデルが無い場合はnilを返す。
+func newLazyRootNode(ctx context.Context, rootPath string, opts treeBuildOptions) (*TreeNode, error) {
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() || !scanner.ContainsMatch(ctx, rootPath, opts.dirOptions()) {
+		return nil, ctx.Err()
+	}
+	rootNode := newRootNode(rootPath, opts.aliasFor(rootPath))
+	rootNode.loader = &lazyLoader{opts: opts}
+	rootNode.filter = opts.filter
+	return rootNode, nil
+}
+
+// isLazy は子ノードが未探索か判定する。
+func (n *TreeNode) isLazy() bool {
+	return n != nil && n.loader != nil && !n.populated
+}
+
+// ensurePopulated は未探索のディレクトリ直下を探索して子ノードを生成する。
+func (n *TreeNode) ensurePopulated() {
+	if !n.isLazy() {
+		return
+	}
+	n.populated = true
+	n.loader.populate(n)
+}
+
+// populate はディレクトリ直下の表示対象ファイルとサブディレクトリを子ノードにする。
+// サブディレクトリは展開可能として先に追加し、対象ファイルを含むかはバックグラウンドで確かめる。
+func (l *lazyLoader) populate(node *TreeNode) {
+	dirOpts := l.opts.dirOptions()
+	files, subDirs, _ := scanner.ReadDir(node.fullPath, dirOpts)
+	probes := make([]*TreeNode, 0, len(subDirs))
+	for _, name := range subDirs {
+		path := filepath.Join(node.fullPath, name)
+		if l.opts.onEmptyDirs == nil && !scanner.ContainsMatch(context.Background(), path, dirOpts) {
+			// 通知先が無い場合はその場で確かめる。
+			continue
+		}
+		child := NewTreeNode(name, path, node, true)
+		child.link = l.opts.filter.IsLink(path)
+		child.loader = l
+		node.addChild(child)
+		probes = append(probes, child)
+	}
+	for _, name := range files {
+		node.addChild(NewTreeNode(name, filepath.Join(node.fullPath, name), node, false))
+	}
+	node.sortOwnChildren(l.opts.order)
+	if l.opts.onEmptyDirs != nil && len(probes) > 0 {
+		go l.probeDirs(node, probes, dirOpts)
+	}
+	if l.opts.onPopulated != nil {
+		l.opts.onPopulated(node)
+	}
+}
+
+// probeDirs はサブディレクトリが対象ファイルを含むか確かめ、含まないものをまとめて通知する。
+// 配下の全走査はせず、対象ファイルが1件見つかった時点で打ち切る。
+func (l *lazyLoader) probeDirs(parent *TreeNode, dirs []*TreeNode, dirOpts scanner.DirOptions) {
+	var empty []*TreeNode
+	for _, dir := range dirs {
+		if !scanner.ContainsMatch(context.Background(), dir.fullPath, dirOpts) {
+			empty = append(empty, dir)
+		}
+	}
+	if len(empty) > 0 {
+		l.opts.onEmptyDirs(parent, empty)
+	}
+}
+
+// removeEmptyDirs は対象ファイルを含まないと判明したサブディレクトリを取り除く。UIスレッドで呼び出す。
+func (m *TreeModel) removeEmptyDirs(parent *TreeNode, dirs []*TreeNode) {
+	if m == nil || parent == nil {
+		return
+	}
+	visible := m.isVisible(parent)
+	var removed []*TreeNode
+	for _, dir := range dirs {
+		if parent.removeChild(dir) {
+			removed = append(removed, dir)
+		}
+	}
+	if len(removed) == 0 || !visible {
+		return
+	}
+	if m.filter != nil && m.pinnedRootOf(parent) == nil {
+		// 絞り込み中は表示対象を求め直して再描画する。
+		parent.applyFilter(m.filter)
+		m.PublishItemsReset(parent)
+		return
+	}
+	for _, dir := range removed {
+		m.PublishItemRemoved(dir)
+	}
+}
+
+// adjacentNode は表示順で前後のノードを返す。未探索のディレクトリは必要に応じて探索する。
+func adjacentNode(roots []*TreeNode, node *TreeNode, forward bool) *TreeNode {
+	if node == nil {
+		return nil
+	}
+	if forward {
+		if node.IsDir() {
+			node.ensurePopulated()
+			if children := node.visibleChildren(); len(children) > 0 {
+				return children[0]
+			}
+		}
+		for current := node; current != nil; current = current.parent {
+			if sibling := siblingNode(roots, current, 1); sibling != nil {
+				return sibling
+			}
+		}
+		return nil
+	}
+	if sibling := siblingNode(roots, node, -1); sibling != nil {
+		return lastDescendant(sibling)
+	}
+	return node.parent
+}
+
+// siblingNode は同じ階層で指定方向に隣接するノードを返す。
+func siblingNode(roots []*TreeNode, node *TreeNode, offset int) *TreeNode {
+	siblings := roots
+	if node.parent != nil {
+		siblings = node.parent.visibleChildren()
+	}
+	for i, sibling := range siblings {
+		if sibling != node {
+			continue
+		}
+		target := i + offset
+		if target < 0 || target >= len(siblings) {
+			return nil
+		}
+		return siblings[target]
+	}
+	return nil
+}
+
+// lastDescendant は表示順で末尾となる子孫ノードを返す。
+func lastDescendant(node *TreeNode) *TreeNode {
+	current := node
+	for current != nil && current.IsDir() {
+		current.ensurePopulated()
+		children := current.visibleChildren()
+		if len(children) == 0 {
+			return current
+		}
+		current = children[len(children)-1]
+	}
+	return current
+}
+
+// stepFileNode は表示順で指定方向に隣接するファイルノードを返す。
+func stepFileNode(roots []*TreeNode, node *TreeNode, forward bool) *TreeNode {
+	current := node
+	for {
+		current = adjacentNode(roots, current, forward)
+		if current == nil || !current.IsDir() {
+			return current
+		}
+	}
+}
+
+// edgeFileNode は表示順で先頭または末尾のファイルノードを返す。
+func edgeFileNode(roots []*TreeNode, first bool) *TreeNode {
+	if len(roots) == 0 {
+		return nil
+	}
+	if first {
+		start := roots[0]
+		if !start.IsDir() {
+			return start
+		}
+		return stepFileNode(roots, start, true)
+	}
+	last := lastDescendant(roots[len(roots)-1])
+	if last == nil || !last.IsDir() {
+		return last
+	}
+	return stepFileNode(roots, last, false)
+}
+
+// expandRootNodes はルートノードのみを展開する。
+func (tw *TreeViewWidget) expandRootNodes() {
+	if tw == nil || tw.treeView == nil || tw.model == nil {
+		return
+	}
+	for _, root := range tw.model.visibleRoots() {
+		if root == nil || !root.HasChild() {
+			continue
+		}
+		if err := tw.treeView.SetExpanded(root, true); err != nil && tw.logger != nil {
+			tw.logger.Warn("ツリーの展開に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+	}
+}
+
+// moveSelectionLazy は遅延読み込みモードでモデル選択を進める。
+func (tw *TreeViewWidget) moveSelectionLazy(move selectionMove, basePath string) {
+	roots := tw.model.visibleRoots()
+	var current *TreeNode
+	for _, candidate := range []string{basePath, tw.lastSelected, tw.resolveCurrentFilePath()} {
+		if node := findNodeByPath(roots, candidate); node != nil && !node.IsDir() && tw.model.isVisible(node) {
+			current = node
+			break
+		}
+	}
+	var target *TreeNode
+	switch {
+	case move.edge:
+		target = edgeFileNode(roots, move.delta < 0)
+	case current == nil:
+		target = edgeFileNode(roots, move.delta >= 0)
+	case move.folder:
+		target = folderStartNode(roots, current, move.delta >= 0)
+	default:
+		forward := move.delta >= 0
+		steps := move.delta
+		if steps < 0 {
+			steps = -steps
+		}
+		target = current
+		for i := 0; i < steps; i++ {
+			next := stepFileNode(roots, target, forward)
+			if next == nil {
+				// 端に達した場合はそこで止める。
+				break
+			}
+			target = next
+		}
+	}
+	if target == nil {
+		return
+	}
+	tw.selectFileNode(target)
+}
+
+// folderStartNode は表示順で前後のフォルダの先頭のファイルノードを返す。該当するフォルダが無い場合はnodeを返す。
+func folderStartNode(roots []*TreeNode, node *TreeNode, forward bool) *TreeNode {
+	if forward {
+		for next := stepFileNode(roots, node, true); next != nil; next = stepFileNode(roots, next, true) {
+			if next.parent != node.parent {
+				return next
+			}
+		}
+		return node
+	}
+	// 現在のフォルダの先頭より前にある、直前のフォルダの先頭まで戻る。
+	var previous *TreeNode
+	for prev := stepFileNode(roots, node, false); prev != nil; prev = stepFileNode(roots, prev, false) {
+		switch {
+		case previous == nil && prev.parent == node.parent:
+		case previous == nil || prev.parent == previous.parent:
+			previous = prev
+		default:
+			return previous
+		}
+	}
+	if previous == nil {
+		return node
+	}
+	return previous
+}
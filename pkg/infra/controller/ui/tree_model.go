@@ -5,40 +5,123 @@
 package ui
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
 )
 
+// fileTypes はツリーに表示するファイルの種別判定を表す。
+var fileTypes = filetype.NewDefaultRegistry()
+
 const (
-	modelExtPmx = ".pmx"
-	modelExtPmd = ".pmd"
-	modelExtX   = ".x"
+	// archiveSignature はアーカイブを仮想フォルダとして走査する条件を表す。
+	archiveSignature = "+zip"
+	// linkLabelSuffix はリンクのフォルダの表示名に付ける印を表す。
+	linkLabelSuffix = " ⇢"
+	// compactSeparator はまとめたフォルダの表示名の区切りを表す。
+	compactSeparator = "/"
 )
 
+// treeBuildOptions はツリー構築時の条件を表す。
+type treeBuildOptions struct {
+	index *scanner.Index
+	lazy  bool
+	// compact は子が1フォルダのみのフォルダを1ノードにまとめるか。遅延読み込み時は使わない。
+	compact bool
+	rules   scanner.Rules
+	// order は子ノードの並び順。
+	order nodeOrder
+	// onPopulated は遅延読み込みでフォルダの子ノードを生成した後に呼ばれる。UIスレッドで呼ばれる。
+	onPopulated func(node *TreeNode)
+	// onEmptyDirs は遅延読み込みで、対象ファイルを含まないと判明したサブフォルダを渡して呼ばれる。バックグラウンドで呼ばれる。
+	// nilの場合はフォルダの子ノードを生成する際にその場で確かめる。
+	onEmptyDirs func(parent *TreeNode, dirs []*TreeNode)
+	// kinds はツリーに表示するファイル種別。空の場合はモデルのみ表示する。
+	kinds []filetype.Kind
+	// filter はルート単位の除外規則。nilの場合は走査対象のパスを基準に生成する。
+	filter *scanner.Filter
+	// roots はワークスペースで指定したルート単位の表示名と走査条件。キーは小文字のパス。
+	roots map[string]rootOptions
+}
+
 // TreeNode はツリー表示用のノードを表す。
 type TreeNode struct {
-	name     string
-	fullPath string
-	parent   *TreeNode
-	children []*TreeNode
-	isDir    bool
+	name      string
+	fullPath  string
+	parent    *TreeNode
+	children  []*TreeNode
+	isDir     bool
+	kind      filetype.Kind
+	loader    *lazyLoader
+	populated bool
+	filter    *scanner.Filter
+	// link はシンボリックリンク・ジャンクションを辿ったフォルダか。
+	link bool
+	// sortKey は並び替え用の値。初回の比較時に求める。
+	sortKey *nodeSortKey
+	// label はファイル名の代わりに表示するモデル名。空の場合はファイル名を表示する。
+	label string
+	// modelCount はフォルダ配下のモデル数。
+	modelCount int
+	// countPartial は配下に未探索のフォルダがあり、modelCountが下限であるか。
+	countPartial bool
+	// summary はルートの表示名に付ける集計。
+	summary string
+	// status はブックマーク先が見つからない場合などに表示名へ付ける状態。
+	status string
+	// tags はモデルに付けたタグ。
+	tags []string
+	// hasNote はモデルにメモがあるか。
+	hasNote bool
+	// shown は絞り込み後に表示する子ノード。filteredがfalseの場合は使わない。
+	shown []*TreeNode
+	// filtered は絞り込みを適用済みか。
+	filtered bool
+	// match は絞り込み文字列と一致した表示名の範囲。nilの場合は印を付けない。
+	match []int
 }
 
 // NewTreeNode はTreeNodeを生成する。
 func NewTreeNode(name string, fullPath string, parent *TreeNode, isDir bool) *TreeNode {
-	return &TreeNode{
+	node := &TreeNode{
 		name:     name,
 		fullPath: fullPath,
 		parent:   parent,
 		isDir:    isDir,
 	}
+	if !isDir {
+		node.kind = fileTypes.KindOf(fullPath)
+	}
+	return node
+}
+
+// Kind はファイルノードの種別を返す。ディレクトリの場合は未登録の種別を返す。
+func (n *TreeNode) Kind() filetype.Kind {
+	if n == nil {
+		return filetype.KindUnknown
+	}
+	return n.kind
+}
+
+// Image はツリー表示用のアイコンを返す。
+func (n *TreeNode) Image() interface{} {
+	if n == nil {
+		return nil
+	}
+	if n.isDir {
+		return folderIcon()
+	}
+	return kindIcon(n.kind)
 }
 
 // Text はツリー表示用のラベルを返す。
@@ -46,9 +129,43 @@ func (n *TreeNode) Text() string {
 	if n == nil {
 		return ""
 	}
+	if n.isDir {
+		text := n.name
+		if n.link {
+			text += linkLabelSuffix
+		}
+		if n.status != "" {
+			return n.withStatus(text)
+		}
+		if n.parent == nil && n.summary != "" {
+			return text + " " + n.summary
+		}
+		return text + n.countBadge()
+	}
+	return n.withStatus(n.highlighted(n.baseText()) + n.tagChips())
+}
+
+// baseText はファイルノードの印を付ける前の表示名を返す。
+func (n *TreeNode) baseText() string {
+	if n.label != "" {
+		return fmt.Sprintf("%s (%s)", n.label, n.name)
+	}
 	return n.name
 }
 
+// withStatus は状態が設定されている場合に表示名へ付ける。
+func (n *TreeNode) withStatus(text string) string {
+	if n.status == "" {
+		return text
+	}
+	return fmt.Sprintf("%s [%s]", text, n.status)
+}
+
+// IsLink はシンボリックリンク・ジャンクションを辿ったフォルダか判定する。
+func (n *TreeNode) IsLink() bool {
+	return n != nil && n.link
+}
+
 // Parent は親ノードを返す。
 func (n *TreeNode) Parent() walk.TreeItem {
 	if n == nil {
@@ -65,7 +182,8 @@ func (n *TreeNode) ChildCount() int {
 	if n == nil {
 		return 0
 	}
-	return len(n.children)
+	n.ensurePopulated()
+	return len(n.visibleChildren())
 }
 
 // ChildAt は指定インデックスの子ノードを返す。
@@ -73,15 +191,17 @@ func (n *TreeNode) ChildAt(index int) walk.TreeItem {
 	if n == nil {
 		return nil
 	}
-	if index < 0 || index >= len(n.children) {
+	n.ensurePopulated()
+	children := n.visibleChildren()
+	if index < 0 || index >= len(children) {
 		return nil
 	}
-	return n.children[index]
+	return children[index]
 }
 
-// HasChild は子ノードが存在するか判定する。
+// HasChild は子ノードが存在するか判定する。未探索のディレクトリは展開可能とみなす。
 func (n *TreeNode) HasChild() bool {
-	return n != nil && len(n.children) > 0
+	return n != nil && (n.isLazy() || len(n.visibleChildren()) > 0)
 }
 
 // Path はノードのフルパスを返す。
@@ -108,26 +228,88 @@ func (n *TreeNode) addChild(child *TreeNode) {
 	n.children = append(n.children, child)
 }
 
-// sortChildren は子ノードを名前順で並べ替える。
-func (n *TreeNode) sortChildren() {
-	if n == nil {
+// insertChildSorted は並び順を保って子ノードを挿入する。
+func (n *TreeNode) insertChildSorted(child *TreeNode, order nodeOrder) {
+	if n == nil || child == nil {
 		return
 	}
-	if len(n.children) > 1 {
-		sort.SliceStable(n.children, func(i, j int) bool {
-			return strings.ToLower(n.children[i].name) < strings.ToLower(n.children[j].name)
-		})
+	index := sort.Search(len(n.children), func(i int) bool {
+		return order.less(child, n.children[i])
+	})
+	n.children = append(n.children, nil)
+	copy(n.children[index+1:], n.children[index:])
+	n.children[index] = child
+}
+
+// removeChild は子ノードを取り除く。
+func (n *TreeNode) removeChild(child *TreeNode) bool {
+	if n == nil || child == nil {
+		return false
+	}
+	for i, current := range n.children {
+		if current != child {
+			continue
+		}
+		n.children = append(n.children[:i], n.children[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// findChild は名前が一致する子ノードを返す。
+func (n *TreeNode) findChild(name string) *TreeNode {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.children {
+		if strings.EqualFold(child.name, name) {
+			return child
+		}
+	}
+	return nil
+}
+
+// sortChildren は子孫を含めて子ノードを指定の並び順で並べ替える。
+func (n *TreeNode) sortChildren(order nodeOrder) {
+	if n == nil {
+		return
 	}
+	n.sortOwnChildren(order)
 	for _, child := range n.children {
-		child.sortChildren()
+		child.sortChildren(order)
 	}
 }
 
+// sortOwnChildren は直下の子ノードのみを指定の並び順で並べ替える。
+func (n *TreeNode) sortOwnChildren(order nodeOrder) {
+	if n == nil || len(n.children) < 2 {
+		return
+	}
+	sort.SliceStable(n.children, func(i, j int) bool {
+		return order.less(n.children[i], n.children[j])
+	})
+}
+
 // TreeModel はツリービュー表示用のモデルを表す。
 type TreeModel struct {
 	walk.TreeModelBase
 	roots     []*TreeNode
 	rootPaths []string
+	lazy      bool
+	// order は差分反映で追加するノードの並び順。
+	order nodeOrder
+	// favorites は先頭に固定表示するお気に入りルート。rootsには含めない。
+	favorites *TreeNode
+	// recent はお気に入りの次に固定表示する最近見たモデルのルート。rootsには含めない。
+	recent *TreeNode
+	// duplicates は最近見たモデルの次に固定表示する重複ファイルのルート。rootsには含めない。
+	duplicates *TreeNode
+	// versions は重複ファイルの次に固定表示するバージョン整理のルート。rootsには含めない。
+	versions *TreeNode
+	// filter はツリーの絞り込み条件。nilの場合は全て表示する。お気に入りルートには適用しない。
+	filter nodeFilter
+	// shownRoots は絞り込み後に表示するルートノード。
+	shownRoots []*TreeNode
 }
 
 // NewTreeModel はTreeModelを生成する。
@@ -135,12 +317,17 @@ func NewTreeModel() *TreeModel {
 	return &TreeModel{}
 }
 
+// LazyPopulation は展開時に子ノードを探索するか判定する。
+func (m *TreeModel) LazyPopulation() bool {
+	return m != nil && m.lazy
+}
+
 // RootCount はルートノード数を返す。
 func (m *TreeModel) RootCount() int {
 	if m == nil {
 		return 0
 	}
-	return len(m.roots)
+	return len(m.pinnedRoots()) + len(m.visibleRoots())
 }
 
 // RootAt は指定インデックスのルートノードを返す。
@@ -148,30 +335,113 @@ func (m *TreeModel) RootAt(index int) walk.TreeItem {
 	if m == nil {
 		return nil
 	}
-	if index < 0 || index >= len(m.roots) {
+	pinned := m.pinnedRoots()
+	if index >= 0 && index < len(pinned) {
+		return pinned[index]
+	}
+	index -= len(pinned)
+	roots := m.visibleRoots()
+	if index < 0 || index >= len(roots) {
 		return nil
 	}
-	return m.roots[index]
+	return roots[index]
 }
 
-// SetRoots はルートパス一覧からツリー構造を再構築する。
-func (m *TreeModel) SetRoots(paths []string) error {
+// pinnedRoots は先頭に固定表示するルート(お気に入り・最近見たモデル・重複ファイル・バージョン整理)を表示順で返す。
+func (m *TreeModel) pinnedRoots() []*TreeNode {
 	if m == nil {
-		return errors.New("tree model is nil")
+		return nil
+	}
+	pinned := make([]*TreeNode, 0, 4)
+	for _, root := range []*TreeNode{m.favorites, m.recent, m.duplicates, m.versions} {
+		if root != nil {
+			pinned = append(pinned, root)
+		}
 	}
-	if sameStringSlice(paths, m.rootPaths) {
-		// 同一パスの再走査とツリー再描画を抑止する。
+	return pinned
+}
+
+// pinnedRootOf はノードを含む固定表示のルートを返す。固定表示のルート外の場合はnilを返す。
+func (m *TreeModel) pinnedRootOf(node *TreeNode) *TreeNode {
+	if m == nil || node == nil {
 		return nil
 	}
-	roots, err := buildRoots(paths)
+	current := node
+	for current.parent != nil {
+		current = current.parent
+	}
+	for _, root := range m.pinnedRoots() {
+		if current == root {
+			return root
+		}
+	}
+	return nil
+}
+
+// SetFavorites はお気に入りルートを差し替える。nilの場合はお気に入りルートを取り除く。
+func (m *TreeModel) SetFavorites(root *TreeNode) {
+	if m == nil {
+		return
+	}
+	m.setPinned(&m.favorites, root)
+}
+
+// SetRecent は最近見たモデルのルートを差し替える。nilの場合は最近見たモデルのルートを取り除く。
+func (m *TreeModel) SetRecent(root *TreeNode) {
+	if m == nil {
+		return
+	}
+	m.setPinned(&m.recent, root)
+}
+
+// SetDuplicates は重複ファイルのルートを差し替える。nilの場合は重複ファイルのルートを取り除く。
+func (m *TreeModel) SetDuplicates(root *TreeNode) {
+	if m == nil {
+		return
+	}
+	m.setPinned(&m.duplicates, root)
+}
+
+// SetVersions はバージョン整理のルートを差し替える。nilの場合はバージョン整理のルートを取り除く。
+func (m *TreeModel) SetVersions(root *TreeNode) {
+	if m == nil {
+		return
+	}
+	m.setPinned(&m.versions, root)
+}
+
+// setPinned は固定表示のルートを差し替えて、変更を通知する。
+func (m *TreeModel) setPinned(slot **TreeNode, root *TreeNode) {
+	previous := *slot
+	*slot = root
+	switch {
+	case root == nil && previous != nil:
+		m.PublishItemRemoved(previous)
+	case root != nil && previous == root:
+		m.PublishItemsReset(root)
+	case root != nil && previous != nil:
+		m.PublishItemsReset(nil)
+	case root != nil:
+		m.PublishItemInserted(root)
+	}
+}
+
+// SetRoots は構築済みのルートノードへ差し替えて全体を再描画する。
+func (m *TreeModel) SetRoots(roots []*TreeNode, paths []string, lazy bool, opts treeBuildOptions) error {
+	if m == nil {
+		return errors.New("tree model is nil")
+	}
+	m.lazy = lazy
+	m.order = opts.order
 	m.roots = roots
 	m.rootPaths = append([]string{}, paths...)
+	m.reapplyFilter()
 	m.PublishItemsReset(nil)
-	return err
+	return nil
 }
 
 // buildRoots はルート配下のモデルファイルからツリーを構成する。
-func buildRoots(paths []string) ([]*TreeNode, error) {
+func buildRoots(ctx context.Context, paths []string, opts treeBuildOptions, onProgress scanner.ProgressFunc) ([]*TreeNode, error) {
 	if len(paths) == 0 {
 		return nil, nil
 	}
@@ -181,7 +451,7 @@ func buildRoots(paths []string) ([]*TreeNode, error) {
 		if rootPath == "" {
 			continue
 		}
-		rootNode, err := buildRootNode(rootPath)
+		rootNode, err := buildRootNode(ctx, rootPath, opts, onProgress)
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -198,13 +468,17 @@ func buildRoots(paths []string) ([]*TreeNode, error) {
 }
 
 // buildRootNode は指定ルートのツリーノードを生成する。
-func buildRootNode(rootPath string) (*TreeNode, error) {
-	modelPaths, err := collectModelPaths(rootPath)
+func buildRootNode(ctx context.Context, rootPath string, opts treeBuildOptions, onProgress scanner.ProgressFunc) (*TreeNode, error) {
+	opts = opts.scopedTo(rootPath)
+	if opts.lazy {
+		return newLazyRootNode(ctx, rootPath, opts)
+	}
+	modelPaths, err := collectModelPaths(ctx, rootPath, opts, onProgress)
 	if len(modelPaths) == 0 {
 		return nil, err
 	}
-	rootLabel := fmt.Sprintf("【%s】", rootPath)
-	rootNode := NewTreeNode(rootLabel, rootPath, nil, true)
+	rootNode := newRootNode(rootPath, opts.aliasFor(rootPath))
+	rootNode.filter = opts.filter
 
 	dirNodes := map[string]*TreeNode{}
 	dirNodes[strings.ToLower(rootPath)] = rootNode
@@ -240,6 +514,7 @@ func buildRootNode(rootPath string) (*TreeNode, error) {
 			child := dirNodes[key]
 			if child == nil {
 				child = NewTreeNode(part, currentPath, current, true)
+				child.link = opts.filter.IsLink(currentPath)
 				dirNodes[key] = child
 				current.addChild(child)
 			}
@@ -247,51 +522,97 @@ func buildRootNode(rootPath string) (*TreeNode, error) {
 		}
 	}
 
-	rootNode.sortChildren()
+	rootNode.sortChildren(opts.order)
+	if opts.compact {
+		for _, child := range rootNode.children {
+			child.compactChain()
+		}
+	}
 	return rootNode, errors.Join(errs...)
 }
 
-// collectModelPaths はモデルファイルのパスを収集する。
-func collectModelPaths(rootPath string) ([]string, error) {
+// compactChain は子が1フォルダのみのフォルダを子孫を含めて1ノードにまとめる。
+// まとめたノードは末端のフォルダのパスを持ち、表示名は区切り文字で連結する。
+func (n *TreeNode) compactChain() {
+	if n == nil || !n.isDir {
+		return
+	}
+	for len(n.children) == 1 && n.children[0].isDir {
+		child := n.children[0]
+		n.name = n.name + compactSeparator + child.name
+		n.fullPath = child.fullPath
+		n.link = n.link || child.link
+		n.children = child.children
+		for _, grandChild := range n.children {
+			grandChild.parent = n
+		}
+	}
+	for _, child := range n.children {
+		child.compactChain()
+	}
+}
+
+// newRootNode はルートパスに対応するルートノードを生成する。表示名が指定された場合はパスの代わりに表示する。
+func newRootNode(rootPath string, alias string) *TreeNode {
+	if alias == "" {
+		alias = rootPath
+	}
+	rootLabel := fmt.Sprintf("【%s】", alias)
+	return NewTreeNode(rootLabel, rootPath, nil, true)
+}
+
+// collectModelPaths はツリーに表示するファイルのパスを収集する。
+func collectModelPaths(ctx context.Context, rootPath string, opts treeBuildOptions, onProgress scanner.ProgressFunc) ([]string, error) {
 	if rootPath == "" {
 		return nil, nil
 	}
-	var paths []string
-	var errs []error
-	walkErr := filepath.WalkDir(rootPath, func(path string, entry fs.DirEntry, err error) error {
-		if err != nil {
-			errs = append(errs, err)
-			if entry != nil && entry.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if entry == nil || entry.IsDir() {
-			return nil
-		}
-		if isModelFile(path) {
-			paths = append(paths, path)
-		}
-		return nil
+	filter := opts.filter
+	if filter == nil {
+		filter = scanner.NewFilter(rootPath, opts.rules)
+	}
+	modelScanner := scanner.New(scanner.Options{
+		Match:     opts.match(),
+		Index:     opts.index,
+		Signature: opts.signature(),
+		Filter:    filter,
+		Archives:  true,
 	})
-	if walkErr != nil {
-		errs = append(errs, walkErr)
+	return modelScanner.Scan(ctx, rootPath, onProgress)
+}
+
+// visibleKinds はツリーに表示するファイル種別を返す。
+func (opts treeBuildOptions) visibleKinds() []filetype.Kind {
+	if len(opts.kinds) == 0 {
+		return filetype.DefaultVisibleKinds()
 	}
-	return paths, errors.Join(errs...)
+	return opts.kinds
+}
+
+// match はツリーに表示するファイルか判定する関数を返す。アーカイブ内はモデルのみ表示する。
+func (opts treeBuildOptions) match() func(path string) bool {
+	match := fileTypes.Match(opts.visibleKinds()...)
+	return func(path string) bool {
+		if archive.HasArchiveSegment(path) {
+			return isModelFile(path)
+		}
+		return match(path)
+	}
+}
+
+// dirOptions はフォルダ単位の確認条件を返す。
+func (opts treeBuildOptions) dirOptions() scanner.DirOptions {
+	return scanner.DirOptions{Match: opts.match(), Filter: opts.filter, Archives: true}
+}
+
+// signature は表示するファイルの判定条件を返す。判定条件が変わった場合は走査インデックスを作り直す。
+func (opts treeBuildOptions) signature() string {
+	// アーカイブを仮想フォルダとして扱う前のインデックスを使わないよう区別する。
+	return fileTypes.Signature(opts.visibleKinds()...) + archiveSignature
 }
 
 // isModelFile はモデル拡張子か判定する。
 func isModelFile(path string) bool {
-	if path == "" {
-		return false
-	}
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case modelExtPmx, modelExtPmd, modelExtX:
-		return true
-	default:
-		return false
-	}
+	return fileTypes.KindOf(path) == filetype.KindModel
 }
 
 // splitPath はOS依存区切りで分割する。
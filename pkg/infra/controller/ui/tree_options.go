@@ -0,0 +1,253 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"errors"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+// SetUserConfig はユーザー設定を設定し、保存済みのツリー表示設定を読み込む。
+func (tw *TreeViewWidget) SetUserConfig(userConfig config.IUserConfig) {
+	if tw == nil {
+		return
+	}
+	tw.userConfig = userConfig
+	lazy := loadConfigBool(userConfig, userConfigKeyTreeLazy, false)
+	compact := loadConfigBool(userConfig, userConfigKeyTreeCompact, false)
+	mode := parseSortMode(loadConfigString(userConfig, userConfigKeyTreeSortMode, string(defaultSortMode)))
+	foldersFirst := loadConfigBool(userConfig, userConfigKeyTreeFoldersFirst, false)
+	nodeLabel := parseLabelMode(loadConfigString(userConfig, userConfigKeyTreeLabelMode, string(labelByFileName)))
+	rules := loadScanRules(userConfig)
+	kinds := loadVisibleKinds(userConfig)
+	tw.bookmarks = loadBookmarks(userConfig)
+	tw.recent = loadConfigList(userConfig, userConfigKeyRecentModels)
+	tw.searchMode = parseSearchMode(loadConfigString(userConfig, userConfigKeyTreeSearchMode, string(searchSubstring)))
+	tw.savedQueries = loadConfigList(userConfig, userConfigKeySavedQueries)
+	tw.buildMu.Lock()
+	tw.lazyMode = lazy
+	tw.compactMode = compact
+	tw.sortMode = mode
+	tw.foldersFirst = foldersFirst
+	tw.labelMode = nodeLabel
+	tw.scanRules = rules
+	tw.visibleKinds = kinds
+	tw.buildMu.Unlock()
+	if tw.lazyCheck != nil {
+		tw.lazyCheck.SetChecked(lazy)
+	}
+	if tw.compactCheck != nil {
+		tw.compactCheck.SetChecked(compact)
+	}
+	if tw.sortCombo != nil {
+		_ = tw.sortCombo.SetCurrentIndex(tw.sortModeIndex())
+	}
+	if tw.foldersFirstCheck != nil {
+		tw.foldersFirstCheck.SetChecked(foldersFirst)
+	}
+	if tw.labelCombo != nil {
+		_ = tw.labelCombo.SetCurrentIndex(tw.labelModeIndex())
+	}
+	if tw.searchModeCombo != nil {
+		_ = tw.searchModeCombo.SetCurrentIndex(tw.searchModeIndex())
+	}
+	tw.updateSearchCueBanner()
+	tw.refreshSavedQueryCombo()
+	tw.refreshFavorites()
+	tw.refreshRecent()
+}
+
+// setModelNameReader はモデル名の表示・モデル名順で使うモデル名の読み込み処理を設定する。
+func (tw *TreeViewWidget) setModelNameReader(reader func(path string) (minteractor.ModelNames, error)) {
+	if tw == nil {
+		return
+	}
+	tw.buildMu.Lock()
+	tw.modelNameReader = reader
+	tw.buildMu.Unlock()
+}
+
+// setModelMetadataReader はクエリで照合するモデルの情報の読み込み処理を設定する。
+func (tw *TreeViewWidget) setModelMetadataReader(reader func(path string, withHeader bool) (minteractor.ModelMetadata, error)) {
+	if tw == nil {
+		return
+	}
+	tw.buildMu.Lock()
+	tw.metadataReader = reader
+	tw.buildMu.Unlock()
+}
+
+// readModelName はモデル名順で使うモデル名を返す。読み込めない場合は空文字を返す。構築中のワーカーからも呼ばれる。
+func (tw *TreeViewWidget) readModelName(path string) string {
+	names, ok := tw.lookupModelNames(path)
+	if !ok {
+		return ""
+	}
+	return names.Name
+}
+
+// sortModeLabels は並び順の選択肢の表示名を返す。
+func (tw *TreeViewWidget) sortModeLabels() []string {
+	modes := sortModes()
+	labels := make([]string, len(modes))
+	for i, mode := range modes {
+		labels[i] = i18n.TranslateOrMark(tw.translator, sortModeLabelKey(mode))
+	}
+	return labels
+}
+
+// sortModeIndex は現在の並び順の選択肢の位置を返す。
+func (tw *TreeViewWidget) sortModeIndex() int {
+	for i, mode := range sortModes() {
+		if mode == tw.sortMode {
+			return i
+		}
+	}
+	return 0
+}
+
+// handleSortModeChanged は並び順の変更を保存してツリーを再構築する。
+func (tw *TreeViewWidget) handleSortModeChanged() {
+	if tw == nil || tw.sortCombo == nil {
+		return
+	}
+	index := tw.sortCombo.CurrentIndex()
+	modes := sortModes()
+	if index < 0 || index >= len(modes) {
+		return
+	}
+	mode := modes[index]
+	tw.buildMu.Lock()
+	changed := tw.sortMode != mode
+	tw.sortMode = mode
+	tw.buildMu.Unlock()
+	if !changed {
+		return
+	}
+	if err := saveConfigString(tw.userConfig, userConfigKeyTreeSortMode, string(mode)); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.rebuild()
+}
+
+// handleFoldersFirstChanged はフォルダを先に並べる設定の変更を保存してツリーを再構築する。
+func (tw *TreeViewWidget) handleFoldersFirstChanged() {
+	if tw == nil || tw.foldersFirstCheck == nil {
+		return
+	}
+	foldersFirst := tw.foldersFirstCheck.Checked()
+	tw.buildMu.Lock()
+	changed := tw.foldersFirst != foldersFirst
+	tw.foldersFirst = foldersFirst
+	tw.buildMu.Unlock()
+	if !changed {
+		return
+	}
+	if err := saveConfigBool(tw.userConfig, userConfigKeyTreeFoldersFirst, foldersFirst); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.rebuild()
+}
+
+// handleLazyModeChanged は遅延読み込み設定の変更を保存してツリーを再構築する。
+func (tw *TreeViewWidget) handleLazyModeChanged() {
+	if tw == nil || tw.lazyCheck == nil {
+		return
+	}
+	lazy := tw.lazyCheck.Checked()
+	tw.buildMu.Lock()
+	changed := tw.lazyMode != lazy
+	tw.lazyMode = lazy
+	tw.buildMu.Unlock()
+	if !changed {
+		return
+	}
+	if err := saveConfigBool(tw.userConfig, userConfigKeyTreeLazy, lazy); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.rebuild()
+}
+
+// handleCompactModeChanged はフォルダをまとめる表示設定の変更を保存してツリーを再構築する。
+func (tw *TreeViewWidget) handleCompactModeChanged() {
+	if tw == nil || tw.compactCheck == nil {
+		return
+	}
+	compact := tw.compactCheck.Checked()
+	tw.buildMu.Lock()
+	changed := tw.compactMode != compact
+	tw.compactMode = compact
+	tw.buildMu.Unlock()
+	if !changed {
+		return
+	}
+	if err := saveConfigBool(tw.userConfig, userConfigKeyTreeCompact, compact); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.rebuild()
+}
+
+// rebuild は現在のルートでツリーを再構築する。
+func (tw *TreeViewWidget) rebuild() {
+	if tw == nil || tw.model == nil || len(tw.model.rootPaths) == 0 {
+		return
+	}
+	tw.SetModelPaths(append([]string{}, tw.model.rootPaths...), tw.buildDone)
+}
+
+// scanRulesSnapshot は現在の走査の除外条件と表示するファイル種別を返す。
+func (tw *TreeViewWidget) scanRulesSnapshot() (scanner.Rules, []filetype.Kind) {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	return tw.scanRules, append([]filetype.Kind{}, tw.visibleKinds...)
+}
+
+// applyScanRules は走査の除外条件と表示するファイル種別を保存してツリーを再構築する。
+func (tw *TreeViewWidget) applyScanRules(rules scanner.Rules, kinds []filetype.Kind) {
+	if tw == nil {
+		return
+	}
+	tw.buildMu.Lock()
+	tw.scanRules = rules
+	tw.visibleKinds = kinds
+	tw.buildMu.Unlock()
+	if err := errors.Join(saveScanRules(tw.userConfig, rules), saveVisibleKinds(tw.userConfig, kinds)); err != nil && tw.logger != nil {
+		tw.logger.Warn("走査条件の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.rebuild()
+}
+
+// SetRootOptions はルート単位の表示名と走査条件を設定する。次回のツリー構築から反映する。
+func (tw *TreeViewWidget) SetRootOptions(options map[string]rootOptions) {
+	if tw == nil {
+		return
+	}
+	tw.buildMu.Lock()
+	tw.rootOptions = options
+	tw.buildMu.Unlock()
+}
+
+// scanOptionsFor は指定パスを部分走査する際の構築条件を返す。除外規則は所属するルートを基準にする。
+func (tw *TreeViewWidget) scanOptionsFor(path string) treeBuildOptions {
+	if tw == nil {
+		return treeBuildOptions{}
+	}
+	opts := tw.buildOptions()
+	filterRoot := path
+	if tw.model != nil {
+		if root := findRootPathOf(tw.model.rootPaths, path); root != "" {
+			filterRoot = root
+		}
+	}
+	rules := opts.forRoot(filterRoot).rules
+	return treeBuildOptions{rules: rules, filter: scanner.NewFilter(filterRoot, rules)}
+}
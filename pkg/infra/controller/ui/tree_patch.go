@@ -0,0 +1,193 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// findRoot は指定ルートパスのルートノードを返す。
+func (m *TreeModel) findRoot(rootPath string) *TreeNode {
+	if m == nil || rootPath == "" {
+		return nil
+	}
+	for _, root := range m.roots {
+		if sameFilePath(root.fullPath, rootPath) {
+			return root
+		}
+	}
+	return nil
+}
+
+// insertRoot はルート順を保ってルートノードを追加する。
+func (m *TreeModel) insertRoot(root *TreeNode) {
+	if m == nil || root == nil {
+		return
+	}
+	index := sort.Search(len(m.roots), func(i int) bool {
+		return strings.ToLower(root.fullPath) < strings.ToLower(m.roots[i].fullPath)
+	})
+	m.roots = append(m.roots, nil)
+	copy(m.roots[index+1:], m.roots[index:])
+	m.roots[index] = root
+}
+
+// removeRoot はルートノードを取り除く。
+func (m *TreeModel) removeRoot(root *TreeNode) bool {
+	if m == nil || root == nil {
+		return false
+	}
+	for i, current := range m.roots {
+		if current != root {
+			continue
+		}
+		m.roots = append(m.roots[:i], m.roots[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// replaceRoot は指定ルートパスのルートノードを差し替える。rootがnilの場合は削除する。
+func (m *TreeModel) replaceRoot(rootPath string, root *TreeNode) {
+	if m == nil {
+		return
+	}
+	if current := m.findRoot(rootPath); current != nil {
+		m.removeRoot(current)
+	}
+	if root != nil {
+		m.insertRoot(root)
+	}
+}
+
+// insertModelPath はモデルパスのノードを追加し、追加したディレクトリノードを返す。
+// ルートノードの追加が必要な場合はrootsChangedをtrueで返し、個別の挿入通知は行わない。絞り込み中も通知しない。
+// optsはルートノードを追加する場合の構築条件で、scopedToでルートの除外規則を反映して渡す。
+func (m *TreeModel) insertModelPath(rootPath string, modelPath string, opts treeBuildOptions) (createdDirs []*TreeNode, rootsChanged bool) {
+	if m == nil || rootPath == "" || modelPath == "" {
+		return nil, false
+	}
+	rel, err := filepath.Rel(rootPath, modelPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, false
+	}
+	parts := splitPath(rel)
+	if len(parts) == 0 {
+		return nil, false
+	}
+
+	root := m.findRoot(rootPath)
+	if root == nil {
+		root = newRootNode(rootPath, opts.aliasFor(rootPath))
+		root.filter = opts.filter
+		if m.lazy {
+			root.loader = &lazyLoader{opts: opts}
+		}
+		m.insertRoot(root)
+		rootsChanged = true
+	}
+
+	current := root
+	currentPath := rootPath
+	var topInserted *TreeNode
+	for i, part := range parts {
+		if current.isLazy() {
+			// 未探索のディレクトリは展開時に探索されるため追加しない。
+			break
+		}
+		if i == len(parts)-1 {
+			if existing := current.findChild(part); existing != nil {
+				// 更新されたファイルは並び替えの値を求め直す。
+				m.resort(existing)
+				break
+			}
+			fileNode := NewTreeNode(part, modelPath, current, false)
+			current.insertChildSorted(fileNode, m.order)
+			if topInserted == nil {
+				topInserted = fileNode
+			}
+			break
+		}
+		currentPath = filepath.Join(currentPath, part)
+		child := current.findChild(part)
+		if child == nil {
+			child = NewTreeNode(part, currentPath, current, true)
+			// 遅延読み込みモードでは新規ディレクトリも展開時に探索する。
+			child.loader = current.loader
+			current.insertChildSorted(child, m.order)
+			if topInserted == nil {
+				topInserted = child
+			}
+			if child.isLazy() {
+				break
+			}
+			createdDirs = append(createdDirs, child)
+		}
+		current = child
+	}
+	if topInserted != nil && !rootsChanged && m.filter == nil {
+		// 新規ディレクトリは配下を含めて最上位の1件だけ通知する。
+		m.PublishItemInserted(topInserted)
+	}
+	return createdDirs, rootsChanged
+}
+
+// resort はノードの並び替えの値を破棄し、更新日時・サイズ順の場合は並び位置を求め直す。
+func (m *TreeModel) resort(node *TreeNode) {
+	node.sortKey = nil
+	parent := node.parent
+	if parent == nil || !m.order.usesFileInfo() {
+		return
+	}
+	before := slices.Index(parent.children, node)
+	parent.removeChild(node)
+	parent.insertChildSorted(node, m.order)
+	if slices.Index(parent.children, node) != before && m.filter == nil {
+		// 絞り込み中は呼び出し側で全体を再描画する。
+		m.PublishItemsReset(parent)
+	}
+}
+
+// removePath は指定パスのノードを取り除き、空になった親ディレクトリも整理する。
+// ルートノードの削除が必要な場合はrootsChangedをtrueで返す。
+func (m *TreeModel) removePath(path string) (removed bool, rootsChanged bool) {
+	if m == nil || path == "" {
+		return false, false
+	}
+	node := findNodeByPath(m.roots, path)
+	if node == nil {
+		return false, false
+	}
+	if node.parent == nil {
+		return m.removeRoot(node), true
+	}
+	parent := node.parent
+	parent.removeChild(node)
+	m.publishRemoved(node)
+
+	// モデルを含まなくなったディレクトリは表示しない。
+	for parent != nil && len(parent.children) == 0 {
+		if parent.parent == nil {
+			m.removeRoot(parent)
+			return true, true
+		}
+		grandParent := parent.parent
+		grandParent.removeChild(parent)
+		m.publishRemoved(parent)
+		parent = grandParent
+	}
+	return true, false
+}
+
+// publishRemoved はノードの削除を通知する。絞り込み中は呼び出し側で全体を再描画するため通知しない。
+func (m *TreeModel) publishRemoved(node *TreeNode) {
+	if m.filter != nil {
+		return
+	}
+	m.PublishItemRemoved(node)
+}
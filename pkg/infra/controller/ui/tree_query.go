@@ -0,0 +1,392 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+// cachedModelMetadata は読み込み済みのモデルの情報を表す。
+type cachedModelMetadata struct {
+	meta minteractor.ModelMetadata
+	// withHeader はヘッダも読み込み済みか。
+	withHeader bool
+}
+
+// modelMetadataCache はファイルの更新日時とサイズが変わらない間、クエリで照合するモデルの情報を保持する。
+type modelMetadataCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedModelMetadata
+}
+
+// newModelMetadataCache はmodelMetadataCacheを生成する。
+func newModelMetadataCache() *modelMetadataCache {
+	return &modelMetadataCache{entries: map[string]cachedModelMetadata{}}
+}
+
+// peek はファイルを確認せずにキャッシュ済みの情報を返す。withHeaderの場合はヘッダ読み込み済みの情報のみ返す。
+func (c *modelMetadataCache) peek(path string, withHeader bool) (minteractor.ModelMetadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[strings.ToLower(path)]
+	if !ok || (withHeader && !cached.withHeader) {
+		return minteractor.ModelMetadata{}, false
+	}
+	return cached.meta, true
+}
+
+// load は情報を返す。キャッシュが無いか古い場合はreaderで読み直し、読み直したか返す。
+func (c *modelMetadataCache) load(path string, withHeader bool, reader func(path string, withHeader bool) (minteractor.ModelMetadata, error)) (minteractor.ModelMetadata, bool, error) {
+	info, err := archive.Stat(path)
+	if err != nil {
+		return minteractor.ModelMetadata{}, false, err
+	}
+	key := strings.ToLower(path)
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && (cached.withHeader || !withHeader) && cached.meta.Size == info.Size() && cached.meta.ModTime.Equal(info.ModTime()) {
+		return cached.meta, false, nil
+	}
+	meta, err := reader(path, withHeader)
+	if err != nil {
+		return meta, false, err
+	}
+	c.mu.Lock()
+	c.entries[key] = cachedModelMetadata{meta: meta, withHeader: withHeader}
+	c.mu.Unlock()
+	return meta, true, nil
+}
+
+// currentMetadataReader はモデルの情報の読み込み処理を返す。
+func (tw *TreeViewWidget) currentMetadataReader() func(path string, withHeader bool) (minteractor.ModelMetadata, error) {
+	tw.buildMu.Lock()
+	defer tw.buildMu.Unlock()
+	return tw.metadataReader
+}
+
+// queryMetadataOf はノードのキャッシュ済みの情報にタグを加えて返す。未読み込みの場合はfalseを返す。
+func (tw *TreeViewWidget) queryMetadataOf(node *TreeNode, query *minteractor.Query) (minteractor.ModelMetadata, bool) {
+	if node.Kind() != filetype.KindModel {
+		return minteractor.ModelMetadata{}, false
+	}
+	meta, ok := tw.modelMetadata.peek(node.fullPath, query.NeedsHeader())
+	if !ok {
+		return meta, false
+	}
+	meta.Tags = node.tags
+	meta.HasNote = node.hasNote
+	return meta, true
+}
+
+// applyQuery はクエリを解析して絞り込む。不正なクエリでは誤りを表示し、直前の絞り込みを維持する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyQuery(text string) {
+	query, err := minteractor.ParseQuery(text)
+	if err != nil {
+		tw.setSearchError(err.Error())
+		return
+	}
+	tw.setSearchError("")
+	tw.searchMatcher = nil
+	tw.setSearchQuery(query)
+	tw.refreshFilter()
+	tw.refreshQueryMetadata()
+}
+
+// setSearchQuery は絞り込みに使うクエリを設定する。読み込み中の情報の反映は打ち切る。
+func (tw *TreeViewWidget) setSearchQuery(query *minteractor.Query) {
+	if tw.searchQuery.String() == query.String() && (tw.searchQuery == nil) == (query == nil) {
+		return
+	}
+	tw.searchQuery = query
+	tw.querySeq++
+	tw.queryPending = 0
+	tw.queryUnreadable = nil
+	tw.queryHeaderErr = nil
+	tw.updateQueryStatus()
+}
+
+// refreshQueryMetadata はツリー全体のモデルの情報を読み込み直す。クエリで絞り込んでいない場合は何もしない。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshQueryMetadata() {
+	if tw == nil || tw.model == nil || tw.searchQuery == nil {
+		return
+	}
+	var nodes []*TreeNode
+	stack := append([]*TreeNode{}, tw.model.roots...)
+	for len(stack) > 0 {
+		last := len(stack) - 1
+		node := stack[last]
+		stack = stack[:last]
+		if node == nil {
+			continue
+		}
+		if node.IsDir() {
+			// 未探索のフォルダは展開時に読み込む。
+			if !node.isLazy() {
+				stack = append(stack, node.children...)
+			}
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	tw.requestModelMetadata(nodes)
+}
+
+// requestModelMetadata は指定ノードの情報をバックグラウンドで読み込む。クエリで絞り込んでいない場合は何もしない。
+// UIスレッドで呼び出す。
+func (tw *TreeViewWidget) requestModelMetadata(nodes []*TreeNode) {
+	if tw == nil || tw.model == nil || tw.searchQuery == nil || len(nodes) == 0 {
+		return
+	}
+	reader := tw.currentMetadataReader()
+	if reader == nil {
+		return
+	}
+	pending := make([]*TreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node != nil && node.Kind() == filetype.KindModel && node.status == "" {
+			pending = append(pending, node)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	tw.queryPending += len(pending)
+	tw.updateQueryStatus()
+	go tw.loadModelMetadata(tw.querySeq, tw.searchQuery.NeedsHeader(), reader, pending)
+}
+
+// loadModelMetadata はモデルの情報をバックグラウンドで読み込み、一定件数ごとに絞り込み直す。
+func (tw *TreeViewWidget) loadModelMetadata(seq uint64, withHeader bool, reader func(path string, withHeader bool) (minteractor.ModelMetadata, error), nodes []*TreeNode) {
+	jobs := make(chan *TreeNode)
+	results := make(chan metadataLoadResult, modelLabelBatchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < modelLabelWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range jobs {
+				meta, changed, err := tw.modelMetadata.load(node.fullPath, withHeader, reader)
+				if err != nil && tw.logger != nil {
+					tw.logger.Debug("モデル情報の読み込みに失敗しました: %s (%s)", node.fullPath, err.Error())
+				}
+				result := metadataLoadResult{path: node.fullPath, changed: changed}
+				if err == nil && withHeader {
+					result.headerErr = meta.HeaderErr
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		for _, node := range nodes {
+			jobs <- node
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	count := 0
+	changed := false
+	var unreadable []metadataLoadResult
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		loaded, refresh, failed := count, changed, unreadable
+		count, changed, unreadable = 0, false, nil
+		tw.synchronize(func() {
+			tw.applyModelMetadata(seq, loaded, refresh, failed)
+		})
+	}
+	for result := range results {
+		count++
+		changed = changed || result.changed
+		if result.headerErr != nil {
+			unreadable = append(unreadable, result)
+		}
+		if count >= modelLabelBatchSize {
+			flush()
+		}
+	}
+	flush()
+}
+
+// metadataLoadResult はモデル1件の情報の読み込み結果を表す。
+type metadataLoadResult struct {
+	path    string
+	changed bool
+	// headerErr はクエリがヘッダを使う場合に、ヘッダを読み込めなかったエラーを表す。
+	headerErr error
+}
+
+// applyModelMetadata は読み込んだ情報でツリーを絞り込み直す。ヘッダを読み込めずに除外したモデルは件数を表示する。
+// UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyModelMetadata(seq uint64, loaded int, changed bool, unreadable []metadataLoadResult) {
+	if tw == nil || tw.model == nil || seq != tw.querySeq {
+		// クエリやツリーが切り替わった後の結果は破棄する。
+		return
+	}
+	tw.queryPending = max(tw.queryPending-loaded, 0)
+	for _, result := range unreadable {
+		if tw.queryUnreadable == nil {
+			tw.queryUnreadable = map[string]struct{}{}
+		}
+		if _, ok := tw.queryUnreadable[strings.ToLower(result.path)]; ok {
+			continue
+		}
+		tw.queryUnreadable[strings.ToLower(result.path)] = struct{}{}
+		if tw.queryHeaderErr == nil {
+			tw.queryHeaderErr = result.headerErr
+			if tw.logger != nil {
+				tw.logger.Warn("モデル情報を読み込めないため、クエリの対象から除外しました: %s", logging.FormatError(result.headerErr, tw.logger))
+			}
+		}
+	}
+	tw.updateQueryStatus()
+	if changed {
+		tw.refreshFilter()
+	}
+}
+
+// updateQueryStatus はクエリの照合待ちの件数と、情報を読み込めずに除外したモデルの件数を表示する。誤りを表示中の場合は表示を変えない。
+func (tw *TreeViewWidget) updateQueryStatus() {
+	if tw.searchError == nil || tw.searchFailed {
+		return
+	}
+	var texts []string
+	if tw.searchQuery != nil && tw.queryPending > 0 {
+		texts = append(texts, fmt.Sprintf("%s (%d)", i18n.TranslateOrMark(tw.translator, messages.LabelQueryLoading), tw.queryPending))
+	}
+	if tw.searchQuery != nil && tw.queryHeaderErr != nil {
+		texts = append(texts, fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelQueryUnreadable), len(tw.queryUnreadable), tw.queryHeaderErr.Error()))
+	}
+	_ = tw.searchError.SetText(strings.Join(texts, " / "))
+}
+
+// modelPathFilter はクエリで絞り込んでいる場合に、一致するモデルのパスのみを返す関数を返す。
+// ツリーに無いフォルダを一括処理する際に使う。情報はその場で読み込むため、返した関数はバックグラウンドで呼び出す。
+// UIスレッドで呼び出し、その時点のクエリで照合する。
+func (tw *TreeViewWidget) modelPathFilter() func(paths []string) []string {
+	all := func(paths []string) []string { return paths }
+	if tw == nil || tw.searchQuery == nil {
+		return all
+	}
+	reader := tw.currentMetadataReader()
+	if reader == nil {
+		return all
+	}
+	query := tw.searchQuery
+	tagUsecase := tw.tagUsecase
+	return func(paths []string) []string {
+		matched := make([]string, 0, len(paths))
+		for _, path := range paths {
+			meta, _, err := tw.modelMetadata.load(path, query.NeedsHeader(), reader)
+			if err != nil {
+				continue
+			}
+			if tagUsecase != nil {
+				tags, _ := tagUsecase.Lookup(path)
+				meta.Tags = tags.Tags
+				meta.HasNote = strings.TrimSpace(tags.Note) != ""
+			}
+			if query.Match(meta) {
+				matched = append(matched, path)
+			}
+		}
+		return matched
+	}
+}
+
+// savedQueryLabels は保存済みクエリの選択肢を返す。先頭は案内の項目。
+func (tw *TreeViewWidget) savedQueryLabels() []string {
+	return append([]string{i18n.TranslateOrMark(tw.translator, messages.LabelQuerySaved)}, tw.savedQueries...)
+}
+
+// refreshSavedQueryCombo は保存済みクエリの選択肢を作り直し、案内の項目を選択する。
+func (tw *TreeViewWidget) refreshSavedQueryCombo() {
+	if tw.savedQueryCombo == nil {
+		return
+	}
+	tw.savedQueryBusy = true
+	defer func() {
+		tw.savedQueryBusy = false
+	}()
+	if err := tw.savedQueryCombo.SetModel(tw.savedQueryLabels()); err != nil {
+		tw.logger.Warn("保存済みクエリの更新に失敗しました: %s", logging.FormatError(err, tw.logger))
+		return
+	}
+	_ = tw.savedQueryCombo.SetCurrentIndex(0)
+}
+
+// handleSavedQueryChanged は選択した保存済みクエリで絞り込む。絞り込み方法はクエリに切り替える。
+func (tw *TreeViewWidget) handleSavedQueryChanged() {
+	if tw == nil || tw.savedQueryCombo == nil || tw.savedQueryBusy || tw.searchEdit == nil {
+		return
+	}
+	index := tw.savedQueryCombo.CurrentIndex() - 1
+	if index < 0 || index >= len(tw.savedQueries) {
+		return
+	}
+	_ = tw.searchEdit.SetText(tw.savedQueries[index])
+	if tw.searchMode != searchQuery && tw.searchModeCombo != nil {
+		// 絞り込み方法の変更は選択変更の通知で保存・反映される。
+		_ = tw.searchModeCombo.SetCurrentIndex(len(searchModes()) - 1)
+	}
+}
+
+// handleQuerySave は入力中のクエリを保存済みクエリに追加する。不正なクエリは保存しない。
+func (tw *TreeViewWidget) handleQuerySave() {
+	if tw == nil || tw.searchEdit == nil || tw.searchMode != searchQuery {
+		return
+	}
+	text := strings.TrimSpace(tw.searchEdit.Text())
+	if text == "" {
+		return
+	}
+	if _, err := minteractor.ParseQuery(text); err != nil {
+		tw.setSearchError(err.Error())
+		return
+	}
+	for _, saved := range tw.savedQueries {
+		if saved == text {
+			return
+		}
+	}
+	tw.savedQueries = append(tw.savedQueries, text)
+	tw.saveQueries()
+}
+
+// handleQueryDelete は選択中の保存済みクエリを削除する。
+func (tw *TreeViewWidget) handleQueryDelete() {
+	if tw == nil || tw.savedQueryCombo == nil {
+		return
+	}
+	index := tw.savedQueryCombo.CurrentIndex() - 1
+	if index < 0 || index >= len(tw.savedQueries) {
+		return
+	}
+	tw.savedQueries = append(tw.savedQueries[:index:index], tw.savedQueries[index+1:]...)
+	tw.saveQueries()
+}
+
+// saveQueries は保存済みクエリを設定へ保存し、選択肢を更新する。
+func (tw *TreeViewWidget) saveQueries() {
+	if err := saveConfigList(tw.userConfig, userConfigKeySavedQueries, tw.savedQueries); err != nil && tw.logger != nil {
+		tw.logger.Warn("保存済みクエリの保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.refreshSavedQueryCombo()
+}
@@ -0,0 +1,301 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/walk/pkg/declarative"
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+const (
+	// maxScanDepth は走査階層上限として指定できる最大値を表す。
+	maxScanDepth = 99
+)
+
+// openScanRulesDialog は走査の除外条件を編集するダイアログを表示する。
+func (tw *TreeViewWidget) openScanRulesDialog() {
+	if tw == nil || tw.treeView == nil {
+		return
+	}
+	owner := tw.treeView.Form()
+	if owner == nil {
+		return
+	}
+	rules, kinds := tw.scanRulesSnapshot()
+	allKinds := filetype.Kinds()
+	kindChecks := make([]*walk.CheckBox, len(allKinds))
+	kindWidgets := make([]declarative.Widget, 0, len(allKinds))
+	for i, kind := range allKinds {
+		kindWidgets = append(kindWidgets, declarative.CheckBox{
+			AssignTo: &kindChecks[i],
+			Text:     i18n.TranslateOrMark(tw.translator, kindLabelKey(kind)),
+			Checked:  containsKind(kinds, kind),
+		})
+	}
+
+	var dlg *walk.Dialog
+	var acceptButton *walk.PushButton
+	var cancelButton *walk.PushButton
+	fields := &scanRulesFields{}
+	children := []declarative.Widget{
+		declarative.TextLabel{
+			Text: i18n.TranslateOrMark(tw.translator, messages.LabelVisibleKinds),
+		},
+		declarative.Composite{
+			Layout:   declarative.Grid{Columns: 4},
+			Children: kindWidgets,
+		},
+	}
+	children = append(children, fields.widgets(tw.translator, rules)...)
+	result, err := declarative.Dialog{
+		AssignTo:      &dlg,
+		Title:         i18n.TranslateOrMark(tw.translator, messages.LabelScanRules),
+		MinSize:       declarative.Size{Width: 480, Height: 420},
+		Layout:        declarative.VBox{},
+		DefaultButton: &acceptButton,
+		CancelButton:  &cancelButton,
+		Children: append(children,
+			declarative.TextLabel{
+				Text: fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelScanIgnoreFileTip), scanner.IgnoreFileName),
+			},
+			declarative.Composite{
+				Layout: declarative.HBox{MarginsZero: true},
+				Children: []declarative.Widget{
+					declarative.HSpacer{},
+					declarative.PushButton{
+						AssignTo: &acceptButton,
+						Text:     i18n.TranslateOrMark(tw.translator, "OK"),
+						OnClicked: func() {
+							dlg.Accept()
+						},
+					},
+					declarative.PushButton{
+						AssignTo: &cancelButton,
+						Text:     i18n.TranslateOrMark(tw.translator, "キャンセル"),
+						OnClicked: func() {
+							dlg.Cancel()
+						},
+					},
+				},
+			},
+		),
+	}.Run(owner)
+	if err != nil {
+		if tw.logger != nil {
+			tw.logger.Warn("走査条件ダイアログの表示に失敗しました: %s", err.Error())
+		}
+		return
+	}
+	if result != walk.DlgCmdOK {
+		return
+	}
+	updated := fields.rules()
+	var updatedKinds []filetype.Kind
+	for i, kind := range allKinds {
+		if kindChecks[i] != nil && kindChecks[i].Checked() {
+			updatedKinds = append(updatedKinds, kind)
+		}
+	}
+	if len(updatedKinds) == 0 {
+		// 何も表示しない設定は無意味なため既定に戻す。
+		updatedKinds = filetype.DefaultVisibleKinds()
+	}
+	if sameScanRules(rules, updated) && sameKinds(kinds, updatedKinds) {
+		return
+	}
+	tw.applyScanRules(updated, updatedKinds)
+}
+
+// scanRulesFields は走査の除外条件の入力欄を表す。
+type scanRulesFields struct {
+	includeEdit *walk.TextEdit
+	excludeEdit *walk.TextEdit
+	depthEdit   *walk.NumberEdit
+	hiddenCheck *walk.CheckBox
+	linksCheck  *walk.CheckBox
+}
+
+// widgets は除外条件の入力欄を生成する。
+func (f *scanRulesFields) widgets(translator i18n.II18n, rules scanner.Rules) []declarative.Widget {
+	return []declarative.Widget{
+		declarative.TextLabel{
+			Text: i18n.TranslateOrMark(translator, messages.LabelScanInclude),
+		},
+		declarative.TextEdit{
+			AssignTo:    &f.includeEdit,
+			Text:        strings.Join(rules.Include, "\r\n"),
+			ToolTipText: i18n.TranslateOrMark(translator, messages.LabelScanPatternTip),
+			VScroll:     true,
+			MinSize:     declarative.Size{Width: 460, Height: 90},
+		},
+		declarative.TextLabel{
+			Text: i18n.TranslateOrMark(translator, messages.LabelScanExclude),
+		},
+		declarative.TextEdit{
+			AssignTo:    &f.excludeEdit,
+			Text:        strings.Join(rules.Exclude, "\r\n"),
+			ToolTipText: i18n.TranslateOrMark(translator, messages.LabelScanPatternTip),
+			VScroll:     true,
+			MinSize:     declarative.Size{Width: 460, Height: 90},
+		},
+		declarative.Composite{
+			Layout: declarative.HBox{MarginsZero: true},
+			Children: []declarative.Widget{
+				declarative.TextLabel{
+					Text: i18n.TranslateOrMark(translator, messages.LabelScanMaxDepth),
+				},
+				declarative.NumberEdit{
+					AssignTo: &f.depthEdit,
+					Value:    float64(rules.MaxDepth),
+					MinValue: 0,
+					MaxValue: maxScanDepth,
+					Decimals: 0,
+					MinSize:  declarative.Size{Width: 60},
+					MaxSize:  declarative.Size{Width: 60},
+				},
+				declarative.HSpacer{},
+			},
+		},
+		declarative.CheckBox{
+			AssignTo: &f.hiddenCheck,
+			Text:     i18n.TranslateOrMark(translator, messages.LabelScanSkipHidden),
+			Checked:  rules.SkipHidden,
+		},
+		declarative.CheckBox{
+			AssignTo: &f.linksCheck,
+			Text:     i18n.TranslateOrMark(translator, messages.LabelScanFollowLinks),
+			Checked:  rules.FollowLinks,
+		},
+	}
+}
+
+// setEnabled は入力欄の有効状態を切り替える。
+func (f *scanRulesFields) setEnabled(enabled bool) {
+	if f.includeEdit != nil {
+		f.includeEdit.SetEnabled(enabled)
+	}
+	if f.excludeEdit != nil {
+		f.excludeEdit.SetEnabled(enabled)
+	}
+	if f.depthEdit != nil {
+		f.depthEdit.SetEnabled(enabled)
+	}
+	if f.hiddenCheck != nil {
+		f.hiddenCheck.SetEnabled(enabled)
+	}
+	if f.linksCheck != nil {
+		f.linksCheck.SetEnabled(enabled)
+	}
+}
+
+// rules は入力欄の内容を除外条件に変換する。
+func (f *scanRulesFields) rules() scanner.Rules {
+	return scanner.Rules{
+		Include:     splitPatternLines(f.includeEdit.Text()),
+		Exclude:     splitPatternLines(f.excludeEdit.Text()),
+		MaxDepth:    int(f.depthEdit.Value()),
+		SkipHidden:  f.hiddenCheck.Checked(),
+		FollowLinks: f.linksCheck.Checked(),
+	}
+}
+
+// containsKind は種別一覧に指定種別が含まれるか判定する。
+func containsKind(kinds []filetype.Kind, kind filetype.Kind) bool {
+	for _, candidate := range kinds {
+		if candidate == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sameKinds は種別一覧が同一か判定する。
+func sameKinds(a []filetype.Kind, b []filetype.Kind) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPatternLines は複数行の入力をパターン一覧に分割する。
+func splitPatternLines(text string) []string {
+	var patterns []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// sameScanRules は走査の除外条件が同一か判定する。
+func sameScanRules(a scanner.Rules, b scanner.Rules) bool {
+	return a.MaxDepth == b.MaxDepth && a.SkipHidden == b.SkipHidden && a.FollowLinks == b.FollowLinks &&
+		sameStringSlice(a.Include, b.Include) && sameStringSlice(a.Exclude, b.Exclude)
+}
+
+// handleContextExclusions はコンテキストメニューの除外内訳を表示する。
+func (tw *TreeViewWidget) handleContextExclusions() {
+	if tw == nil || tw.contextPath == "" || tw.model == nil || tw.treeView == nil {
+		return
+	}
+	rootPath := findRootPathOf(tw.model.rootPaths, tw.contextPath)
+	root := tw.model.findRoot(rootPath)
+	if root == nil {
+		return
+	}
+	walk.MsgBox(tw.treeView.Form(),
+		i18n.TranslateOrMark(tw.translator, messages.LabelExclusions),
+		tw.formatExclusions(root.filter),
+		walk.MsgBoxIconInformation)
+}
+
+// formatExclusions は除外理由ごとの件数を表示用の文字列にする。
+func (tw *TreeViewWidget) formatExclusions(filter *scanner.Filter) string {
+	exclusions := filter.Exclusions()
+	if len(exclusions) == 0 {
+		return i18n.TranslateOrMark(tw.translator, messages.LabelExclusionsEmpty)
+	}
+	lines := []string{
+		fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelExclusionsTotal), filter.ExcludedCount()),
+	}
+	for _, exclusion := range exclusions {
+		lines = append(lines, fmt.Sprintf("%s: %d", tw.exclusionLabel(exclusion), exclusion.Count))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// exclusionLabel は除外理由の表示名を返す。
+func (tw *TreeViewWidget) exclusionLabel(exclusion scanner.Exclusion) string {
+	switch exclusion.Kind {
+	case scanner.ExcludeByIgnoreFile:
+		return fmt.Sprintf("%s (%s)", exclusion.Pattern, exclusion.Source)
+	case scanner.ExcludeByPattern:
+		return fmt.Sprintf("%s (%s)", exclusion.Pattern, i18n.TranslateOrMark(tw.translator, messages.LabelScanExclude))
+	case scanner.ExcludeByInclude:
+		return i18n.TranslateOrMark(tw.translator, messages.LabelScanInclude)
+	case scanner.ExcludeByDepth:
+		return i18n.TranslateOrMark(tw.translator, messages.LabelScanMaxDepth)
+	case scanner.ExcludeByHidden:
+		return i18n.TranslateOrMark(tw.translator, messages.LabelScanSkipHidden)
+	default:
+		return exclusion.Pattern
+	}
+}
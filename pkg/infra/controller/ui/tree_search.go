@@ -0,0 +1,249 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+)
+
+const (
+	// searchDelay は入力が止まってから絞り込むまでの待ち時間を表す。
+	searchDelay = 200 * time.Millisecond
+	// matchOpen は表示名の一致箇所の前に付ける印を表す。
+	matchOpen = "«"
+	// matchClose は表示名の一致箇所の後に付ける印を表す。
+	matchClose = "»"
+)
+
+// searchMode は絞り込み文字列の解釈を表す。
+type searchMode string
+
+const (
+	// searchSubstring は部分一致で絞り込む。
+	searchSubstring searchMode = "substring"
+	// searchGlob はワイルドカード(*, ?)でファイル名全体と照合する。
+	searchGlob searchMode = "glob"
+	// searchRegex は正規表現で絞り込む。
+	searchRegex searchMode = "regex"
+	// searchQuery はモデルの情報に対するクエリで絞り込む。
+	searchQuery searchMode = "query"
+)
+
+// searchModes は選択できる絞り込み方法を表示順で返す。
+func searchModes() []searchMode {
+	return []searchMode{searchSubstring, searchGlob, searchRegex, searchQuery}
+}
+
+// parseSearchMode は設定値を絞り込み方法に変換する。不明な値は部分一致とする。
+func parseSearchMode(value string) searchMode {
+	for _, mode := range searchModes() {
+		if string(mode) == value {
+			return mode
+		}
+	}
+	return searchSubstring
+}
+
+// searchModeLabelKey は絞り込み方法の表示名のキーを返す。
+func searchModeLabelKey(mode searchMode) string {
+	switch mode {
+	case searchGlob:
+		return messages.LabelSearchGlob
+	case searchRegex:
+		return messages.LabelSearchRegex
+	case searchQuery:
+		return messages.LabelSearchQuery
+	default:
+		return messages.LabelSearchSubstring
+	}
+}
+
+// textMatcher はファイルノードの表示名と絞り込み文字列を照合する。大文字小文字は区別しない。
+type textMatcher struct {
+	pattern *regexp.Regexp
+	// nameOnly はファイル名のみと照合するか。ワイルドカードの場合に使う。
+	nameOnly bool
+}
+
+// newTextMatcher は絞り込み文字列から照合条件を生成する。空文字の場合はnilを返す。
+func newTextMatcher(mode searchMode, text string) (*textMatcher, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	switch mode {
+	case searchGlob:
+		return &textMatcher{pattern: regexp.MustCompile("(?i)^" + globToRegexp(text) + "$"), nameOnly: true}, nil
+	case searchRegex:
+		pattern, err := regexp.Compile("(?i)" + text)
+		if err != nil {
+			return nil, err
+		}
+		return &textMatcher{pattern: pattern}, nil
+	default:
+		return &textMatcher{pattern: regexp.MustCompile("(?i)" + regexp.QuoteMeta(text))}, nil
+	}
+}
+
+// globToRegexp はワイルドカードを正規表現に変換する。
+func globToRegexp(glob string) string {
+	var builder strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return builder.String()
+}
+
+// match はノードの表示名と照合し、一致箇所の開始・終了位置を返す。
+func (m *textMatcher) match(node *TreeNode) ([]int, bool) {
+	if m.nameOnly {
+		if !m.pattern.MatchString(node.name) {
+			return nil, false
+		}
+		// 表示名の中のファイル名の位置を一致箇所とする。
+		start := strings.LastIndex(node.baseText(), node.name)
+		return []int{start, start + len(node.name)}, true
+	}
+	loc := m.pattern.FindStringIndex(node.baseText())
+	if loc == nil || loc[0] == loc[1] {
+		return nil, loc != nil
+	}
+	return loc, true
+}
+
+// highlighted は一致箇所に印を付けた表示名を返す。
+func (n *TreeNode) highlighted(text string) string {
+	if len(n.match) != 2 || n.match[0] < 0 || n.match[1] > len(text) || n.match[0] >= n.match[1] {
+		return text
+	}
+	return text[:n.match[0]] + matchOpen + text[n.match[0]:n.match[1]] + matchClose + text[n.match[1]:]
+}
+
+// handleSearchChanged は入力が止まった後に絞り込み文字列を反映する。
+func (tw *TreeViewWidget) handleSearchChanged() {
+	if tw == nil || tw.searchEdit == nil {
+		return
+	}
+	tw.searchSeq++
+	seq := tw.searchSeq
+	time.AfterFunc(searchDelay, func() {
+		tw.synchronize(func() {
+			if seq != tw.searchSeq {
+				return
+			}
+			tw.applySearch()
+		})
+	})
+}
+
+// handleSearchKeyDown はEscキーで絞り込み文字列を消す。
+func (tw *TreeViewWidget) handleSearchKeyDown(key walk.Key) {
+	if tw == nil || tw.searchEdit == nil || key != walk.KeyEscape {
+		return
+	}
+	_ = tw.searchEdit.SetText("")
+}
+
+// handleSearchModeChanged は絞り込み方法の変更を保存して絞り込み直す。
+func (tw *TreeViewWidget) handleSearchModeChanged() {
+	if tw == nil || tw.searchModeCombo == nil {
+		return
+	}
+	index := tw.searchModeCombo.CurrentIndex()
+	modes := searchModes()
+	if index < 0 || index >= len(modes) || modes[index] == tw.searchMode {
+		return
+	}
+	tw.searchMode = modes[index]
+	tw.updateSearchCueBanner()
+	if err := saveConfigString(tw.userConfig, userConfigKeyTreeSearchMode, string(tw.searchMode)); err != nil && tw.logger != nil {
+		tw.logger.Warn("ツリー表示設定の保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+	tw.applySearch()
+}
+
+// applySearch は入力中の絞り込み文字列で照合条件を作り直し、ツリーを絞り込む。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applySearch() {
+	if tw == nil || tw.searchEdit == nil {
+		return
+	}
+	if tw.searchMode == searchQuery {
+		tw.applyQuery(tw.searchEdit.Text())
+		return
+	}
+	matcher, err := newTextMatcher(tw.searchMode, tw.searchEdit.Text())
+	if err != nil {
+		// 入力途中の不正な正規表現では直前の絞り込みを維持する。
+		tw.setSearchError(err.Error())
+		return
+	}
+	tw.setSearchError("")
+	tw.searchMatcher = matcher
+	tw.setSearchQuery(nil)
+	tw.refreshFilter()
+}
+
+// searchCueBanner は絞り込み方法に応じた入力欄の説明を返す。
+func (tw *TreeViewWidget) searchCueBanner() string {
+	if tw.searchMode == searchQuery {
+		return i18n.TranslateOrMark(tw.translator, messages.LabelQueryTip)
+	}
+	return i18n.TranslateOrMark(tw.translator, messages.LabelSearchTip)
+}
+
+// updateSearchCueBanner は絞り込み方法に合わせて入力欄の説明を切り替える。
+func (tw *TreeViewWidget) updateSearchCueBanner() {
+	if tw.searchEdit == nil {
+		return
+	}
+	_ = tw.searchEdit.SetCueBanner(tw.searchCueBanner())
+}
+
+// setSearchError は絞り込み文字列の誤りを表示する。空文字の場合は表示を消す。
+func (tw *TreeViewWidget) setSearchError(message string) {
+	tw.searchFailed = message != ""
+	if tw.searchError == nil {
+		return
+	}
+	if message != "" {
+		message = i18n.TranslateOrMark(tw.translator, messages.LabelSearchInvalid) + ": " + message
+	}
+	_ = tw.searchError.SetText(message)
+}
+
+// searchModeLabels は絞り込み方法の選択肢の表示名を返す。
+func (tw *TreeViewWidget) searchModeLabels() []string {
+	modes := searchModes()
+	labels := make([]string, len(modes))
+	for i, mode := range modes {
+		labels[i] = i18n.TranslateOrMark(tw.translator, searchModeLabelKey(mode))
+	}
+	return labels
+}
+
+// searchModeIndex は現在の絞り込み方法の選択肢の位置を返す。
+func (tw *TreeViewWidget) searchModeIndex() int {
+	for i, mode := range searchModes() {
+		if mode == tw.searchMode {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,240 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+)
+
+// sortMode はツリーの並び順の種類を表す。
+type sortMode string
+
+const (
+	// sortByNatural は名前の数字部分を数値として比較する並び順を表す。
+	sortByNatural sortMode = "natural"
+	// sortByJapanese はかな・全角半角の違いを同一視し、数字部分を数値として比較する並び順を表す。
+	sortByJapanese sortMode = "japanese"
+	// sortByModified は更新日時の新しい順を表す。
+	sortByModified sortMode = "modified"
+	// sortBySize はファイルサイズの大きい順を表す。
+	sortBySize sortMode = "size"
+	// sortByModelName はPMX・PMDのモデル名順を表す。
+	sortByModelName sortMode = "model_name"
+	// defaultSortMode は既定の並び順を表す。
+	defaultSortMode = sortByJapanese
+)
+
+// sortModes は選択できる並び順を表示順で返す。
+func sortModes() []sortMode {
+	return []sortMode{sortByJapanese, sortByNatural, sortByModified, sortBySize, sortByModelName}
+}
+
+// parseSortMode は設定値を並び順に変換する。不明な値は既定の並び順とする。
+func parseSortMode(value string) sortMode {
+	for _, mode := range sortModes() {
+		if string(mode) == value {
+			return mode
+		}
+	}
+	return defaultSortMode
+}
+
+// sortModeLabelKey は並び順の表示名のキーを返す。
+func sortModeLabelKey(mode sortMode) string {
+	switch mode {
+	case sortByNatural:
+		return messages.LabelSortNatural
+	case sortByModified:
+		return messages.LabelSortModified
+	case sortBySize:
+		return messages.LabelSortSize
+	case sortByModelName:
+		return messages.LabelSortModelName
+	default:
+		return messages.LabelSortJapanese
+	}
+}
+
+// nodeOrder はツリーの子ノードの並び順を表す。
+type nodeOrder struct {
+	mode sortMode
+	// foldersFirst はフォルダをファイルより先に並べるか。
+	foldersFirst bool
+	// modelName はモデル名順で使うモデル名を返す。nilまたは空文字の場合はファイル名で比較する。
+	modelName func(path string) string
+}
+
+// nodeSortKey はノードごとに一度だけ求める並び替え用の値を表す。
+type nodeSortKey struct {
+	name      string
+	modelName string
+	modTime   int64
+	size      int64
+}
+
+// usesFileInfo は並び順がファイルの更新日時・サイズを使うか判定する。
+func (o nodeOrder) usesFileInfo() bool {
+	return o.mode == sortByModified || o.mode == sortBySize
+}
+
+// less はノードの表示順を判定する。
+func (o nodeOrder) less(a, b *TreeNode) bool {
+	if o.foldersFirst && a.isDir != b.isDir {
+		return a.isDir
+	}
+	keyA := o.key(a)
+	keyB := o.key(b)
+	switch o.mode {
+	case sortByModified:
+		if keyA.modTime != keyB.modTime {
+			return keyA.modTime > keyB.modTime
+		}
+	case sortBySize:
+		if keyA.size != keyB.size {
+			return keyA.size > keyB.size
+		}
+	case sortByModelName:
+		if cmp := compareNatural(keyA.modelName, keyB.modelName); cmp != 0 {
+			return cmp < 0
+		}
+	}
+	if cmp := compareNatural(keyA.name, keyB.name); cmp != 0 {
+		return cmp < 0
+	}
+	return strings.ToLower(a.name) < strings.ToLower(b.name)
+}
+
+// key はノードの並び替え用の値を返す。更新日時・サイズ・モデル名は必要な並び順の場合のみ読み込む。
+func (o nodeOrder) key(n *TreeNode) *nodeSortKey {
+	if n.sortKey != nil {
+		return n.sortKey
+	}
+	key := &nodeSortKey{name: o.normalize(n.name)}
+	switch o.mode {
+	case sortByModified, sortBySize:
+		// アーカイブ内のエントリ・フォルダはアーカイブの内容から求める。
+		if info, err := archive.Stat(n.fullPath); err == nil {
+			key.modTime = info.ModTime().UnixNano()
+			if !info.IsDir() {
+				key.size = info.Size()
+			}
+		}
+	case sortByModelName:
+		key.modelName = key.name
+		if !n.isDir && o.modelName != nil {
+			if name := o.modelName(n.fullPath); name != "" {
+				key.modelName = o.normalize(name)
+			}
+		}
+	}
+	n.sortKey = key
+	return key
+}
+
+// normalize は並び順に応じて名前を比較用に正規化する。
+func (o nodeOrder) normalize(name string) string {
+	if o.mode == sortByNatural {
+		return strings.ToLower(name)
+	}
+	return foldJapanese(name)
+}
+
+// foldJapanese は全角・半角とひらがな・カタカナの違いを同一視する形に変換する。
+func foldJapanese(value string) string {
+	// NFKCで全角英数字と半角カナ(濁点を含む)を統一する。
+	folded := norm.NFKC.String(value)
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			// カタカナはひらがなに揃える。
+			return r - ('ァ' - 'ぁ')
+		}
+		return unicode.ToLower(r)
+	}, folded)
+}
+
+// compareNatural は数字部分を数値として比較する。
+func compareNatural(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if isDigit(ra[i]) && isDigit(rb[j]) {
+			startA, startB := i, j
+			for i < len(ra) && isDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && isDigit(rb[j]) {
+				j++
+			}
+			if cmp := compareDigits(ra[startA:i], rb[startB:j]); cmp != 0 {
+				return cmp
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			if ra[i] < rb[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+	switch {
+	case len(ra)-i < len(rb)-j:
+		return -1
+	case len(ra)-i > len(rb)-j:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareDigits は数字列を数値として比較する。同値の場合は先頭の0が少ない方を先にする。
+func compareDigits(a, b []rune) int {
+	trimmedA := trimLeadingZeros(a)
+	trimmedB := trimLeadingZeros(b)
+	if len(trimmedA) != len(trimmedB) {
+		if len(trimmedA) < len(trimmedB) {
+			return -1
+		}
+		return 1
+	}
+	for k := range trimmedA {
+		if trimmedA[k] != trimmedB[k] {
+			if trimmedA[k] < trimmedB[k] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// trimLeadingZeros は数字列の先頭の0を取り除く。
+func trimLeadingZeros(digits []rune) []rune {
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
+// isDigit は半角数字か判定する。全角数字は正規化で半角に揃える。
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
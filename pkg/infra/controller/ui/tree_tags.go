@@ -0,0 +1,353 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/walk/pkg/declarative"
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+const (
+	// tagChipPrefix はタグの表示名に付ける印を表す。
+	tagChipPrefix = "#"
+	// noteMarker はメモがあるモデルの表示名に付ける印を表す。
+	noteMarker = "✎"
+)
+
+// modelTagResult はバックグラウンドで読み込んだタグとメモを表す。
+type modelTagResult struct {
+	node *TreeNode
+	tags minteractor.ModelTags
+}
+
+// tagChips はファイルノードの表示名に付けるタグとメモの印を返す。
+func (n *TreeNode) tagChips() string {
+	if n == nil || (len(n.tags) == 0 && !n.hasNote) {
+		return ""
+	}
+	var builder strings.Builder
+	for _, tag := range n.tags {
+		builder.WriteString(" ")
+		builder.WriteString(tagChipPrefix)
+		builder.WriteString(tag)
+	}
+	if n.hasNote {
+		builder.WriteString(" ")
+		builder.WriteString(noteMarker)
+	}
+	return builder.String()
+}
+
+// setTags はタグとメモの印を設定する。表示が変わったか返す。
+func (n *TreeNode) setTags(tags minteractor.ModelTags) bool {
+	hasNote := strings.TrimSpace(tags.Note) != ""
+	if n.hasNote == hasNote && strings.Join(n.tags, "\n") == strings.Join(tags.Tags, "\n") {
+		return false
+	}
+	n.tags = tags.Tags
+	n.hasNote = hasNote
+	return true
+}
+
+// setTagUsecase はタグとメモの管理処理を設定する。
+func (tw *TreeViewWidget) setTagUsecase(usecase *minteractor.ModelTagUsecase) {
+	if tw == nil {
+		return
+	}
+	tw.tagUsecase = usecase
+}
+
+// refreshModelTags はツリー全体のファイルノードのタグを読み込み直す。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) refreshModelTags() {
+	if tw == nil || tw.model == nil || tw.tagUsecase == nil {
+		return
+	}
+	tw.tagSeq++
+	var nodes []*TreeNode
+	stack := append(append([]*TreeNode{}, tw.model.roots...), tw.model.pinnedRoots()...)
+	for len(stack) > 0 {
+		last := len(stack) - 1
+		node := stack[last]
+		stack = stack[:last]
+		if node == nil {
+			continue
+		}
+		if node.IsDir() {
+			// 未探索のフォルダは展開時にタグを読み込む。
+			if !node.isLazy() {
+				stack = append(stack, node.children...)
+			}
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	tw.requestModelTags(nodes)
+}
+
+// requestModelTags は指定ノードのタグをバックグラウンドで読み込む。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) requestModelTags(nodes []*TreeNode) {
+	if tw == nil || tw.model == nil || tw.tagUsecase == nil || len(nodes) == 0 {
+		return
+	}
+	pending := make([]*TreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node != nil && node.Kind() == filetype.KindModel && node.status == "" {
+			pending = append(pending, node)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	go tw.loadModelTags(tw.tagSeq, pending)
+}
+
+// loadModelTags はタグをバックグラウンドで読み込み、一定件数ごとにツリーへ反映する。
+func (tw *TreeViewWidget) loadModelTags(seq uint64, nodes []*TreeNode) {
+	jobs := make(chan *TreeNode)
+	results := make(chan modelTagResult, modelLabelBatchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < modelLabelWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range jobs {
+				tags, err := tw.tagUsecase.Lookup(node.fullPath)
+				if err != nil && tw.logger != nil {
+					tw.logger.Debug("タグの読み込みに失敗しました: %s (%s)", node.fullPath, err.Error())
+				}
+				results <- modelTagResult{node: node, tags: tags}
+			}
+		}()
+	}
+	go func() {
+		for _, node := range nodes {
+			jobs <- node
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	batch := make([]modelTagResult, 0, modelLabelBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		applied := batch
+		batch = make([]modelTagResult, 0, modelLabelBatchSize)
+		tw.synchronize(func() {
+			tw.applyModelTags(seq, applied)
+		})
+	}
+	for result := range results {
+		batch = append(batch, result)
+		if len(batch) >= modelLabelBatchSize {
+			flush()
+		}
+	}
+	flush()
+	// 移動・編集を検出して更新した記録を保存する。
+	if err := tw.tagUsecase.Save(); err != nil && tw.logger != nil {
+		tw.logger.Warn("タグの保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+	}
+}
+
+// applyModelTags は読み込んだタグをノードへ反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyModelTags(seq uint64, results []modelTagResult) {
+	if tw == nil || tw.model == nil || seq != tw.tagSeq {
+		// ツリーが切り替わった後の結果は破棄する。
+		return
+	}
+	changed := false
+	for _, result := range results {
+		if !result.node.setTags(result.tags) {
+			continue
+		}
+		changed = true
+		tw.model.PublishItemChanged(result.node)
+	}
+	if changed && (tw.tagFilter != "" || tw.searchQuery != nil) {
+		// クエリはタグとも照合するため絞り込み直す。
+		tw.refreshFilter()
+	}
+}
+
+// handleContextTags はコンテキストメニューの対象モデルのタグとメモを編集する。
+func (tw *TreeViewWidget) handleContextTags() {
+	if tw == nil || tw.contextPath == "" || tw.contextIsDir || tw.tagUsecase == nil || tw.treeView == nil {
+		return
+	}
+	path := tw.contextPath
+	current, err := tw.tagUsecase.Lookup(path)
+	if err != nil {
+		tw.logger.Warn("タグの読み込みに失敗しました: %s", logging.FormatError(err, tw.logger))
+		return
+	}
+	updated, ok := tw.openTagsDialog(path, current)
+	if !ok {
+		return
+	}
+	if err := tw.tagUsecase.SetTags(path, updated); err != nil {
+		tw.logger.Warn("タグの保存に失敗しました: %s", logging.FormatError(err, tw.logger))
+		return
+	}
+	saved, _ := tw.tagUsecase.Lookup(path)
+	tw.applyTagsToPath(path, saved)
+	tw.refreshTagCombo()
+	if tw.tagFilter != "" || tw.searchQuery != nil {
+		tw.refreshFilter()
+	}
+}
+
+// applyTagsToPath は指定パスのファイルノードへタグを反映する。お気に入りなど固定表示のルートのノードも対象にする。
+func (tw *TreeViewWidget) applyTagsToPath(path string, tags minteractor.ModelTags) {
+	roots := append(append([]*TreeNode{}, tw.model.roots...), tw.model.pinnedRoots()...)
+	for _, root := range roots {
+		node := findNodeByPath([]*TreeNode{root}, path)
+		if node == nil || node.IsDir() || !node.setTags(tags) {
+			continue
+		}
+		tw.model.PublishItemChanged(node)
+	}
+}
+
+// openTagsDialog はタグとメモの編集ダイアログを表示する。
+func (tw *TreeViewWidget) openTagsDialog(path string, current minteractor.ModelTags) (minteractor.ModelTags, bool) {
+	owner := tw.treeView.Form()
+	if owner == nil {
+		return current, false
+	}
+	var dlg *walk.Dialog
+	var tagsEdit *walk.LineEdit
+	var noteEdit *walk.TextEdit
+	var acceptButton *walk.PushButton
+	var cancelButton *walk.PushButton
+	updated := current
+	children := []declarative.Widget{
+		declarative.TextLabel{
+			Text: path,
+		},
+		declarative.TextLabel{
+			Text: i18n.TranslateOrMark(tw.translator, messages.LabelTags),
+		},
+		declarative.LineEdit{
+			AssignTo:  &tagsEdit,
+			Text:      strings.Join(current.Tags, ", "),
+			CueBanner: i18n.TranslateOrMark(tw.translator, messages.LabelTagsTip),
+		},
+	}
+	if known := tw.tagUsecase.AllTags(); len(known) > 0 {
+		children = append(children, declarative.TextLabel{
+			Text: i18n.TranslateOrMark(tw.translator, messages.LabelTagsKnown) + " " + strings.Join(known, ", "),
+		})
+	}
+	children = append(children,
+		declarative.TextLabel{
+			Text: i18n.TranslateOrMark(tw.translator, messages.LabelNote),
+		},
+		declarative.TextEdit{
+			AssignTo: &noteEdit,
+			Text:     current.Note,
+			VScroll:  true,
+			MinSize:  declarative.Size{Width: 360, Height: 120},
+		},
+		declarative.Composite{
+			Layout: declarative.HBox{MarginsZero: true},
+			Children: []declarative.Widget{
+				declarative.HSpacer{},
+				declarative.PushButton{
+					AssignTo: &acceptButton,
+					Text:     i18n.TranslateOrMark(tw.translator, "OK"),
+					OnClicked: func() {
+						updated = minteractor.ModelTags{
+							Tags: minteractor.ParseTags(tagsEdit.Text()),
+							Note: noteEdit.Text(),
+						}
+						dlg.Accept()
+					},
+				},
+				declarative.PushButton{
+					AssignTo: &cancelButton,
+					Text:     i18n.TranslateOrMark(tw.translator, "キャンセル"),
+					OnClicked: func() {
+						dlg.Cancel()
+					},
+				},
+			},
+		},
+	)
+	result, err := declarative.Dialog{
+		AssignTo:      &dlg,
+		Title:         i18n.TranslateOrMark(tw.translator, messages.LabelTagsEdit),
+		MinSize:       declarative.Size{Width: 420, Height: 300},
+		Layout:        declarative.VBox{},
+		DefaultButton: &acceptButton,
+		CancelButton:  &cancelButton,
+		Children:      children,
+	}.Run(owner)
+	if err != nil {
+		tw.logger.Warn("タグ編集ダイアログの表示に失敗しました: %s", err.Error())
+		return current, false
+	}
+	return updated, result == walk.DlgCmdOK
+}
+
+// tagFilterLabels はタグ絞り込みの選択肢を返す。先頭は絞り込み無し。
+func (tw *TreeViewWidget) tagFilterLabels() []string {
+	labels := []string{i18n.TranslateOrMark(tw.translator, messages.LabelTagFilterAll)}
+	if tw.tagUsecase != nil {
+		labels = append(labels, tw.tagUsecase.AllTags()...)
+	}
+	return labels
+}
+
+// refreshTagCombo はタグ絞り込みの選択肢を記録済みのタグに合わせる。
+func (tw *TreeViewWidget) refreshTagCombo() {
+	if tw.tagCombo == nil {
+		return
+	}
+	labels := tw.tagFilterLabels()
+	index := 0
+	for i, label := range labels {
+		if i > 0 && strings.EqualFold(label, tw.tagFilter) {
+			index = i
+		}
+	}
+	tw.tagComboUpdating = true
+	defer func() {
+		tw.tagComboUpdating = false
+	}()
+	if err := tw.tagCombo.SetModel(labels); err != nil {
+		tw.logger.Warn("タグ一覧の更新に失敗しました: %s", logging.FormatError(err, tw.logger))
+		return
+	}
+	_ = tw.tagCombo.SetCurrentIndex(index)
+}
+
+// handleTagFilterChanged は選択したタグを持つモデルのみ表示するよう絞り込む。
+func (tw *TreeViewWidget) handleTagFilterChanged() {
+	if tw == nil || tw.tagCombo == nil || tw.tagComboUpdating {
+		return
+	}
+	tag := ""
+	if index := tw.tagCombo.CurrentIndex(); index > 0 {
+		tag = tw.tagCombo.Text()
+	}
+	if strings.EqualFold(tag, tw.tagFilter) {
+		return
+	}
+	tw.tagFilter = tag
+	tw.refreshFilter()
+}
@@ -0,0 +1,256 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
+)
+
+const (
+	// versionsLabelPrefix はバージョン整理のルートの表示名に付ける印を表す。
+	versionsLabelPrefix = "⎇ "
+	// versionProgressStep は読み込みの進捗を表示に反映する間隔(件数)を表す。
+	versionProgressStep = 50
+)
+
+// handleGroupVersions は全ルートのモデルを版の系統ごとにまとめる。整理中の場合は中止する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) handleGroupVersions() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	if tw.versionCancel != nil {
+		tw.versionCancel()
+		return
+	}
+	if len(tw.model.rootPaths) == 0 {
+		return
+	}
+	tw.versionSeq++
+	seq := tw.versionSeq
+	ctx, cancel := context.WithCancel(context.Background())
+	tw.versionCancel = cancel
+	tw.versionReport = ""
+	tw.setVersionButtonRunning(true)
+
+	root := NewTreeNode(versionsLabelPrefix+i18n.TranslateOrMark(tw.translator, messages.LabelVersions), "", nil, true)
+	root.status = i18n.TranslateOrMark(tw.translator, messages.LabelVersionsScanning)
+	tw.model.SetVersions(root)
+
+	roots := append([]string{}, tw.model.rootPaths...)
+	opts := make([]treeBuildOptions, len(roots))
+	for i, path := range roots {
+		opts[i] = tw.scanOptionsFor(path)
+	}
+	// ブックマークはUIスレッドで更新されるため、開始時点の内容で参照を判定する。
+	marked := make([]string, 0, len(tw.bookmarks))
+	for _, mark := range tw.bookmarks {
+		marked = append(marked, mark.Path)
+	}
+	go tw.groupVersions(ctx, seq, root, roots, opts, marked)
+}
+
+// groupVersions はルート配下のモデルを探索し、版の系統と参照されている旧版を求めて反映する。
+func (tw *TreeViewWidget) groupVersions(ctx context.Context, seq uint64, root *TreeNode, roots []string, opts []treeBuildOptions, marked []string) {
+	var paths []string
+	for i, path := range roots {
+		found, err := collectModelPaths(ctx, path, opts[i], nil)
+		if ctx.Err() != nil {
+			tw.synchronize(func() {
+				tw.applyVersions(seq, root, nil, nil, ctx.Err())
+			})
+			return
+		}
+		if err != nil && tw.logger != nil {
+			// 探索できなかったルートは飛ばして続ける。
+			tw.logger.Warn("バージョン整理の探索に失敗しました: %s", logging.FormatError(err, tw.logger))
+		}
+		paths = append(paths, found...)
+	}
+
+	reader := tw.currentMetadataReader()
+	format := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsReading)
+	candidates := make([]minteractor.VersionCandidate, 0, len(paths))
+	for i, path := range paths {
+		if ctx.Err() != nil {
+			tw.synchronize(func() {
+				tw.applyVersions(seq, root, nil, nil, ctx.Err())
+			})
+			return
+		}
+		candidate := minteractor.VersionCandidate{Path: path}
+		if names, ok := tw.lookupModelNames(path); ok {
+			candidate.ModelName = names.Name
+		}
+		if reader != nil {
+			if meta, _, err := tw.modelMetadata.load(path, false, reader); err == nil {
+				candidate.ModTime = meta.ModTime
+			}
+		}
+		candidates = append(candidates, candidate)
+		if done := i + 1; done%versionProgressStep == 0 || done == len(paths) {
+			status := fmt.Sprintf(format, done, len(paths))
+			tw.synchronize(func() {
+				if seq != tw.versionSeq {
+					return
+				}
+				root.status = status
+				tw.model.PublishItemChanged(root)
+			})
+		}
+	}
+
+	families := minteractor.GroupVersions(candidates)
+	references := minteractor.StaleReferences(families, func(path string) bool {
+		return tw.isVersionReferenced(path, marked)
+	})
+	tw.synchronize(func() {
+		tw.applyVersions(seq, root, families, references, ctx.Err())
+	})
+}
+
+// isVersionReferenced はモデルがブックマークされているか、タグ・メモが付いているか判定する。
+func (tw *TreeViewWidget) isVersionReferenced(path string, marked []string) bool {
+	for _, mark := range marked {
+		if sameFilePath(mark, path) {
+			return true
+		}
+	}
+	if tw.tagUsecase == nil {
+		return false
+	}
+	tags, err := tw.tagUsecase.Lookup(path)
+	return err == nil && !tags.IsEmpty()
+}
+
+// applyVersions は求めた版の系統をバージョン整理のルートへ反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyVersions(seq uint64, root *TreeNode, families []minteractor.VersionFamily, references []minteractor.VersionReference, err error) {
+	if tw == nil || tw.model == nil || seq != tw.versionSeq {
+		return
+	}
+	tw.versionCancel = nil
+	tw.setVersionButtonRunning(false)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			tw.model.SetVersions(nil)
+			return
+		}
+		tw.logger.Warn("バージョン整理に失敗しました: %s", logging.FormatError(err, tw.logger))
+		root.status = i18n.TranslateOrMark(tw.translator, messages.LabelVersionsFailed)
+		tw.model.PublishItemChanged(root)
+		return
+	}
+	stale := map[string]bool{}
+	for _, reference := range references {
+		for _, member := range reference.Stale {
+			stale[member.Path] = true
+		}
+	}
+	familyFormat := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsFamily)
+	referencedLabel := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsReferenced)
+	staleLabel := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsStale)
+	root.status = ""
+	root.children = nil
+	var files []*TreeNode
+	for _, family := range families {
+		familyNode := NewTreeNode(fmt.Sprintf(familyFormat, family.Name, tw.versionText(family.Newest()), len(family.Members)), "", root, true)
+		for _, member := range family.Members {
+			// 同名のファイルが並ぶため、版とフルパスを表示名にする。最新版が先頭になる。
+			file := NewTreeNode(tw.versionText(member)+"  "+member.Path, member.Path, familyNode, false)
+			if stale[member.Path] {
+				file.status = referencedLabel
+				familyNode.status = staleLabel
+			}
+			familyNode.addChild(file)
+			files = append(files, file)
+		}
+		root.addChild(familyNode)
+	}
+	if len(families) == 0 {
+		root.status = i18n.TranslateOrMark(tw.translator, messages.LabelVersionsNone)
+	} else {
+		root.summary = fmt.Sprintf(i18n.TranslateOrMark(tw.translator, messages.LabelVersionsSummary), len(families), len(references))
+	}
+	tw.versionReport = tw.formatVersionReport(references)
+	var changed []*TreeNode
+	root.updateCounts(&changed)
+	tw.model.SetVersions(root)
+	if tw.treeView != nil {
+		_ = tw.treeView.SetExpanded(root, true)
+	}
+	tw.requestModelLabels(files)
+	tw.requestModelTags(files)
+}
+
+// versionText は版の表示名を返す。版表記が無い場合はその旨を返す。
+func (tw *TreeViewWidget) versionText(member minteractor.VersionMember) string {
+	if member.Version.IsZero() {
+		return i18n.TranslateOrMark(tw.translator, messages.LabelVersionsUnversioned)
+	}
+	return member.Version.Text
+}
+
+// formatVersionReport は旧版が参照されている系統の一覧を、系統ごとに最新版と参照中の旧版を並べた文字列にする。
+func (tw *TreeViewWidget) formatVersionReport(references []minteractor.VersionReference) string {
+	if len(references) == 0 {
+		return ""
+	}
+	newestFormat := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsReportNewest)
+	staleFormat := i18n.TranslateOrMark(tw.translator, messages.LabelVersionsReportStale)
+	var lines []string
+	for _, reference := range references {
+		newest := reference.Family.Newest()
+		lines = append(lines, reference.Family.Name, fmt.Sprintf(newestFormat, tw.versionText(newest), newest.Path))
+		for _, member := range reference.Stale {
+			lines = append(lines, fmt.Sprintf(staleFormat, tw.versionText(member), member.Path))
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// setVersionButtonRunning はバージョン整理ボタンの表示を整理中・待機中に切り替える。
+func (tw *TreeViewWidget) setVersionButtonRunning(running bool) {
+	if tw.versionButton == nil {
+		return
+	}
+	key := messages.LabelVersionsFind
+	if running {
+		key = messages.LabelVersionsCancel
+	}
+	_ = tw.versionButton.SetText(i18n.TranslateOrMark(tw.translator, key))
+}
+
+// inVersions はノードがバージョン整理のルート配下にあるか判定する。
+func (tw *TreeViewWidget) inVersions(node *TreeNode) bool {
+	return tw.model != nil && tw.model.versions != nil && tw.model.pinnedRootOf(node) == tw.model.versions
+}
+
+// handleContextCopyReport は旧版が参照されている系統の一覧をコピーする。
+func (tw *TreeViewWidget) handleContextCopyReport() {
+	if tw == nil || tw.onCopyPath == nil || tw.versionReport == "" {
+		return
+	}
+	tw.onCopyPath(tw.versionReport)
+}
+
+// closeVersions はバージョン整理のルートを閉じる。整理中の場合は中止する。
+func (tw *TreeViewWidget) closeVersions() {
+	if tw.versionCancel != nil {
+		tw.versionCancel()
+		tw.versionCancel = nil
+		tw.setVersionButtonRunning(false)
+	}
+	tw.versionSeq++
+	tw.versionReport = ""
+	tw.model.SetVersions(nil)
+}
@@ -5,9 +5,14 @@
 package ui
 
 import (
+	"context"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miu200521358/mlib_go/pkg/infra/controller"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
 	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
 	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
 	"github.com/miu200521358/walk/pkg/declarative"
@@ -15,6 +20,9 @@ import (
 	"github.com/miu200521358/win"
 
 	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/minteractor"
 )
 
 // TreeViewWidget はツリービュー表示のウィジェットを表す。
@@ -30,14 +38,108 @@ type TreeViewWidget struct {
 	contextPath       string
 	contextCopy       *walk.Action
 	contextScreenshot *walk.Action
+	contextSlideshow  *walk.Action
+	contextRescan     *walk.Action
+	contextExclusions *walk.Action
+	contextBookmark   *walk.Action
+	contextUnbookmark *walk.Action
+	contextTags       *walk.Action
+	contextOpenDir    *walk.Action
+	contextCopyGroup  *walk.Action
+	contextReport     *walk.Action
+	contextForget     *walk.Action
+	contextClose      *walk.Action
+	contextNode       *TreeNode
 	contextIsDir      bool
 	lastSelected      string
 	pendingKey        walk.Key
 	pendingBase       string
 	pendingActive     bool
+	pendingNode       *TreeNode
+	pendingCtrl       bool
 	onFileSelected    func(string)
 	onCopyPath        func(string)
 	onScreenshotSave  func(string, bool)
+	onSlideshow       func(string)
+	progressComposite *walk.Composite
+	progressBar       *walk.ProgressBar
+	progressLabel     *walk.TextLabel
+	cancelButton      *walk.PushButton
+	buildMu           sync.Mutex
+	buildSeq          uint64
+	buildCancel       context.CancelFunc
+	buildDone         func(TreeBuildResult)
+	scanIndex         *scanner.Index
+	scanIndexOnce     sync.Once
+	watchers          []*scanner.Watcher
+	watchSeq          uint64
+	silentSelect      bool
+	userConfig        config.IUserConfig
+	lazyMode          bool
+	lazyCheck         *walk.CheckBox
+	compactMode       bool
+	compactCheck      *walk.CheckBox
+	sortMode          sortMode
+	sortCombo         *walk.ComboBox
+	foldersFirst      bool
+	foldersFirstCheck *walk.CheckBox
+	modelNameReader   func(path string) (minteractor.ModelNames, error)
+	modelNames        *modelNameCache
+	labelMode         labelMode
+	labelCombo        *walk.ComboBox
+	labelSeq          uint64
+	scanRules         scanner.Rules
+	visibleKinds      []filetype.Kind
+	rootOptions       map[string]rootOptions
+	kindHandlers      map[filetype.Kind]kindHandler
+	kindActions       []*walk.Action
+	bookmarks         []bookmark
+	favoritesRoot     *TreeNode
+	tagUsecase        *minteractor.ModelTagUsecase
+	tagSeq            uint64
+	tagFilter         string
+	tagCombo          *walk.ComboBox
+	tagComboUpdating  bool
+	searchEdit        *walk.LineEdit
+	searchModeCombo   *walk.ComboBox
+	searchError       *walk.TextLabel
+	searchMode        searchMode
+	searchMatcher     *textMatcher
+	searchSeq         uint64
+	searchFailed      bool
+	preFilterState    *treeViewState
+	metadataReader    func(path string, withHeader bool) (minteractor.ModelMetadata, error)
+	modelMetadata     *modelMetadataCache
+	searchQuery       *minteractor.Query
+	querySeq          uint64
+	queryPending      int
+	queryUnreadable   map[string]struct{}
+	queryHeaderErr    error
+	savedQueries      []string
+	savedQueryCombo   *walk.ComboBox
+	savedQueryBusy    bool
+	duplicateUsecase  *minteractor.DuplicateUsecase
+	duplicateCancel   context.CancelFunc
+	duplicateSeq      uint64
+	duplicateButton   *walk.PushButton
+	versionCancel     context.CancelFunc
+	versionSeq        uint64
+	versionButton     *walk.PushButton
+	versionReport     string
+	recent            []string
+	recentRoot        *TreeNode
+	recentSeq         uint64
+	recentPending     bool
+	history           []string
+	historyIndex      int
+	navigating        bool
+	origWndProc       uintptr
+	navigationProc    uintptr
+	mainWindow        win.HWND
+	mainWindowProc    uintptr
+	origMainWndProc   uintptr
+	typeAhead         string
+	typeAheadAt       time.Time
 }
 
 // NewTreeViewWidget はTreeViewWidgetを生成する。
@@ -45,14 +147,21 @@ func NewTreeViewWidget(translator i18n.II18n, logger logging.ILogger, onFileSele
 	if logger == nil {
 		logger = logging.DefaultLogger()
 	}
-	return &TreeViewWidget{
+	tw := &TreeViewWidget{
 		translator:       translator,
 		logger:           logger,
 		model:            NewTreeModel(),
 		onFileSelected:   onFileSelected,
 		onCopyPath:       onCopyPath,
 		onScreenshotSave: onScreenshotSave,
-	}
+		sortMode:         defaultSortMode,
+		searchMode:       searchSubstring,
+		modelNames:       newModelNameCache(),
+		modelMetadata:    newModelMetadataCache(),
+		labelMode:        labelByFileName,
+	}
+	tw.registerKindHandler(filetype.KindModel, kindHandler{onSelect: onFileSelected})
+	return tw
 }
 
 // SetMinSize は最小サイズを設定する。
@@ -79,7 +188,7 @@ func (tw *TreeViewWidget) SetStretchFactor(factor int) {
 	tw.stretchFactor = factor
 }
 
-// SetWindow はウィンドウ参照を設定する（TreeViewは未使用）。
+// SetWindow はウィンドウ参照を設定する（TreeViewは未使用）。戻る・進む操作の受け付けもここで開始する。
 func (tw *TreeViewWidget) SetWindow(_ *controller.ControlWindow) {
 	if tw == nil {
 		return
@@ -87,6 +196,7 @@ func (tw *TreeViewWidget) SetWindow(_ *controller.ControlWindow) {
 	if tw.container != nil {
 		tw.container.Synchronize(func() {
 			tw.updateLayout()
+			tw.installNavigationHook()
 		})
 	}
 }
@@ -162,32 +272,6 @@ func (tw *TreeViewWidget) canRestoreFocus() bool {
 	return focusedRoot == targetRoot
 }
 
-// SetModelPaths はルートパス一覧からツリーを再構築する。
-func (tw *TreeViewWidget) SetModelPaths(paths []string) error {
-	if tw == nil {
-		return nil
-	}
-	if tw.model == nil {
-		tw.model = NewTreeModel()
-		if tw.treeView != nil {
-			if err := tw.treeView.SetModel(tw.model); err != nil {
-				return err
-			}
-		}
-	}
-	if err := tw.model.SetRoots(paths); err != nil {
-		tw.updateLayout()
-		return err
-	}
-	tw.updateLayout()
-	if tw.treeView != nil && tw.model != nil && tw.model.RootCount() > 0 {
-		// フォルダ読み込み直後は全展開して操作負荷を下げる。
-		tw.expandAllDirNodes()
-		tw.scrollToTop()
-	}
-	return nil
-}
-
 // expandAllDirNodes はディレクトリノードのみを全展開する。
 func (tw *TreeViewWidget) expandAllDirNodes() {
 	if tw == nil || tw.treeView == nil || tw.model == nil {
@@ -197,7 +281,7 @@ func (tw *TreeViewWidget) expandAllDirNodes() {
 	defer tw.treeView.SetSuspended(false)
 
 	stack := make([]*TreeNode, 0, 64)
-	for _, root := range tw.model.roots {
+	for _, root := range tw.model.visibleRoots() {
 		if root == nil {
 			continue
 		}
@@ -208,13 +292,14 @@ func (tw *TreeViewWidget) expandAllDirNodes() {
 		idx := len(stack) - 1
 		node := stack[idx]
 		stack = stack[:idx]
-		if node == nil || !node.IsDir() || len(node.children) == 0 {
+		children := node.visibleChildren()
+		if node == nil || !node.IsDir() || len(children) == 0 {
 			continue
 		}
 		_ = tw.treeView.SetExpanded(node, true)
-		for i := len(node.children) - 1; i >= 0; i-- {
-			child := node.children[i]
-			if child == nil || !child.IsDir() || len(child.children) == 0 {
+		for i := len(children) - 1; i >= 0; i-- {
+			child := children[i]
+			if child == nil || !child.IsDir() || len(child.visibleChildren()) == 0 {
 				continue
 			}
 			stack = append(stack, child)
@@ -222,16 +307,74 @@ func (tw *TreeViewWidget) expandAllDirNodes() {
 	}
 }
 
-// scrollToTop はツリー表示のスクロール位置を先頭へ戻す。
-func (tw *TreeViewWidget) scrollToTop() {
+// treeViewState はツリーの展開・選択状態を表す。
+type treeViewState struct {
+	expanded map[string]struct{}
+	selected string
+}
+
+// captureViewState は現在の展開・選択状態を記録する。
+func (tw *TreeViewWidget) captureViewState() treeViewState {
+	state := treeViewState{expanded: map[string]struct{}{}}
+	if tw == nil || tw.treeView == nil || tw.model == nil {
+		return state
+	}
+	state.selected = tw.resolveCurrentFilePath()
+	stack := append([]*TreeNode{}, tw.model.visibleRoots()...)
+	for len(stack) > 0 {
+		idx := len(stack) - 1
+		node := stack[idx]
+		stack = stack[:idx]
+		if node == nil || !node.IsDir() {
+			continue
+		}
+		if tw.treeView.Expanded(node) {
+			state.expanded[strings.ToLower(node.fullPath)] = struct{}{}
+		}
+		stack = append(stack, node.visibleChildren()...)
+	}
+	return state
+}
+
+// restoreViewState は記録した展開・選択状態を復元する。
+func (tw *TreeViewWidget) restoreViewState(state treeViewState) {
 	if tw == nil || tw.treeView == nil || tw.model == nil {
 		return
 	}
-	if len(tw.model.roots) == 0 {
+	tw.treeView.SetSuspended(true)
+	stack := append([]*TreeNode{}, tw.model.visibleRoots()...)
+	for len(stack) > 0 {
+		idx := len(stack) - 1
+		node := stack[idx]
+		stack = stack[:idx]
+		if node == nil || !node.IsDir() {
+			continue
+		}
+		if _, ok := state.expanded[strings.ToLower(node.fullPath)]; ok {
+			_ = tw.treeView.SetExpanded(node, true)
+		}
+		stack = append(stack, node.visibleChildren()...)
+	}
+	for _, pinned := range tw.model.pinnedRoots() {
+		// 固定表示のルートは常に展開して表示する。
+		_ = tw.treeView.SetExpanded(pinned, true)
+	}
+	tw.treeView.SetSuspended(false)
+	if state.selected == "" {
+		return
+	}
+	if node := findNodeByPath(tw.model.roots, state.selected); node != nil && !node.IsDir() && tw.model.isVisible(node) {
+		tw.selectFileNode(node)
+	}
+}
+
+// scrollToTop はツリー表示のスクロール位置を先頭へ戻す。
+func (tw *TreeViewWidget) scrollToTop() {
+	if tw == nil || tw.treeView == nil || tw.model == nil {
 		return
 	}
-	root := tw.model.roots[0]
-	if root == nil {
+	root, ok := tw.model.RootAt(0).(*TreeNode)
+	if !ok || root == nil {
 		return
 	}
 	if err := tw.treeView.EnsureVisible(root); err != nil && tw.logger != nil {
@@ -244,6 +387,142 @@ func (tw *TreeViewWidget) Widgets() declarative.Composite {
 	return declarative.Composite{
 		Layout: declarative.VBox{},
 		Children: []declarative.Widget{
+			declarative.Composite{
+				Layout: declarative.HBox{MarginsZero: true},
+				Children: []declarative.Widget{
+					declarative.CheckBox{
+						AssignTo:         &tw.lazyCheck,
+						Text:             i18n.TranslateOrMark(tw.translator, messages.LabelLazyMode),
+						ToolTipText:      i18n.TranslateOrMark(tw.translator, messages.LabelLazyModeTip),
+						Checked:          tw.lazyMode,
+						OnCheckedChanged: tw.handleLazyModeChanged,
+					},
+					declarative.CheckBox{
+						AssignTo:         &tw.compactCheck,
+						Text:             i18n.TranslateOrMark(tw.translator, messages.LabelCompactMode),
+						ToolTipText:      i18n.TranslateOrMark(tw.translator, messages.LabelCompactModeTip),
+						Checked:          tw.compactMode,
+						OnCheckedChanged: tw.handleCompactModeChanged,
+					},
+					declarative.TextLabel{
+						Text: i18n.TranslateOrMark(tw.translator, messages.LabelSortMode),
+					},
+					declarative.ComboBox{
+						AssignTo:              &tw.sortCombo,
+						Model:                 tw.sortModeLabels(),
+						CurrentIndex:          tw.sortModeIndex(),
+						OnCurrentIndexChanged: tw.handleSortModeChanged,
+					},
+					declarative.CheckBox{
+						AssignTo:         &tw.foldersFirstCheck,
+						Text:             i18n.TranslateOrMark(tw.translator, messages.LabelFoldersFirst),
+						Checked:          tw.foldersFirst,
+						OnCheckedChanged: tw.handleFoldersFirstChanged,
+					},
+					declarative.TextLabel{
+						Text: i18n.TranslateOrMark(tw.translator, messages.LabelNodeLabel),
+					},
+					declarative.ComboBox{
+						AssignTo:              &tw.labelCombo,
+						Model:                 tw.labelModeLabels(),
+						CurrentIndex:          tw.labelModeIndex(),
+						OnCurrentIndexChanged: tw.handleLabelModeChanged,
+					},
+					declarative.PushButton{
+						Text:        i18n.TranslateOrMark(tw.translator, messages.LabelScanRules),
+						ToolTipText: i18n.TranslateOrMark(tw.translator, messages.LabelScanRulesTip),
+						OnClicked:   tw.openScanRulesDialog,
+					},
+					declarative.PushButton{
+						AssignTo:    &tw.duplicateButton,
+						Text:        i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesFind),
+						ToolTipText: i18n.TranslateOrMark(tw.translator, messages.LabelDuplicatesFindTip),
+						OnClicked:   tw.handleFindDuplicates,
+					},
+					declarative.PushButton{
+						AssignTo:    &tw.versionButton,
+						Text:        i18n.TranslateOrMark(tw.translator, messages.LabelVersionsFind),
+						ToolTipText: i18n.TranslateOrMark(tw.translator, messages.LabelVersionsFindTip),
+						OnClicked:   tw.handleGroupVersions,
+					},
+					declarative.TextLabel{
+						Text: i18n.TranslateOrMark(tw.translator, messages.LabelTagFilter),
+					},
+					declarative.ComboBox{
+						AssignTo:              &tw.tagCombo,
+						Model:                 tw.tagFilterLabels(),
+						CurrentIndex:          0,
+						OnCurrentIndexChanged: tw.handleTagFilterChanged,
+					},
+					declarative.HSpacer{},
+				},
+			},
+			declarative.Composite{
+				Layout: declarative.HBox{MarginsZero: true},
+				Children: []declarative.Widget{
+					declarative.TextLabel{
+						Text: i18n.TranslateOrMark(tw.translator, messages.LabelSearch),
+					},
+					declarative.LineEdit{
+						AssignTo:      &tw.searchEdit,
+						CueBanner:     tw.searchCueBanner(),
+						StretchFactor: 1,
+						OnTextChanged: tw.handleSearchChanged,
+						OnKeyDown:     tw.handleSearchKeyDown,
+					},
+					declarative.ComboBox{
+						AssignTo:              &tw.searchModeCombo,
+						Model:                 tw.searchModeLabels(),
+						CurrentIndex:          tw.searchModeIndex(),
+						OnCurrentIndexChanged: tw.handleSearchModeChanged,
+					},
+					declarative.ComboBox{
+						AssignTo:              &tw.savedQueryCombo,
+						Model:                 tw.savedQueryLabels(),
+						CurrentIndex:          0,
+						OnCurrentIndexChanged: tw.handleSavedQueryChanged,
+					},
+					declarative.PushButton{
+						Text:        i18n.TranslateOrMark(tw.translator, messages.LabelQuerySave),
+						ToolTipText: i18n.TranslateOrMark(tw.translator, messages.LabelQuerySaveTip),
+						OnClicked:   tw.handleQuerySave,
+					},
+					declarative.PushButton{
+						Text:        i18n.TranslateOrMark(tw.translator, messages.LabelQueryDelete),
+						ToolTipText: i18n.TranslateOrMark(tw.translator, messages.LabelQueryDeleteTip),
+						OnClicked:   tw.handleQueryDelete,
+					},
+					declarative.TextLabel{
+						AssignTo: &tw.searchError,
+					},
+				},
+			},
+			// ツリー構築中のみ進捗とキャンセルボタンを表示する。
+			declarative.Composite{
+				AssignTo: &tw.progressComposite,
+				Layout:   declarative.HBox{MarginsZero: true},
+				Visible:  false,
+				Children: []declarative.Widget{
+					declarative.ProgressBar{
+						AssignTo:    &tw.progressBar,
+						MarqueeMode: true,
+						MinSize:     declarative.Size{Width: 120, Height: 16},
+						MaxSize:     declarative.Size{Width: 120, Height: 16},
+					},
+					declarative.TextLabel{
+						AssignTo: &tw.progressLabel,
+						Text:     i18n.TranslateOrMark(tw.translator, messages.LabelTreeBuilding),
+					},
+					declarative.HSpacer{},
+					declarative.PushButton{
+						AssignTo:  &tw.cancelButton,
+						Text:      i18n.TranslateOrMark(tw.translator, messages.LabelTreeBuildCancel),
+						OnClicked: tw.CancelBuild,
+						MinSize:   declarative.Size{Width: 70, Height: 20},
+						MaxSize:   declarative.Size{Width: 70, Height: 20},
+					},
+				},
+			},
 			// 内側でオーバーレイ配置を行うため、外側はサイズ確保用に分離する。
 			declarative.Composite{
 				AssignTo:      &tw.container,
@@ -276,8 +555,75 @@ func (tw *TreeViewWidget) Widgets() declarative.Composite {
 								Enabled:     false,
 								OnTriggered: tw.handleContextScreenshotSave,
 							},
+							declarative.Action{
+								AssignTo:    &tw.contextSlideshow,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelSlideshowHere),
+								Enabled:     false,
+								OnTriggered: tw.handleContextSlideshow,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextRescan,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelRescan),
+								Enabled:     false,
+								OnTriggered: tw.handleContextRescan,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextExclusions,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelExclusions),
+								Enabled:     false,
+								OnTriggered: tw.handleContextExclusions,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextBookmark,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelBookmarkAdd),
+								Enabled:     false,
+								OnTriggered: tw.handleContextBookmarkAdd,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextUnbookmark,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelBookmarkRemove),
+								Enabled:     false,
+								OnTriggered: tw.handleContextBookmarkRemove,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextTags,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelTagsEdit),
+								Enabled:     false,
+								OnTriggered: tw.handleContextTags,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextOpenDir,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelOpenFolder),
+								Enabled:     false,
+								OnTriggered: tw.handleContextOpenFolder,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextCopyGroup,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelCopyGroupPaths),
+								Enabled:     false,
+								OnTriggered: tw.handleContextCopyGroup,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextReport,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelVersionsCopyReport),
+								Enabled:     false,
+								OnTriggered: tw.handleContextCopyReport,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextForget,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelRecentForget),
+								Enabled:     false,
+								OnTriggered: tw.handleContextForgetRecent,
+							},
+							declarative.Action{
+								AssignTo:    &tw.contextClose,
+								Text:        i18n.TranslateOrMark(tw.translator, messages.LabelPinnedClose),
+								Enabled:     false,
+								OnTriggered: tw.handleContextClosePinned,
+							},
 						},
 						OnCurrentItemChanged: tw.handleCurrentItemChanged,
+						OnItemActivated:      tw.handleItemActivated,
 						OnKeyDown:            tw.handleKeyDown,
 						OnKeyUp:              tw.handleKeyUp,
 						OnMouseDown: func(x, y int, button walk.MouseButton) {
@@ -309,9 +655,13 @@ func (tw *TreeViewWidget) handleCurrentItemChanged() {
 	if !ok || node == nil || node.IsDir() {
 		return
 	}
+	if tw.silentSelect {
+		return
+	}
 	tw.lastSelected = node.Path()
-	if tw.onFileSelected != nil {
-		tw.onFileSelected(node.Path())
+	tw.selectNodeKind(node)
+	if node.Kind() == filetype.KindModel {
+		tw.recordViewed(node)
 	}
 }
 
@@ -334,9 +684,11 @@ func (tw *TreeViewWidget) prepareContextMenu(x, y int) {
 	item := tw.treeView.ItemAt(x, y)
 	node, ok := item.(*TreeNode)
 	if !ok || node == nil {
+		tw.contextNode = nil
 		tw.updateContextMenu("", false)
 		return
 	}
+	tw.contextNode = node
 	// 右クリック時はモデル読み込みを避けるため選択変更は行わない。
 	tw.updateContextMenu(node.Path(), node.IsDir())
 }
@@ -349,8 +701,25 @@ func (tw *TreeViewWidget) updateContextMenu(path string, isDir bool) {
 	tw.contextPath = path
 	tw.contextIsDir = isDir
 	enabled := path != ""
+	kind := filetype.KindUnknown
+	if enabled && !isDir {
+		kind = fileTypes.KindOf(path)
+	}
 	tw.setActionEnabled(tw.contextCopy, enabled && !isDir)
-	tw.setActionEnabled(tw.contextScreenshot, enabled)
+	tw.setActionEnabled(tw.contextScreenshot, enabled && (isDir || kind == filetype.KindModel))
+	tw.setActionEnabled(tw.contextSlideshow, enabled && isDir && tw.onSlideshow != nil)
+	tw.setActionEnabled(tw.contextRescan, enabled)
+	tw.setActionEnabled(tw.contextExclusions, enabled)
+	bookmarked := tw.isBookmarked(path)
+	tw.setActionEnabled(tw.contextBookmark, enabled && !bookmarked)
+	tw.setActionEnabled(tw.contextUnbookmark, bookmarked)
+	tw.setActionEnabled(tw.contextTags, tw.tagUsecase != nil && kind == filetype.KindModel)
+	tw.setActionEnabled(tw.contextOpenDir, enabled)
+	tw.setActionEnabled(tw.contextCopyGroup, tw.duplicateGroupOf(tw.contextNode) != nil)
+	tw.setActionEnabled(tw.contextReport, tw.versionReport != "" && tw.inVersions(tw.contextNode))
+	tw.setActionEnabled(tw.contextForget, tw.inRecent(tw.contextNode))
+	tw.setActionEnabled(tw.contextClose, tw.closablePinnedRoot(tw.contextNode) != nil)
+	tw.updateKindActions(kind)
 }
 
 // setActionEnabled はアクションの有効状態を設定する。
@@ -363,6 +732,32 @@ func (tw *TreeViewWidget) setActionEnabled(action *walk.Action, enabled bool) {
 	}
 }
 
+// closablePinnedRoot はノードを含む、閉じられる固定表示のルート(重複ファイル・バージョン整理)を返す。
+func (tw *TreeViewWidget) closablePinnedRoot(node *TreeNode) *TreeNode {
+	if tw.model == nil {
+		return nil
+	}
+	pinned := tw.model.pinnedRootOf(node)
+	if pinned == nil || pinned == tw.model.favorites || pinned == tw.model.recent {
+		return nil
+	}
+	return pinned
+}
+
+// handleContextClosePinned はコンテキストメニューの対象を含む重複ファイル・バージョン整理のルートを閉じる。
+func (tw *TreeViewWidget) handleContextClosePinned() {
+	if tw == nil || tw.model == nil {
+		return
+	}
+	switch tw.closablePinnedRoot(tw.contextNode) {
+	case nil:
+	case tw.model.duplicates:
+		tw.closeDuplicates()
+	case tw.model.versions:
+		tw.closeVersions()
+	}
+}
+
 // handleContextCopy はコンテキストメニューのパスコピー処理を行う。
 func (tw *TreeViewWidget) handleContextCopy() {
 	if tw == nil || tw.contextPath == "" {
@@ -383,18 +778,116 @@ func (tw *TreeViewWidget) handleContextScreenshotSave() {
 	}
 }
 
+// setSlideshowHandler はフォルダ配下のスライドショーを開始する処理を設定する。
+func (tw *TreeViewWidget) setSlideshowHandler(onSlideshow func(string)) {
+	if tw == nil {
+		return
+	}
+	tw.onSlideshow = onSlideshow
+}
+
+// handleContextSlideshow はコンテキストメニューの対象フォルダ配下のスライドショーを開始する。
+func (tw *TreeViewWidget) handleContextSlideshow() {
+	if tw == nil || tw.contextPath == "" || !tw.contextIsDir || tw.onSlideshow == nil {
+		return
+	}
+	tw.onSlideshow(tw.contextPath)
+}
+
+// SelectedFolderPath は選択中のフォルダのパスを返す。ファイルの場合は含むフォルダを返し、未選択の場合は空文字を返す。
+func (tw *TreeViewWidget) SelectedFolderPath() string {
+	if tw == nil || tw.treeView == nil {
+		return ""
+	}
+	node, ok := tw.treeView.CurrentItem().(*TreeNode)
+	if !ok || node == nil || node.fullPath == "" {
+		return ""
+	}
+	if node.IsDir() {
+		return node.fullPath
+	}
+	return filepath.Dir(node.fullPath)
+}
+
+// RevealModel は指定モデルのノードを、モデルを読み込まずに選択して表示位置を合わせる。
+func (tw *TreeViewWidget) RevealModel(path string) {
+	if tw == nil || tw.treeView == nil || tw.model == nil {
+		return
+	}
+	node := tw.locateFileNode(path)
+	if node == nil {
+		return
+	}
+	tw.silentSelect = true
+	defer func() {
+		tw.silentSelect = false
+	}()
+	tw.lastSelected = node.Path()
+	tw.selectFileNode(node)
+}
+
+// AdjacentModelPaths は選択中のモデルの次と前のモデルのパスを、表示順で次・前の順に返す。
+// 上下キーでの移動と同じ順にたどり、固定表示のルート内ではそのルート内で探す。モデル以外のノードは
+// adjacentModelSearchLimit件まで飛ばす。
+func (tw *TreeViewWidget) AdjacentModelPaths() []string {
+	if tw == nil || tw.treeView == nil || tw.model == nil {
+		return nil
+	}
+	current, ok := tw.treeView.CurrentItem().(*TreeNode)
+	if !ok || current == nil || current.IsDir() {
+		return nil
+	}
+	roots := tw.model.visibleRoots()
+	if pinned := tw.model.pinnedRootOf(current); pinned != nil {
+		roots = []*TreeNode{pinned}
+	}
+	var paths []string
+	for _, forward := range []bool{true, false} {
+		node := current
+		for i := 0; i < adjacentModelSearchLimit; i++ {
+			node = stepFileNode(roots, node, forward)
+			if node == nil {
+				break
+			}
+			if node.Kind() == filetype.KindModel {
+				paths = append(paths, node.Path())
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// handleContextRescan はコンテキストメニューの再走査を実行する。
+func (tw *TreeViewWidget) handleContextRescan() {
+	if tw == nil || tw.contextPath == "" {
+		return
+	}
+	tw.RescanRoot(tw.contextPath)
+}
+
 // CollectModelPathsUnder は指定パス配下のモデルパスを収集する。
 func (tw *TreeViewWidget) CollectModelPathsUnder(path string) []string {
 	if tw == nil || tw.model == nil || path == "" {
 		return nil
 	}
+	if tw.model.LazyPopulation() {
+		// 未探索のノードを含むため呼び出し側でフォルダを走査させる。
+		return nil
+	}
 	node := findNodeByPath(tw.model.roots, path)
 	if node == nil {
 		return nil
 	}
 	nodes := make([]*TreeNode, 0, 64)
 	collectFileNodesRecursive(node, &nodes)
-	return extractNodePaths(nodes)
+	models := nodes[:0]
+	for _, fileNode := range nodes {
+		if fileNode.Kind() == filetype.KindModel {
+			models = append(models, fileNode)
+		}
+	}
+	return extractNodePaths(models)
 }
 
 // handleKeyDown はキー操作の起点を記録する。
@@ -402,15 +895,21 @@ func (tw *TreeViewWidget) handleKeyDown(key walk.Key) {
 	if tw == nil {
 		return
 	}
-	switch key {
-	case walk.KeyDown, walk.KeyUp:
-		base := tw.lastSelected
-		if base == "" {
-			base = tw.resolveCurrentFilePath()
-		}
-		tw.pendingKey = key
-		tw.pendingBase = base
-		tw.pendingActive = true
+	if _, ok := selectionMoveOf(key, walk.ControlDown()); !ok {
+		return
+	}
+	base := tw.lastSelected
+	if base == "" {
+		base = tw.resolveCurrentFilePath()
+	}
+	tw.pendingKey = key
+	tw.pendingBase = base
+	tw.pendingActive = true
+	tw.pendingCtrl = walk.ControlDown()
+	// お気に入りなど固定表示のルート内の操作はそのルート内で移動させる。
+	tw.pendingNode = nil
+	if node, ok := tw.treeView.CurrentItem().(*TreeNode); ok && tw.model.pinnedRootOf(node) != nil {
+		tw.pendingNode = node
 	}
 }
 
@@ -420,27 +919,40 @@ func (tw *TreeViewWidget) handleKeyUp(key walk.Key) {
 		return
 	}
 	base := ""
+	var baseNode *TreeNode
+	ctrl := walk.ControlDown()
 	if tw.pendingActive && tw.pendingKey == key {
 		base = tw.pendingBase
+		baseNode = tw.pendingNode
+		ctrl = tw.pendingCtrl
 	}
 	tw.pendingKey = 0
 	tw.pendingBase = ""
 	tw.pendingActive = false
+	tw.pendingNode = nil
+	tw.pendingCtrl = false
 
-	switch key {
-	case walk.KeyDown:
-		tw.moveSelectionByDelta(1, base)
-	case walk.KeyUp:
-		tw.moveSelectionByDelta(-1, base)
+	move, ok := selectionMoveOf(key, ctrl)
+	if !ok {
+		return
+	}
+	if baseNode != nil {
+		tw.moveSelectionInPinned(move, baseNode)
+		return
 	}
+	tw.moveSelection(move, base)
 }
 
-// moveSelectionByDelta は上下キーでモデル選択を進める。
-func (tw *TreeViewWidget) moveSelectionByDelta(delta int, basePath string) {
+// moveSelection はキー操作に応じてモデル選択を進める。
+func (tw *TreeViewWidget) moveSelection(move selectionMove, basePath string) {
 	if tw == nil || tw.treeView == nil || tw.model == nil {
 		return
 	}
-	nodes := collectFileNodes(tw.model.roots)
+	if tw.model.LazyPopulation() {
+		tw.moveSelectionLazy(move, basePath)
+		return
+	}
+	nodes := collectFileNodes(tw.model.visibleRoots())
 	if len(nodes) == 0 {
 		return
 	}
@@ -454,21 +966,7 @@ func (tw *TreeViewWidget) moveSelectionByDelta(delta int, basePath string) {
 			currentIndex = resolveFileNodeIndex(nodes, current)
 		}
 	}
-	targetIndex := currentIndex + delta
-	if currentIndex < 0 {
-		if delta < 0 {
-			targetIndex = len(nodes) - 1
-		} else {
-			targetIndex = 0
-		}
-	}
-	if targetIndex < 0 {
-		targetIndex = 0
-	}
-	if targetIndex >= len(nodes) {
-		targetIndex = len(nodes) - 1
-	}
-	target := nodes[targetIndex]
+	target := nodes[move.targetIndex(nodes, currentIndex)]
 	if target == nil {
 		return
 	}
@@ -536,7 +1034,7 @@ func collectFileNodesRecursive(node *TreeNode, out *[]*TreeNode) {
 		*out = append(*out, node)
 		return
 	}
-	for _, child := range node.children {
+	for _, child := range node.visibleChildren() {
 		collectFileNodesRecursive(child, out)
 	}
 }
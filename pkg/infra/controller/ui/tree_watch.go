@@ -0,0 +1,251 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+// treePatch は監視で検出した変更をツリーへ反映する単位を表す。
+type treePatch struct {
+	root    string
+	added   []string
+	removed []string
+	renamed map[string]string
+	rebuilt *TreeNode
+	rescan  bool
+}
+
+// restartWatchers は指定ルートの監視を開始し直す。
+func (tw *TreeViewWidget) restartWatchers(paths []string) {
+	if tw == nil {
+		return
+	}
+	tw.stopWatchers()
+	tw.watchSeq++
+	seq := tw.watchSeq
+	for _, rootPath := range paths {
+		if rootPath == "" {
+			continue
+		}
+		opts := tw.buildOptions().forRoot(rootPath)
+		watcher := scanner.NewWatcher(rootPath, scanner.WatchOptions{Match: opts.match(), Archives: true, OnFallback: tw.handleWatchFallback})
+		err := watcher.Start(context.Background(), func(root string, events []scanner.WatchEvent) {
+			tw.handleWatchEvents(seq, root, events, opts)
+		})
+		if err != nil {
+			if tw.logger != nil {
+				tw.logger.Warn("フォルダ監視の開始に失敗しました: %s", logging.FormatError(err, tw.logger))
+			}
+			continue
+		}
+		if watcher.Polling() && tw.logger != nil {
+			tw.logger.Debug("フォルダ監視をポーリングで開始しました: %s", rootPath)
+		}
+		tw.watchers = append(tw.watchers, watcher)
+	}
+}
+
+// handleWatchFallback はフォルダ監視がポーリングへ切り替わったことを警告する。バックグラウンドで呼ばれる。
+func (tw *TreeViewWidget) handleWatchFallback(root string, err error) {
+	if tw.logger != nil {
+		tw.logger.Warn("フォルダ監視に失敗したため、定期的な確認に切り替えました: %s (%s)", root, logging.FormatError(err, tw.logger))
+	}
+}
+
+// stopWatchers は全ての監視を停止する。
+func (tw *TreeViewWidget) stopWatchers() {
+	if tw == nil {
+		return
+	}
+	for _, watcher := range tw.watchers {
+		watcher.Stop()
+	}
+	tw.watchers = nil
+}
+
+// handleWatchEvents は監視イベントを解決してUIスレッドで反映する。バックグラウンドで呼ばれる。
+func (tw *TreeViewWidget) handleWatchEvents(seq uint64, root string, events []scanner.WatchEvent, opts treeBuildOptions) {
+	patch := resolveTreePatch(root, events, opts)
+	if patch == nil {
+		return
+	}
+	tw.synchronize(func() {
+		if seq != tw.watchSeq {
+			// 監視対象が切り替わった後の通知は破棄する。
+			return
+		}
+		tw.applyTreePatch(patch)
+	})
+}
+
+// resolveTreePatch は監視イベントから追加・削除するモデルパスを決定する。
+func resolveTreePatch(root string, events []scanner.WatchEvent, opts treeBuildOptions) *treePatch {
+	if root == "" || len(events) == 0 {
+		return nil
+	}
+	patch := &treePatch{root: root, renamed: map[string]string{}}
+	touched := make([]string, 0, len(events))
+	seen := map[string]struct{}{}
+	touch := func(path string) {
+		key := strings.ToLower(path)
+		if path == "" {
+			return
+		}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		touched = append(touched, path)
+	}
+	for _, event := range events {
+		switch event.Op {
+		case scanner.WatchOverflow:
+			patch.rescan = true
+		case scanner.WatchRename:
+			touch(event.OldPath)
+			touch(event.Path)
+			if event.OldPath != "" {
+				patch.renamed[strings.ToLower(event.OldPath)] = event.Path
+			}
+		default:
+			touch(event.Path)
+		}
+		if strings.EqualFold(filepath.Base(event.Path), scanner.IgnoreFileName) ||
+			strings.EqualFold(filepath.Base(event.OldPath), scanner.IgnoreFileName) {
+			patch.rescan = true
+		}
+	}
+	if patch.rescan {
+		// 取りこぼしや除外規則の変更がある場合はルート全体を構築し直す。
+		patch.rebuilt, _ = buildRootNode(context.Background(), root, opts, nil)
+		return patch
+	}
+
+	// イベント順に依存しないよう、現時点の実体の有無で追加/削除を決める。
+	filter := scanner.NewFilter(root, opts.rules)
+	match := opts.match()
+	for _, path := range touched {
+		info, err := os.Stat(path)
+		if err != nil {
+			patch.removed = append(patch.removed, path)
+			continue
+		}
+		if info.IsDir() || archive.IsArchive(path) {
+			// アーカイブはフォルダと同様に配下を走査する。
+			if !filter.Allow(path, true) {
+				continue
+			}
+			// 追加フォルダは部分走査のためインデックスを使わない。
+			modelPaths, _ := collectModelPaths(context.Background(), path, treeBuildOptions{rules: opts.rules, kinds: opts.kinds, filter: filter}, nil)
+			patch.added = append(patch.added, modelPaths...)
+			continue
+		}
+		if match(path) && filter.Allow(path, false) {
+			patch.added = append(patch.added, path)
+		}
+	}
+	if len(patch.added) == 0 && len(patch.removed) == 0 {
+		return nil
+	}
+	if opts.compact && !opts.lazy {
+		// まとめたフォルダは差分では分割・結合できないためルート全体を構築し直す。
+		patch.rescan = true
+		patch.rebuilt, _ = buildRootNode(context.Background(), root, opts, nil)
+	}
+	return patch
+}
+
+// applyTreePatch は変更をツリーへ反映する。UIスレッドで呼び出す。
+func (tw *TreeViewWidget) applyTreePatch(patch *treePatch) {
+	if tw == nil || tw.model == nil || patch == nil {
+		return
+	}
+	// 追加・再構築したノードの表示名を読み込み、件数を数え直す。
+	defer tw.refreshModelCounts()
+	defer tw.refreshModelLabels()
+	defer tw.refreshModelTags()
+	defer tw.refreshQueryMetadata()
+	selectedPath := tw.resolveCurrentFilePath()
+	// 差分反映中の選択変更でモデルを読み込まないようにする。
+	tw.silentSelect = true
+	defer func() {
+		tw.silentSelect = false
+	}()
+
+	if patch.rescan {
+		state := tw.captureViewState()
+		tw.model.replaceRoot(patch.root, patch.rebuilt)
+		tw.model.reapplyFilter()
+		tw.model.PublishItemsReset(nil)
+		tw.restoreViewState(state)
+		return
+	}
+
+	rootsChanged := false
+	var createdDirs []*TreeNode
+	for _, path := range patch.removed {
+		_, changed := tw.model.removePath(path)
+		rootsChanged = rootsChanged || changed
+	}
+	rootOpts := tw.buildOptions().scopedTo(patch.root)
+	for _, path := range patch.added {
+		dirs, changed := tw.model.insertModelPath(patch.root, path, rootOpts)
+		createdDirs = append(createdDirs, dirs...)
+		rootsChanged = rootsChanged || changed
+	}
+
+	if rootsChanged || tw.model.filter != nil {
+		// 絞り込み中は表示対象が変わるため全体を再描画する。
+		state := tw.captureViewState()
+		tw.model.reapplyFilter()
+		tw.model.PublishItemsReset(nil)
+		for _, dir := range createdDirs {
+			state.expanded[strings.ToLower(dir.fullPath)] = struct{}{}
+		}
+		state.selected = renamedPath(selectedPath, patch.renamed)
+		tw.restoreViewState(state)
+		return
+	}
+	if tw.treeView != nil {
+		// 新規フォルダは読み込み直後と同様に展開する。
+		for _, dir := range createdDirs {
+			_ = tw.treeView.SetExpanded(dir, true)
+		}
+	}
+	// 選択中のノードが置き換わった場合のみ選択を付け直す。
+	if target := renamedPath(selectedPath, patch.renamed); target != "" && !sameFilePath(tw.resolveCurrentFilePath(), target) {
+		if node := findNodeByPath(tw.model.roots, target); node != nil && !node.IsDir() {
+			tw.lastSelected = node.Path()
+			tw.selectFileNode(node)
+		}
+	}
+}
+
+// renamedPath は名前変更の対応表に従ってパスを読み替える。
+func renamedPath(path string, renamed map[string]string) string {
+	if path == "" || len(renamed) == 0 {
+		return path
+	}
+	for oldPath, newPath := range renamed {
+		if strings.EqualFold(path, oldPath) {
+			return newPath
+		}
+		// フォルダの名前変更は配下のパスにも適用する。
+		prefix := oldPath + string(os.PathSeparator)
+		if len(path) > len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+			return newPath + path[len(prefix)-1:]
+		}
+	}
+	return path
+}
@@ -0,0 +1,186 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/domain/filetype"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+const (
+	// userConfigKeyTreeLazy はツリーの遅延読み込み設定のキーを表す。
+	userConfigKeyTreeLazy = "tree_lazy_mode"
+	// userConfigKeyTreeCompact は単一の子フォルダをまとめる表示設定のキーを表す。
+	userConfigKeyTreeCompact = "tree_compact_mode"
+	// userConfigKeyTreeSortMode はツリーの並び順のキーを表す。
+	userConfigKeyTreeSortMode = "tree_sort_mode"
+	// userConfigKeyTreeFoldersFirst はフォルダを先に並べる設定のキーを表す。
+	userConfigKeyTreeFoldersFirst = "tree_folders_first"
+	// userConfigKeyTreeLabelMode はファイルノードの表示名の設定のキーを表す。
+	userConfigKeyTreeLabelMode = "tree_label_mode"
+	// userConfigKeyTreeSearchMode はツリーの絞り込み方法の設定のキーを表す。
+	userConfigKeyTreeSearchMode = "tree_search_mode"
+	// userConfigKeySavedQueries は保存済みクエリ一覧のキーを表す。
+	userConfigKeySavedQueries = "tree_saved_queries"
+	// userConfigKeyScanInclude は走査対象パターンのキーを表す。
+	userConfigKeyScanInclude = "tree_scan_include"
+	// userConfigKeyScanExclude は走査除外パターンのキーを表す。
+	userConfigKeyScanExclude = "tree_scan_exclude"
+	// userConfigKeyScanMaxDepth は走査階層上限のキーを表す。
+	userConfigKeyScanMaxDepth = "tree_scan_max_depth"
+	// userConfigKeyScanSkipHidden は隠しフォルダ除外のキーを表す。
+	userConfigKeyScanSkipHidden = "tree_scan_skip_hidden"
+	// userConfigKeyScanFollowLinks はリンク先フォルダの走査設定のキーを表す。
+	userConfigKeyScanFollowLinks = "tree_scan_follow_links"
+	// userConfigKeyWorkspaces はワークスペース一覧のキーを表す。
+	userConfigKeyWorkspaces = "tree_workspaces"
+	// userConfigKeyBookmarks はブックマーク一覧のキーを表す。
+	userConfigKeyBookmarks = "tree_bookmarks"
+	// userConfigKeyRecentModels は最近見たモデル一覧のキーを表す。
+	userConfigKeyRecentModels = "tree_recent_models"
+	// userConfigKeySlideshowSeconds はスライドショーの切り替え間隔(秒)のキーを表す。
+	userConfigKeySlideshowSeconds = "tree_slideshow_seconds"
+	// userConfigKeySlideshowMotionEnd はスライドショーをモーション終了で進めるかのキーを表す。
+	userConfigKeySlideshowMotionEnd = "tree_slideshow_motion_end"
+	// userConfigKeySlideshowShuffle はスライドショーの順序を無作為にするかのキーを表す。
+	userConfigKeySlideshowShuffle = "tree_slideshow_shuffle"
+	// userConfigKeySlideshowRestart はスライドショーの切り替え時にモーションを先頭から再生するかのキーを表す。
+	userConfigKeySlideshowRestart = "tree_slideshow_restart"
+	// userConfigKeyVisibleKinds はツリーに表示するファイル種別のキーを表す。
+	userConfigKeyVisibleKinds = "tree_visible_kinds"
+)
+
+// maxConfigListLength は一覧形式の設定で保持する件数の上限を表す。
+const maxConfigListLength = 100
+
+// loadConfigString はユーザー設定から単一の文字列を読み込む。
+func loadConfigString(userConfig config.IUserConfig, key string, fallback string) string {
+	if userConfig == nil || key == "" {
+		return fallback
+	}
+	values, err := userConfig.GetStringSlice(key)
+	if err != nil || len(values) == 0 {
+		return fallback
+	}
+	return values[0]
+}
+
+// saveConfigString はユーザー設定へ単一の文字列を保存する。
+func saveConfigString(userConfig config.IUserConfig, key string, value string) error {
+	if userConfig == nil || key == "" {
+		return nil
+	}
+	return userConfig.SetStringSlice(key, []string{value}, 1)
+}
+
+// loadConfigBool はユーザー設定から真偽値を読み込む。
+func loadConfigBool(userConfig config.IUserConfig, key string, fallback bool) bool {
+	value := loadConfigString(userConfig, key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// loadConfigInt はユーザー設定から整数を読み込む。
+func loadConfigInt(userConfig config.IUserConfig, key string, fallback int) int {
+	value := loadConfigString(userConfig, key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// saveConfigInt はユーザー設定へ整数を保存する。
+func saveConfigInt(userConfig config.IUserConfig, key string, value int) error {
+	return saveConfigString(userConfig, key, strconv.Itoa(value))
+}
+
+// loadConfigList はユーザー設定から文字列一覧を読み込む。
+func loadConfigList(userConfig config.IUserConfig, key string) []string {
+	if userConfig == nil || key == "" {
+		return nil
+	}
+	values, err := userConfig.GetStringSlice(key)
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
+// saveConfigList はユーザー設定へ文字列一覧を保存する。
+func saveConfigList(userConfig config.IUserConfig, key string, values []string) error {
+	if userConfig == nil || key == "" {
+		return nil
+	}
+	return userConfig.SetStringSlice(key, values, maxConfigListLength)
+}
+
+// loadScanRules はユーザー設定から走査の除外条件を読み込む。
+func loadScanRules(userConfig config.IUserConfig) scanner.Rules {
+	return scanner.Rules{
+		Include:     loadConfigList(userConfig, userConfigKeyScanInclude),
+		Exclude:     loadConfigList(userConfig, userConfigKeyScanExclude),
+		MaxDepth:    loadConfigInt(userConfig, userConfigKeyScanMaxDepth, 0),
+		SkipHidden:  loadConfigBool(userConfig, userConfigKeyScanSkipHidden, false),
+		FollowLinks: loadConfigBool(userConfig, userConfigKeyScanFollowLinks, false),
+	}
+}
+
+// saveScanRules はユーザー設定へ走査の除外条件を保存する。
+func saveScanRules(userConfig config.IUserConfig, rules scanner.Rules) error {
+	return errors.Join(
+		saveConfigList(userConfig, userConfigKeyScanInclude, rules.Include),
+		saveConfigList(userConfig, userConfigKeyScanExclude, rules.Exclude),
+		saveConfigInt(userConfig, userConfigKeyScanMaxDepth, rules.MaxDepth),
+		saveConfigBool(userConfig, userConfigKeyScanSkipHidden, rules.SkipHidden),
+		saveConfigBool(userConfig, userConfigKeyScanFollowLinks, rules.FollowLinks),
+	)
+}
+
+// loadVisibleKinds はユーザー設定からツリーに表示するファイル種別を読み込む。未設定の場合は既定の種別を返す。
+func loadVisibleKinds(userConfig config.IUserConfig) []filetype.Kind {
+	values := loadConfigList(userConfig, userConfigKeyVisibleKinds)
+	var kinds []filetype.Kind
+	for _, kind := range filetype.Kinds() {
+		for _, value := range values {
+			if string(kind) == value {
+				kinds = append(kinds, kind)
+				break
+			}
+		}
+	}
+	if len(kinds) == 0 {
+		return filetype.DefaultVisibleKinds()
+	}
+	return kinds
+}
+
+// saveVisibleKinds はユーザー設定へツリーに表示するファイル種別を保存する。
+func saveVisibleKinds(userConfig config.IUserConfig, kinds []filetype.Kind) error {
+	values := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		values = append(values, string(kind))
+	}
+	return saveConfigList(userConfig, userConfigKeyVisibleKinds, values)
+}
+
+// saveConfigBool はユーザー設定へ真偽値を保存する。
+func saveConfigBool(userConfig config.IUserConfig, key string, value bool) error {
+	return saveConfigString(userConfig, key, strconv.FormatBool(value))
+}
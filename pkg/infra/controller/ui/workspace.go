@@ -0,0 +1,135 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+// workspaceRoot はワークスペースに含まれるルートフォルダを表す。
+type workspaceRoot struct {
+	Path string `json:"path"`
+	// Alias はルートの表示名。空の場合はパスを表示する。
+	Alias string `json:"alias,omitempty"`
+	// Rules はルート独自の走査条件。nilの場合は全体の走査条件を使う。
+	Rules *scanner.Rules `json:"rules,omitempty"`
+}
+
+// workspace は名前を付けて保存したルートフォルダの組を表す。
+type workspace struct {
+	Name  string          `json:"name"`
+	Roots []workspaceRoot `json:"roots"`
+}
+
+// rootOptions はルート単位の表示名と走査条件を表す。
+type rootOptions struct {
+	alias string
+	// rules はルート独自の走査条件。nilの場合は全体の走査条件を使う。
+	rules *scanner.Rules
+}
+
+// paths はワークスペースのルートパス一覧を返す。
+func (w workspace) paths() []string {
+	paths := make([]string, 0, len(w.Roots))
+	for _, root := range w.Roots {
+		paths = append(paths, root.Path)
+	}
+	return paths
+}
+
+// rootOptions はルートパスごとの表示名と走査条件を返す。キーは小文字のパス。
+func (w workspace) rootOptions() map[string]rootOptions {
+	options := make(map[string]rootOptions, len(w.Roots))
+	for _, root := range w.Roots {
+		if root.Alias == "" && root.Rules == nil {
+			continue
+		}
+		options[strings.ToLower(cleanPath(root.Path))] = rootOptions{alias: root.Alias, rules: root.Rules}
+	}
+	return options
+}
+
+// findRoot は指定パスのルート設定を返す。
+func (w workspace) findRoot(path string) (workspaceRoot, bool) {
+	for _, root := range w.Roots {
+		if strings.EqualFold(root.Path, path) {
+			return root, true
+		}
+	}
+	return workspaceRoot{}, false
+}
+
+// withPaths は指定パスをルートとするワークスペースを返す。既存のルートの設定は引き継ぐ。
+func (w workspace) withPaths(name string, paths []string) workspace {
+	updated := workspace{Name: name, Roots: make([]workspaceRoot, 0, len(paths))}
+	for _, path := range paths {
+		root, ok := w.findRoot(path)
+		if !ok {
+			root = workspaceRoot{Path: path}
+		}
+		updated.Roots = append(updated.Roots, root)
+	}
+	return updated
+}
+
+// label はルートの一覧表示用の文字列を返す。
+func (r workspaceRoot) label() string {
+	if r.Alias == "" {
+		return r.Path
+	}
+	return r.Alias + " - " + r.Path
+}
+
+// loadWorkspaces はユーザー設定からワークスペース一覧を読み込む。読めない項目は無視する。
+func loadWorkspaces(userConfig config.IUserConfig) []workspace {
+	values := loadConfigList(userConfig, userConfigKeyWorkspaces)
+	workspaces := make([]workspace, 0, len(values))
+	for _, value := range values {
+		var ws workspace
+		if err := json.Unmarshal([]byte(value), &ws); err != nil || ws.Name == "" {
+			continue
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces
+}
+
+// saveWorkspaces はユーザー設定へワークスペース一覧を保存する。
+func saveWorkspaces(userConfig config.IUserConfig, workspaces []workspace) error {
+	values := make([]string, 0, len(workspaces))
+	for _, ws := range workspaces {
+		data, err := json.Marshal(ws)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(data))
+	}
+	return saveConfigList(userConfig, userConfigKeyWorkspaces, values)
+}
+
+// forRoot は指定ルートの走査条件を反映した構築条件を返す。
+func (opts treeBuildOptions) forRoot(rootPath string) treeBuildOptions {
+	if options, ok := opts.roots[strings.ToLower(rootPath)]; ok && options.rules != nil {
+		opts.rules = *options.rules
+	}
+	return opts
+}
+
+// scopedTo は指定ルートの走査条件と除外規則を反映した構築条件を返す。
+func (opts treeBuildOptions) scopedTo(rootPath string) treeBuildOptions {
+	opts = opts.forRoot(rootPath)
+	opts.filter = scanner.NewFilter(rootPath, opts.rules)
+	return opts
+}
+
+// aliasFor は指定ルートの表示名を返す。未設定の場合は空文字を返す。
+func (opts treeBuildOptions) aliasFor(rootPath string) string {
+	return opts.roots[strings.ToLower(rootPath)].alias
+}
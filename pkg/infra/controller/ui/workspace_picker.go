@@ -0,0 +1,493 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miu200521358/mlib_go/pkg/infra/controller"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/config"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/i18n"
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+	"github.com/miu200521358/walk/pkg/declarative"
+	"github.com/miu200521358/walk/pkg/walk"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/adapter/mpresenter/messages"
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/scanner"
+)
+
+// WorkspacePicker はワークスペースの切り替え・保存ウィジェットを表す。
+type WorkspacePicker struct {
+	window       *controller.ControlWindow
+	translator   i18n.II18n
+	logger       logging.ILogger
+	userConfig   config.IUserConfig
+	workspaces   []workspace
+	current      string
+	combo        *walk.ComboBox
+	saveButton   *walk.PushButton
+	editButton   *walk.PushButton
+	deleteButton *walk.PushButton
+	// updating は選択肢の再設定中に選択変更を処理しないための印。
+	updating bool
+	// currentPaths は保存時に使う現在のルートパス一覧を返す。
+	currentPaths func() []string
+	// defaultRules はルート独自の走査条件の初期値として使う全体の走査条件を返す。
+	defaultRules func() scanner.Rules
+	onApply      func(workspace)
+}
+
+// NewWorkspacePicker はWorkspacePickerを生成する。
+func NewWorkspacePicker(userConfig config.IUserConfig, translator i18n.II18n, logger logging.ILogger, currentPaths func() []string, defaultRules func() scanner.Rules, onApply func(workspace)) *WorkspacePicker {
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+	return &WorkspacePicker{
+		translator:   translator,
+		logger:       logger,
+		userConfig:   userConfig,
+		workspaces:   loadWorkspaces(userConfig),
+		currentPaths: currentPaths,
+		defaultRules: defaultRules,
+		onApply:      onApply,
+	}
+}
+
+// SetWindow はウィンドウ参照を設定する。
+func (wp *WorkspacePicker) SetWindow(window *controller.ControlWindow) {
+	if wp == nil {
+		return
+	}
+	wp.window = window
+}
+
+// SetEnabledInPlaying は再生中の有効状態を設定する。
+func (wp *WorkspacePicker) SetEnabledInPlaying(playing bool) {
+	if wp == nil {
+		return
+	}
+	enabled := !playing
+	for _, w := range []interface{ SetEnabled(bool) }{wp.combo, wp.saveButton, wp.editButton, wp.deleteButton} {
+		if w != nil {
+			w.SetEnabled(enabled)
+		}
+	}
+}
+
+// Widgets はUI構成を返す。
+func (wp *WorkspacePicker) Widgets() declarative.Composite {
+	buttonSize := declarative.Size{Width: 70, Height: 20}
+	return declarative.Composite{
+		Layout: declarative.HBox{},
+		Children: []declarative.Widget{
+			declarative.TextLabel{
+				Text:        wp.t(messages.LabelWorkspace),
+				ToolTipText: wp.t(messages.LabelWorkspaceTip),
+			},
+			declarative.ComboBox{
+				AssignTo:              &wp.combo,
+				Model:                 wp.names(),
+				CurrentIndex:          -1,
+				ToolTipText:           wp.t(messages.LabelWorkspaceTip),
+				OnCurrentIndexChanged: wp.handleSelected,
+				StretchFactor:         1,
+			},
+			declarative.PushButton{
+				AssignTo:  &wp.saveButton,
+				Text:      wp.t(messages.LabelWorkspaceSave),
+				OnClicked: wp.handleSave,
+				MinSize:   buttonSize,
+				MaxSize:   buttonSize,
+			},
+			declarative.PushButton{
+				AssignTo:  &wp.editButton,
+				Text:      wp.t(messages.LabelWorkspaceEdit),
+				OnClicked: wp.handleEdit,
+				MinSize:   buttonSize,
+				MaxSize:   buttonSize,
+			},
+			declarative.PushButton{
+				AssignTo:  &wp.deleteButton,
+				Text:      wp.t(messages.LabelWorkspaceDelete),
+				OnClicked: wp.handleDelete,
+				MinSize:   buttonSize,
+				MaxSize:   buttonSize,
+			},
+		},
+	}
+}
+
+// Current は選択中のワークスペースを返す。
+func (wp *WorkspacePicker) Current() (workspace, bool) {
+	if wp == nil || wp.current == "" {
+		return workspace{}, false
+	}
+	index := wp.indexOf(wp.current)
+	if index < 0 {
+		return workspace{}, false
+	}
+	return wp.workspaces[index], true
+}
+
+// ClearCurrent はワークスペースの選択を解除する。ルートを個別に選び直した場合に呼ばれる。
+func (wp *WorkspacePicker) ClearCurrent() {
+	if wp == nil || wp.current == "" {
+		return
+	}
+	wp.current = ""
+	wp.refreshCombo()
+}
+
+// handleSelected は選択したワークスペースを適用する。
+func (wp *WorkspacePicker) handleSelected() {
+	if wp == nil || wp.combo == nil || wp.updating {
+		return
+	}
+	index := wp.combo.CurrentIndex()
+	if index < 0 || index >= len(wp.workspaces) {
+		return
+	}
+	wp.apply(wp.workspaces[index])
+}
+
+// apply はワークスペースを選択状態にして適用する。
+func (wp *WorkspacePicker) apply(ws workspace) {
+	wp.current = ws.Name
+	if wp.onApply != nil {
+		wp.onApply(ws)
+	}
+}
+
+// handleSave は現在のルートを名前を付けてワークスペースに保存する。同名の場合は上書きし、ルートの設定を引き継ぐ。
+func (wp *WorkspacePicker) handleSave() {
+	if wp == nil {
+		return
+	}
+	var paths []string
+	if wp.currentPaths != nil {
+		paths = wp.currentPaths()
+	}
+	if len(paths) == 0 {
+		walk.MsgBox(wp.owner(), wp.t(messages.LabelWorkspace), wp.t(messages.MessageWorkspaceNoRoots), walk.MsgBoxIconInformation)
+		return
+	}
+	name, ok := wp.promptName(wp.current)
+	if !ok {
+		return
+	}
+	base, _ := wp.Current()
+	if index := wp.indexOf(name); index >= 0 {
+		base = wp.workspaces[index]
+	}
+	ws := base.withPaths(name, paths)
+	if index := wp.indexOf(name); index >= 0 {
+		wp.workspaces[index] = ws
+	} else {
+		wp.workspaces = append(wp.workspaces, ws)
+	}
+	wp.current = name
+	wp.persist()
+	wp.refreshCombo()
+	wp.apply(ws)
+}
+
+// handleEdit は選択中のワークスペースのルートの表示名と走査条件を編集する。
+func (wp *WorkspacePicker) handleEdit() {
+	if wp == nil {
+		return
+	}
+	ws, ok := wp.Current()
+	if !ok {
+		return
+	}
+	edited, ok := wp.openEditDialog(ws)
+	if !ok {
+		return
+	}
+	wp.workspaces[wp.indexOf(ws.Name)] = edited
+	wp.persist()
+	wp.apply(edited)
+}
+
+// handleDelete は選択中のワークスペースを削除する。表示中のツリーはそのまま残す。
+func (wp *WorkspacePicker) handleDelete() {
+	if wp == nil {
+		return
+	}
+	ws, ok := wp.Current()
+	if !ok {
+		return
+	}
+	message := fmt.Sprintf(wp.t(messages.MessageWorkspaceDeleteConfirm), ws.Name)
+	if walk.MsgBox(wp.owner(), wp.t(messages.LabelWorkspaceDelete), message, walk.MsgBoxYesNo|walk.MsgBoxIconQuestion) != walk.DlgCmdYes {
+		return
+	}
+	index := wp.indexOf(ws.Name)
+	wp.workspaces = append(wp.workspaces[:index], wp.workspaces[index+1:]...)
+	wp.current = ""
+	wp.persist()
+	wp.refreshCombo()
+	if wp.onApply != nil {
+		// ルート単位の設定を解除するため、ルートのみのワークスペースとして適用し直す。
+		wp.onApply(workspace{}.withPaths("", ws.paths()))
+	}
+}
+
+// promptName はワークスペース名を入力するダイアログを表示する。
+func (wp *WorkspacePicker) promptName(initial string) (string, bool) {
+	owner := wp.owner()
+	if owner == nil {
+		return "", false
+	}
+	var dlg *walk.Dialog
+	var nameEdit *walk.LineEdit
+	var acceptButton *walk.PushButton
+	var cancelButton *walk.PushButton
+	result, err := declarative.Dialog{
+		AssignTo:      &dlg,
+		Title:         wp.t(messages.LabelWorkspaceSave),
+		MinSize:       declarative.Size{Width: 360, Height: 120},
+		Layout:        declarative.VBox{},
+		DefaultButton: &acceptButton,
+		CancelButton:  &cancelButton,
+		Children: []declarative.Widget{
+			declarative.TextLabel{
+				Text: wp.t(messages.LabelWorkspaceName),
+			},
+			declarative.LineEdit{
+				AssignTo: &nameEdit,
+				Text:     initial,
+			},
+			wp.dialogButtons(&dlg, &acceptButton, &cancelButton),
+		},
+	}.Run(owner)
+	if err != nil {
+		wp.logger.Warn("ワークスペース名ダイアログの表示に失敗しました: %s", err.Error())
+		return "", false
+	}
+	if result != walk.DlgCmdOK {
+		return "", false
+	}
+	name := strings.TrimSpace(nameEdit.Text())
+	return name, name != ""
+}
+
+// openEditDialog はワークスペースのルート一覧を編集するダイアログを表示する。
+func (wp *WorkspacePicker) openEditDialog(ws workspace) (workspace, bool) {
+	owner := wp.owner()
+	if owner == nil {
+		return ws, false
+	}
+	edited := workspace{Name: ws.Name, Roots: append([]workspaceRoot{}, ws.Roots...)}
+	labels := func() []string {
+		values := make([]string, 0, len(edited.Roots))
+		for _, root := range edited.Roots {
+			values = append(values, root.label())
+		}
+		return values
+	}
+	var dlg *walk.Dialog
+	var rootList *walk.ListBox
+	var acceptButton *walk.PushButton
+	var cancelButton *walk.PushButton
+	editRoot := func() {
+		index := rootList.CurrentIndex()
+		if index < 0 || index >= len(edited.Roots) {
+			return
+		}
+		if root, ok := wp.openRootDialog(dlg, edited.Roots[index]); ok {
+			edited.Roots[index] = root
+			_ = rootList.SetModel(labels())
+		}
+	}
+	result, err := declarative.Dialog{
+		AssignTo:      &dlg,
+		Title:         fmt.Sprintf("%s - %s", wp.t(messages.LabelWorkspaceEdit), ws.Name),
+		MinSize:       declarative.Size{Width: 640, Height: 320},
+		Layout:        declarative.VBox{},
+		DefaultButton: &acceptButton,
+		CancelButton:  &cancelButton,
+		Children: []declarative.Widget{
+			declarative.ListBox{
+				AssignTo:        &rootList,
+				Model:           labels(),
+				MinSize:         declarative.Size{Width: 620, Height: 240},
+				OnItemActivated: editRoot,
+			},
+			declarative.Composite{
+				Layout: declarative.HBox{MarginsZero: true},
+				Children: []declarative.Widget{
+					declarative.PushButton{
+						Text:      wp.t(messages.LabelWorkspaceRootSettings),
+						OnClicked: editRoot,
+					},
+					declarative.PushButton{
+						Text: wp.t(messages.LabelWorkspaceRemoveRoot),
+						OnClicked: func() {
+							index := rootList.CurrentIndex()
+							if index < 0 || index >= len(edited.Roots) {
+								return
+							}
+							edited.Roots = append(edited.Roots[:index], edited.Roots[index+1:]...)
+							_ = rootList.SetModel(labels())
+						},
+					},
+					declarative.HSpacer{},
+				},
+			},
+			wp.dialogButtons(&dlg, &acceptButton, &cancelButton),
+		},
+	}.Run(owner)
+	if err != nil {
+		wp.logger.Warn("ワークスペース編集ダイアログの表示に失敗しました: %s", err.Error())
+		return ws, false
+	}
+	return edited, result == walk.DlgCmdOK
+}
+
+// openRootDialog はルートの表示名と独自の走査条件を編集するダイアログを表示する。
+func (wp *WorkspacePicker) openRootDialog(owner walk.Form, root workspaceRoot) (workspaceRoot, bool) {
+	rules := scanner.Rules{}
+	if root.Rules != nil {
+		rules = *root.Rules
+	} else if wp.defaultRules != nil {
+		rules = wp.defaultRules()
+	}
+	var dlg *walk.Dialog
+	var aliasEdit *walk.LineEdit
+	var ownRulesCheck *walk.CheckBox
+	var acceptButton *walk.PushButton
+	var cancelButton *walk.PushButton
+	fields := &scanRulesFields{}
+	children := []declarative.Widget{
+		declarative.TextLabel{
+			Text: root.Path,
+		},
+		declarative.TextLabel{
+			Text: wp.t(messages.LabelWorkspaceAlias),
+		},
+		declarative.LineEdit{
+			AssignTo:  &aliasEdit,
+			Text:      root.Alias,
+			CueBanner: root.Path,
+		},
+		declarative.CheckBox{
+			AssignTo: &ownRulesCheck,
+			Text:     wp.t(messages.LabelWorkspaceOwnRules),
+			Checked:  root.Rules != nil,
+			OnCheckedChanged: func() {
+				fields.setEnabled(ownRulesCheck.Checked())
+			},
+		},
+	}
+	children = append(children, fields.widgets(wp.translator, rules)...)
+	children = append(children, wp.dialogButtons(&dlg, &acceptButton, &cancelButton))
+	if err := (declarative.Dialog{
+		AssignTo:      &dlg,
+		Title:         wp.t(messages.LabelWorkspaceRootSettings),
+		MinSize:       declarative.Size{Width: 480, Height: 420},
+		Layout:        declarative.VBox{},
+		DefaultButton: &acceptButton,
+		CancelButton:  &cancelButton,
+		Children:      children,
+	}).Create(owner); err != nil {
+		wp.logger.Warn("ルート設定ダイアログの表示に失敗しました: %s", err.Error())
+		return root, false
+	}
+	fields.setEnabled(root.Rules != nil)
+	if dlg.Run() != walk.DlgCmdOK {
+		return root, false
+	}
+	root.Alias = strings.TrimSpace(aliasEdit.Text())
+	root.Rules = nil
+	if ownRulesCheck.Checked() {
+		updated := fields.rules()
+		root.Rules = &updated
+	}
+	return root, true
+}
+
+// dialogButtons はダイアログのOK・キャンセルボタンを生成する。
+func (wp *WorkspacePicker) dialogButtons(dlg **walk.Dialog, acceptButton **walk.PushButton, cancelButton **walk.PushButton) declarative.Composite {
+	return declarative.Composite{
+		Layout: declarative.HBox{MarginsZero: true},
+		Children: []declarative.Widget{
+			declarative.HSpacer{},
+			declarative.PushButton{
+				AssignTo: acceptButton,
+				Text:     wp.t("OK"),
+				OnClicked: func() {
+					(*dlg).Accept()
+				},
+			},
+			declarative.PushButton{
+				AssignTo: cancelButton,
+				Text:     wp.t("キャンセル"),
+				OnClicked: func() {
+					(*dlg).Cancel()
+				},
+			},
+		},
+	}
+}
+
+// refreshCombo は選択肢と選択位置を現在の一覧に合わせる。
+func (wp *WorkspacePicker) refreshCombo() {
+	if wp.combo == nil {
+		return
+	}
+	wp.updating = true
+	defer func() {
+		wp.updating = false
+	}()
+	if err := wp.combo.SetModel(wp.names()); err != nil {
+		wp.logger.Warn("ワークスペース一覧の更新に失敗しました: %s", logging.FormatError(err, wp.logger))
+		return
+	}
+	_ = wp.combo.SetCurrentIndex(wp.indexOf(wp.current))
+}
+
+// persist はワークスペース一覧を保存する。
+func (wp *WorkspacePicker) persist() {
+	if err := saveWorkspaces(wp.userConfig, wp.workspaces); err != nil {
+		wp.logger.Warn("ワークスペースの保存に失敗しました: %s", logging.FormatError(err, wp.logger))
+	}
+}
+
+// names はワークスペース名の一覧を返す。
+func (wp *WorkspacePicker) names() []string {
+	names := make([]string, 0, len(wp.workspaces))
+	for _, ws := range wp.workspaces {
+		names = append(names, ws.Name)
+	}
+	return names
+}
+
+// indexOf は指定名のワークスペースの位置を返す。見つからない場合は-1を返す。
+func (wp *WorkspacePicker) indexOf(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, ws := range wp.workspaces {
+		if ws.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// owner はダイアログの親フォームを返す。
+func (wp *WorkspacePicker) owner() walk.Form {
+	if wp.window != nil {
+		return wp.window
+	}
+	return walk.App().ActiveForm()
+}
+
+// t は翻訳文字列を返す。
+func (wp *WorkspacePicker) t(key string) string {
+	return i18n.TranslateOrMark(wp.translator, key)
+}
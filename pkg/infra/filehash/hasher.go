@@ -0,0 +1,94 @@
+// 指示: miu200521358
+package filehash
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+)
+
+// cachedHash は求めたハッシュと、その時点のファイルの状態を表す。
+type cachedHash struct {
+	hash    string
+	size    int64
+	modTime int64
+}
+
+// Hasher はファイル内容のSHA-256を求める。ファイルの更新日時とサイズが変わらない間は結果を再利用する。
+type Hasher struct {
+	mu      sync.Mutex
+	entries map[string]cachedHash
+}
+
+// NewHasher はHasherを生成する。
+func NewHasher() *Hasher {
+	return &Hasher{entries: map[string]cachedHash{}}
+}
+
+// Stat はファイルサイズと更新日時(UnixNano)を返す。アーカイブ内の仮想パスはエントリの値を返す。
+func (h *Hasher) Stat(path string) (int64, int64, error) {
+	info, err := archive.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Size(), info.ModTime().UnixNano(), nil
+}
+
+// Open はファイルまたはアーカイブ内のエントリを開き、サイズと更新日時(UnixNano)を返す。
+func (h *Hasher) Open(path string) (io.ReadCloser, int64, int64, error) {
+	return open(path)
+}
+
+// Hash はファイル内容全体のSHA-256を16進文字列で返す。ctxが取り消された場合は読み込みを中断する。
+func (h *Hasher) Hash(ctx context.Context, path string) (string, error) {
+	reader, size, modTime, err := open(path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	key := strings.ToLower(path)
+	h.mu.Lock()
+	cached, ok := h.entries[key]
+	h.mu.Unlock()
+	if ok && cached.size == size && cached.modTime == modTime {
+		return cached.hash, nil
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, contextReader{ctx: ctx, reader: reader}); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(digest.Sum(nil))
+	h.mu.Lock()
+	h.entries[key] = cachedHash{hash: hash, size: size, modTime: modTime}
+	h.mu.Unlock()
+	return hash, nil
+}
+
+// open はファイルまたはアーカイブ内のエントリを開き、サイズと更新日時を返す。
+func open(path string) (io.ReadCloser, int64, int64, error) {
+	reader, info, err := archive.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return reader, info.Size(), info.ModTime().UnixNano(), nil
+}
+
+// contextReader はctxが取り消された後の読み込みをエラーにするReaderを表す。
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read はctxが有効な間だけ元のReaderから読み込む。
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
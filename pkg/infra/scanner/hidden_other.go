@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+// 指示: miu200521358
+package scanner
+
+import "os"
+
+// isHiddenEntry は隠し属性が無い環境では常にfalseを返す。名前による判定は除外規則側で行う。
+func isHiddenEntry(_ os.DirEntry) bool {
+	return false
+}
+
+// isHiddenPath は隠し属性が無い環境では常にfalseを返す。
+func isHiddenPath(_ string) bool {
+	return false
+}
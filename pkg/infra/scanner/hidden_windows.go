@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package scanner
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// isHiddenEntry はエントリに隠し属性が付いているか判定する。
+func isHiddenEntry(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&windows.FILE_ATTRIBUTE_HIDDEN != 0
+}
+
+// isHiddenPath は指定パスに隠し属性が付いているか判定する。
+func isHiddenPath(path string) bool {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	attrs, err := windows.GetFileAttributes(pathPtr)
+	return err == nil && attrs&windows.FILE_ATTRIBUTE_HIDDEN != 0
+}
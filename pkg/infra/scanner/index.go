@@ -0,0 +1,222 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// indexVersion は走査インデックスの保存形式のバージョンを表す。
+	indexVersion = 3
+)
+
+// ErrIndexCorrupted はインデックスファイルが読み込めないことを表す。
+var ErrIndexCorrupted = errors.New("scan index is corrupted")
+
+// Index はディレクトリの更新日時と対象ファイルを記録する永続インデックスを表す。
+type Index struct {
+	mu    sync.Mutex
+	path  string
+	roots map[string]*indexRoot
+	dirty bool
+}
+
+// indexFile はインデックスの保存形式を表す。
+type indexFile struct {
+	Version int                   `json:"version"`
+	Roots   map[string]*indexRoot `json:"roots"`
+}
+
+// indexRoot はルート単位の記録を表す。
+type indexRoot struct {
+	Path      string               `json:"path"`
+	Signature string               `json:"signature"`
+	Dirs      map[string]*indexDir `json:"dirs"`
+}
+
+// indexDir はディレクトリ単位の記録を表す。
+type indexDir struct {
+	ModTime int64    `json:"mtime"`
+	Files   []string `json:"files,omitempty"`
+	Dirs    []string `json:"dirs,omitempty"`
+	Hidden  []string `json:"hidden,omitempty"`
+	Links   []string `json:"links,omitempty"`
+	Ignore  bool     `json:"ignore,omitempty"`
+}
+
+// listing は記録をディレクトリ一覧に変換する。
+func (d *indexDir) listing() dirListing {
+	return dirListing{files: d.Files, dirs: d.Dirs, hidden: d.Hidden, links: d.Links, hasIgnore: d.Ignore}
+}
+
+// NewIndex は指定パスに保存する空のインデックスを生成する。
+func NewIndex(path string) *Index {
+	return &Index{path: path, roots: map[string]*indexRoot{}}
+}
+
+// LoadIndex は指定パスからインデックスを読み込む。
+// 破損やバージョン不一致の場合は空のインデックスとエラーを返し、以後の保存で上書きする。
+func LoadIndex(path string) (*Index, error) {
+	idx := NewIndex(path)
+	if path == "" {
+		return idx, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return idx, nil
+		}
+		return idx, err
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		idx.dirty = true
+		return idx, fmt.Errorf("%w: %v", ErrIndexCorrupted, err)
+	}
+	if file.Version != indexVersion {
+		// 旧形式は読み捨てて作り直す。
+		idx.dirty = true
+		return idx, nil
+	}
+	for key, root := range file.Roots {
+		if root == nil || root.Dirs == nil {
+			continue
+		}
+		idx.roots[key] = root
+	}
+	return idx, nil
+}
+
+// Path は保存先のパスを返す。
+func (idx *Index) Path() string {
+	if idx == nil {
+		return ""
+	}
+	return idx.path
+}
+
+// Save は変更がある場合にインデックスを保存する。
+func (idx *Index) Save() error {
+	if idx == nil || idx.path == "" {
+		return nil
+	}
+	idx.mu.Lock()
+	if !idx.dirty {
+		idx.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(indexFile{Version: indexVersion, Roots: idx.roots})
+	idx.dirty = false
+	idx.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(idx.path, data)
+	}
+	if err != nil {
+		idx.mu.Lock()
+		idx.dirty = true
+		idx.mu.Unlock()
+	}
+	return err
+}
+
+// writeFileAtomic は書き込み途中で中断しても既存ファイルを壊さないよう一時ファイル経由で保存する。
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// InvalidateRoot は指定ルートの記録を破棄する。
+func (idx *Index) InvalidateRoot(root string) {
+	if idx == nil || root == "" {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	key := indexKey(root)
+	if _, ok := idx.roots[key]; ok {
+		delete(idx.roots, key)
+		idx.dirty = true
+	}
+}
+
+// prepareRoot は走査条件が一致しないルートの記録を破棄する。
+func (idx *Index) prepareRoot(root string, signature string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	key := indexKey(root)
+	entry := idx.roots[key]
+	if entry != nil && entry.Signature == signature {
+		return
+	}
+	idx.roots[key] = &indexRoot{Path: root, Signature: signature, Dirs: map[string]*indexDir{}}
+	idx.dirty = true
+}
+
+// lookup は更新日時が一致するディレクトリの記録を返す。
+func (idx *Index) lookup(root string, dir string, modTime time.Time) (*indexDir, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	entry := idx.roots[indexKey(root)]
+	if entry == nil {
+		return nil, false
+	}
+	record := entry.Dirs[indexKey(dir)]
+	if record == nil || record.ModTime != modTime.UnixNano() {
+		return nil, false
+	}
+	return record, true
+}
+
+// store はディレクトリの記録を更新する。
+func (idx *Index) store(root string, dir string, modTime time.Time, listing dirListing) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	entry := idx.roots[indexKey(root)]
+	if entry == nil {
+		return
+	}
+	entry.Dirs[indexKey(dir)] = &indexDir{
+		ModTime: modTime.UnixNano(),
+		Files:   listing.files,
+		Dirs:    listing.dirs,
+		Hidden:  listing.hidden,
+		Links:   listing.links,
+		Ignore:  listing.hasIgnore,
+	}
+	idx.dirty = true
+}
+
+// retain は走査で到達しなかったディレクトリの記録を破棄する。
+func (idx *Index) retain(root string, visited map[string]struct{}) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	entry := idx.roots[indexKey(root)]
+	if entry == nil {
+		return
+	}
+	for key := range entry.Dirs {
+		if _, ok := visited[key]; ok {
+			continue
+		}
+		delete(entry.Dirs, key)
+		idx.dirty = true
+	}
+}
+
+// indexKey はパスの比較用キーを返す。
+func indexKey(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
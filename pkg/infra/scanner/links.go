@@ -0,0 +1,71 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// isLinkEntry はシンボリックリンクまたはジャンクションのエントリか判定する。
+// Windowsのジャンクションはos.ModeIrregularとして返る。
+func isLinkEntry(entry fs.DirEntry) bool {
+	return entry.Type()&(os.ModeSymlink|os.ModeIrregular) != 0
+}
+
+// isLinkedDir はリンク先がフォルダか判定する。リンク切れの場合はfalseを返す。
+func isLinkedDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// realDirKey はリンクを解決した実体パスを比較用のキーで返す。
+func realDirKey(dir string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false
+	}
+	return indexKey(resolved), true
+}
+
+// realDirSet は走査済みフォルダの実体パスを記録し、循環や重複した到達を検出する。
+type realDirSet struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// newRealDirSet はrealDirSetを生成する。
+func newRealDirSet() *realDirSet {
+	return &realDirSet{keys: map[string]struct{}{}}
+}
+
+// claim は実体パスを記録する。記録済みの場合はfalseを返す。
+// アーカイブ内など実体パスを解決できない場合は記録せずtrueを返す。
+func (s *realDirSet) claim(dir string) bool {
+	key, ok := realDirKey(dir)
+	if !ok {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keys[key]; exists {
+		return false
+	}
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// linksToAncestor はリンク先が指定フォルダ自身またはその上位フォルダか判定する。
+func linksToAncestor(dir string, link string) bool {
+	dirKey, ok := realDirKey(dir)
+	if !ok {
+		return true
+	}
+	linkKey, ok := realDirKey(link)
+	if !ok {
+		return true
+	}
+	return dirKey == linkKey || strings.HasPrefix(dirKey, strings.TrimSuffix(linkKey, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,77 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// DirOptions はフォルダ単位の確認条件を表す。
+type DirOptions struct {
+	// Match は対象ファイルか判定する。nilの場合は全ファイルを対象とする。
+	Match func(path string) bool
+	// Filter は除外規則。nilの場合は除外しない。
+	Filter *Filter
+	// Archives はZIPアーカイブを仮想フォルダとして扱う。
+	Archives bool
+}
+
+// ContainsMatch は指定フォルダ配下に対象ファイルが1件以上あるか判定する。
+// 最初に見つかった時点で探索を打ち切る。
+func ContainsMatch(ctx context.Context, dir string, opts DirOptions) bool {
+	if dir == "" {
+		return false
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var realDirs *realDirSet
+	if opts.Filter.FollowsLinks() {
+		realDirs = newRealDirSet()
+	}
+	stack := []string{dir}
+	for len(stack) > 0 {
+		if ctx.Err() != nil {
+			return false
+		}
+		last := len(stack) - 1
+		current := stack[last]
+		stack = stack[:last]
+		if realDirs != nil && !realDirs.claim(current) {
+			// リンクの循環で同じ実体を繰り返し辿らない。
+			continue
+		}
+		listing, err := listDir(current, opts.Match, opts.Archives)
+		if err != nil && len(listing.files) == 0 && len(listing.dirs) == 0 {
+			continue
+		}
+		// 直下のファイルを先に確認し、浅い位置で見つかる場合の読み込みを減らす。
+		files, subDirs := opts.Filter.apply(current, listing)
+		if len(files) > 0 {
+			return true
+		}
+		for i := len(subDirs) - 1; i >= 0; i-- {
+			stack = append(stack, filepath.Join(current, subDirs[i]))
+		}
+	}
+	return false
+}
+
+// ReadDir は指定フォルダ直下の対象ファイル名とサブフォルダ名を、除外規則を適用して返す。
+// リンクを辿る場合、自身または上位フォルダを指すリンクは循環となるため返さない。
+func ReadDir(dir string, opts DirOptions) (files []string, subDirs []string, err error) {
+	listing, err := listDir(dir, opts.Match, opts.Archives)
+	files, subDirs = opts.Filter.apply(dir, listing)
+	if len(listing.links) == 0 || !opts.Filter.FollowsLinks() {
+		return files, subDirs, err
+	}
+	filtered := subDirs[:0]
+	for _, name := range subDirs {
+		subDir := filepath.Join(dir, name)
+		if opts.Filter.IsLink(subDir) && linksToAncestor(dir, subDir) {
+			continue
+		}
+		filtered = append(filtered, name)
+	}
+	return files, filtered, err
+}
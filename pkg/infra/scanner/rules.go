@@ -0,0 +1,462 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// IgnoreFileName は除外規則を記述するファイル名を表す。
+	IgnoreFileName = ".mutreeignore"
+)
+
+// Rules は走査対象を絞り込む条件を表す。
+type Rules struct {
+	// Include は対象とするファイルのパターン。空の場合は全ファイルを対象とする。
+	Include []string
+	// Exclude は除外するファイル・フォルダのパターン。
+	Exclude []string
+	// MaxDepth はルートから辿るフォルダ階層の上限。0以下は無制限。
+	MaxDepth int
+	// SkipHidden は隠しフォルダを除外するか。
+	SkipHidden bool
+	// FollowLinks はシンボリックリンク・ジャンクション先のフォルダも走査するか。
+	FollowLinks bool
+}
+
+// ExclusionKind は除外理由の種類を表す。
+type ExclusionKind int
+
+const (
+	// ExcludeByIgnoreFile は除外規則ファイルによる除外を表す。
+	ExcludeByIgnoreFile ExclusionKind = iota
+	// ExcludeByPattern は共通の除外パターンによる除外を表す。
+	ExcludeByPattern
+	// ExcludeByInclude は対象パターンに一致しないことによる除外を表す。
+	ExcludeByInclude
+	// ExcludeByDepth は階層上限による除外を表す。
+	ExcludeByDepth
+	// ExcludeByHidden は隠しフォルダによる除外を表す。
+	ExcludeByHidden
+)
+
+// Exclusion は除外理由ごとの件数を表す。
+type Exclusion struct {
+	Kind ExclusionKind
+	// Source は除外規則ファイルのパスと行番号。除外規則ファイル以外は空。
+	Source  string
+	Pattern string
+	Count   int
+}
+
+// exclusionRule は除外理由を表す。
+type exclusionRule struct {
+	kind    ExclusionKind
+	source  string
+	pattern string
+}
+
+// ignorePattern はgitignore形式の1パターンを表す。
+type ignorePattern struct {
+	rule     exclusionRule
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+// ruleLayer はフォルダ単位の除外規則を表す。
+type ruleLayer struct {
+	parent   *ruleLayer
+	base     string
+	patterns []ignorePattern
+}
+
+// Filter はルート配下の除外規則を評価し、除外件数を集計する。
+type Filter struct {
+	root    string
+	rules   Rules
+	exclude []ignorePattern
+	include []ignorePattern
+
+	mu       sync.Mutex
+	layers   map[string]*ruleLayer
+	excluded map[string]exclusionRule
+	links    map[string]struct{}
+}
+
+// NewFilter は指定ルートを基準とするFilterを生成する。
+func NewFilter(root string, rules Rules) *Filter {
+	f := &Filter{
+		root:     filepath.Clean(root),
+		rules:    rules,
+		layers:   map[string]*ruleLayer{},
+		excluded: map[string]exclusionRule{},
+		links:    map[string]struct{}{},
+	}
+	for _, pattern := range rules.Exclude {
+		if parsed, ok := parseIgnorePattern(pattern, exclusionRule{kind: ExcludeByPattern, pattern: strings.TrimSpace(pattern)}); ok {
+			f.exclude = append(f.exclude, parsed)
+		}
+	}
+	for _, pattern := range rules.Include {
+		if parsed, ok := parseIgnorePattern(pattern, exclusionRule{kind: ExcludeByInclude, pattern: strings.TrimSpace(pattern)}); ok {
+			f.include = append(f.include, parsed)
+		}
+	}
+	return f
+}
+
+// Root は基準となるルートパスを返す。
+func (f *Filter) Root() string {
+	if f == nil {
+		return ""
+	}
+	return f.root
+}
+
+// ExcludedCount は除外したファイル・フォルダの件数を返す。
+func (f *Filter) ExcludedCount() int {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.excluded)
+}
+
+// FollowsLinks はリンク先のフォルダを走査するか判定する。
+func (f *Filter) FollowsLinks() bool {
+	return f != nil && f.rules.FollowLinks
+}
+
+// IsLink は指定パスが走査時に辿ったリンクのフォルダか判定する。
+func (f *Filter) IsLink(path string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.links[indexKey(path)]
+	return ok
+}
+
+// Exclusions は除外理由ごとの件数を件数の多い順で返す。
+func (f *Filter) Exclusions() []Exclusion {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	counts := map[exclusionRule]int{}
+	for _, rule := range f.excluded {
+		counts[rule]++
+	}
+	f.mu.Unlock()
+
+	result := make([]Exclusion, 0, len(counts))
+	for rule, count := range counts {
+		result = append(result, Exclusion{Kind: rule.kind, Source: rule.source, Pattern: rule.pattern, Count: count})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Pattern < result[j].Pattern
+	})
+	return result
+}
+
+// Allow は指定パスが除外規則で除外されないか判定する。上位フォルダの除外も考慮する。
+func (f *Filter) Allow(target string, isDir bool) bool {
+	if f == nil {
+		return true
+	}
+	target = filepath.Clean(target)
+	rel, err := filepath.Rel(f.root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	current := f.root
+	for i, part := range parts {
+		last := i == len(parts)-1
+		entryIsDir := !last || isDir
+		hidden := entryIsDir && isHiddenPath(filepath.Join(current, part))
+		layer := f.layer(current, true)
+		if rule, excluded := f.evaluate(layer, current, part, entryIsDir, hidden); excluded {
+			f.record(filepath.Join(current, part), rule)
+			return false
+		}
+		current = filepath.Join(current, part)
+	}
+	return true
+}
+
+// apply はフォルダ直下の一覧に除外規則を適用する。
+func (f *Filter) apply(dir string, listing dirListing) (files []string, subDirs []string) {
+	if f == nil {
+		return listing.files, listing.dirs
+	}
+	layer := f.layer(dir, listing.hasIgnore)
+	hidden := map[string]struct{}{}
+	for _, name := range listing.hidden {
+		hidden[name] = struct{}{}
+	}
+	for _, name := range listing.dirs {
+		_, isHidden := hidden[name]
+		if rule, excluded := f.evaluate(layer, dir, name, true, isHidden); excluded {
+			f.record(filepath.Join(dir, name), rule)
+			continue
+		}
+		subDirs = append(subDirs, name)
+	}
+	if f.rules.FollowLinks {
+		for _, name := range listing.links {
+			_, isHidden := hidden[name]
+			target := filepath.Join(dir, name)
+			if rule, excluded := f.evaluate(layer, dir, name, true, isHidden); excluded {
+				f.record(target, rule)
+				continue
+			}
+			f.mu.Lock()
+			f.links[indexKey(target)] = struct{}{}
+			f.mu.Unlock()
+			subDirs = append(subDirs, name)
+		}
+	}
+	for _, name := range listing.files {
+		if rule, excluded := f.evaluate(layer, dir, name, false, false); excluded {
+			f.record(filepath.Join(dir, name), rule)
+			continue
+		}
+		files = append(files, name)
+	}
+	return files, subDirs
+}
+
+// evaluate はフォルダ直下のエントリが除外されるか判定する。
+func (f *Filter) evaluate(layer *ruleLayer, dir string, name string, isDir bool, hidden bool) (exclusionRule, bool) {
+	if isDir && f.rules.SkipHidden && (hidden || strings.HasPrefix(name, ".")) {
+		return exclusionRule{kind: ExcludeByHidden}, true
+	}
+	if isDir && f.rules.MaxDepth > 0 && f.depth(dir)+1 > f.rules.MaxDepth {
+		return exclusionRule{kind: ExcludeByDepth}, true
+	}
+	target := filepath.Join(dir, name)
+
+	// 深い階層の規則ほど優先し、最後に一致したパターンで判定する。
+	var chain []*ruleLayer
+	for current := layer; current != nil; current = current.parent {
+		chain = append(chain, current)
+	}
+	var matched *ignorePattern
+	for i := len(chain) - 1; i >= 0; i-- {
+		rel := slashRel(chain[i].base, target)
+		for j := range chain[i].patterns {
+			pattern := &chain[i].patterns[j]
+			if pattern.match(rel, isDir) {
+				matched = pattern
+			}
+		}
+	}
+	if matched != nil && !matched.negate {
+		return matched.rule, true
+	}
+
+	// 共通の除外パターンは除外規則ファイルより優先する。
+	rel := slashRel(f.root, target)
+	for _, pattern := range f.exclude {
+		if !pattern.negate && pattern.match(rel, isDir) {
+			return pattern.rule, true
+		}
+	}
+	if !isDir && len(f.include) > 0 {
+		for _, pattern := range f.include {
+			if pattern.match(rel, false) {
+				return exclusionRule{}, false
+			}
+		}
+		return exclusionRule{kind: ExcludeByInclude}, true
+	}
+	return exclusionRule{}, false
+}
+
+// depth はルートからのフォルダ階層数を返す。
+func (f *Filter) depth(dir string) int {
+	rel, err := filepath.Rel(f.root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// record は除外したパスと理由を記録する。
+func (f *Filter) record(target string, rule exclusionRule) {
+	f.mu.Lock()
+	f.excluded[indexKey(target)] = rule
+	f.mu.Unlock()
+}
+
+// layer は指定フォルダまでの除外規則を返す。hasIgnoreがfalseの場合は除外規則ファイルを読まない。
+func (f *Filter) layer(dir string, hasIgnore bool) *ruleLayer {
+	dir = filepath.Clean(dir)
+	key := indexKey(dir)
+	f.mu.Lock()
+	cached, ok := f.layers[key]
+	f.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	var parent *ruleLayer
+	if !sameDir(dir, f.root) {
+		rel, err := filepath.Rel(f.root, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+		// 上位フォルダは一覧を持たないため除外規則ファイルの有無を直接確認する。
+		parent = f.layer(filepath.Dir(dir), true)
+	}
+	var patterns []ignorePattern
+	if hasIgnore {
+		patterns = f.readIgnoreFile(dir)
+	}
+	current := parent
+	if len(patterns) > 0 {
+		current = &ruleLayer{parent: parent, base: dir, patterns: patterns}
+	}
+
+	f.mu.Lock()
+	f.layers[key] = current
+	f.mu.Unlock()
+	return current
+}
+
+// readIgnoreFile は指定フォルダの除外規則ファイルを読み込む。
+func (f *Filter) readIgnoreFile(dir string) []ignorePattern {
+	ignorePath := filepath.Join(dir, IgnoreFileName)
+	data, err := os.ReadFile(ignorePath)
+	if err != nil {
+		return nil
+	}
+	source := ignorePath
+	if rel, relErr := filepath.Rel(f.root, ignorePath); relErr == nil {
+		source = filepath.ToSlash(rel)
+	}
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		rule := exclusionRule{
+			kind:    ExcludeByIgnoreFile,
+			source:  source + ":" + strconv.Itoa(line),
+			pattern: strings.TrimSpace(text),
+		}
+		if parsed, ok := parseIgnorePattern(text, rule); ok {
+			patterns = append(patterns, parsed)
+		}
+	}
+	return patterns
+}
+
+// parseIgnorePattern はgitignore形式の1行を解析する。空行とコメントはfalseを返す。
+func parseIgnorePattern(line string, rule exclusionRule) (ignorePattern, bool) {
+	text := strings.TrimSpace(line)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return ignorePattern{}, false
+	}
+	pattern := ignorePattern{rule: rule}
+	if strings.HasPrefix(text, "!") {
+		pattern.negate = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\`) {
+		text = text[1:]
+	}
+	text = strings.ToLower(strings.ReplaceAll(text, `\`, "/"))
+	if strings.HasSuffix(text, "/") {
+		pattern.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	if strings.Contains(text, "/") {
+		// 途中にスラッシュを含むパターンは規則ファイルの位置からの相対パスとして扱う。
+		pattern.anchored = true
+		text = strings.TrimPrefix(text, "/")
+	}
+	if text == "" {
+		return ignorePattern{}, false
+	}
+	pattern.segments = strings.Split(text, "/")
+	return pattern, true
+}
+
+// match は基準フォルダからの相対パスがパターンに一致するか判定する。
+func (p *ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	rel = strings.ToLower(rel)
+	if !p.anchored {
+		return matchSegment(p.segments[0], path.Base(rel))
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments は「**」を含むパターンをパス要素単位で照合する。
+func matchSegments(pattern []string, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 || !matchSegment(pattern[0], parts[0]) {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// matchSegment は1要素分のワイルドカードを照合する。
+func matchSegment(pattern string, name string) bool {
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// slashRel は基準フォルダからの相対パスをスラッシュ区切りで返す。
+func slashRel(base string, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return filepath.ToSlash(filepath.Base(target))
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sameDir は2つのフォルダパスが同一か判定する。
+func sameDir(a string, b string) bool {
+	return indexKey(a) == indexKey(b)
+}
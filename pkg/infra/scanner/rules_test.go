@@ -0,0 +1,70 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterAllow(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, root, "# コメント\n*.tmp\n!keep.tmp\ncache/\n/top.pmx\ndocs/**/draft\n**/old\n\\!bang.pmx\n")
+	writeIgnoreFile(t, filepath.Join(root, "sub"), "!b.tmp\n")
+
+	tests := []struct {
+		name  string
+		rules Rules
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "ルート自身", path: ".", isDir: true, want: true},
+		{name: "規則に無いファイル", path: "miku.pmx", want: true},
+		{name: "ワイルドカード", path: "a.tmp", want: false},
+		{name: "否定", path: "keep.tmp", want: true},
+		{name: "下位フォルダにも適用", path: "x/a.tmp", want: false},
+		{name: "下位の規則ファイルを優先", path: "sub/b.tmp", want: true},
+		{name: "下位の規則ファイルの対象外", path: "sub/c.tmp", want: false},
+		{name: "フォルダ限定", path: "cache", isDir: true, want: false},
+		{name: "フォルダ限定はファイルに一致しない", path: "cache", want: true},
+		{name: "除外したフォルダの配下", path: "x/cache/miku.pmx", want: false},
+		{name: "先頭スラッシュで固定", path: "top.pmx", want: false},
+		{name: "固定したパターンは下位に一致しない", path: "x/top.pmx", want: true},
+		{name: "途中の「**」は0階層にも一致", path: "docs/draft", isDir: true, want: false},
+		{name: "途中の「**」は複数階層に一致", path: "docs/a/b/draft", isDir: true, want: false},
+		{name: "「**」の外側は一致しない", path: "x/docs/draft", isDir: true, want: true},
+		{name: "先頭の「**」", path: "a/b/old/miku.pmx", want: false},
+		{name: "エスケープした感嘆符", path: "!bang.pmx", want: false},
+		{name: "大文字小文字を区別しない", path: "A.TMP", want: false},
+		{name: "ドットで始まる名前", path: "..hidden/miku.pmx", want: true},
+		{name: "ドットが続く名前", path: "...models/miku.pmx", want: true},
+		{name: "ルートの外", path: "../other/miku.pmx", want: false},
+		{name: "共通の除外パターン", rules: Rules{Exclude: []string{"*.bak"}}, path: "x/miku.bak", want: false},
+		{name: "対象パターンに一致", rules: Rules{Include: []string{"*.pmx"}}, path: "x/miku.pmx", want: true},
+		{name: "対象パターンに不一致", rules: Rules{Include: []string{"*.pmx"}}, path: "x/miku.vmd", want: false},
+		{name: "隠しフォルダ", rules: Rules{SkipHidden: true}, path: ".git/config", want: false},
+		{name: "階層上限内", rules: Rules{MaxDepth: 2}, path: "a/b/miku.pmx", want: true},
+		{name: "階層上限超え", rules: Rules{MaxDepth: 2}, path: "a/b/c/miku.pmx", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewFilter(root, tt.rules)
+			target := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := filter.Allow(target, tt.isDir); got != tt.want {
+				t.Errorf("Allow(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeIgnoreFile は指定フォルダに除外規則ファイルを作成する。
+func writeIgnoreFile(t *testing.T, dir string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
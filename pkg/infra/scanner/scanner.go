@@ -0,0 +1,514 @@
+// 指示: miu200521358
+// Package scanner はフォルダ配下のファイル探索を並列に行う。
+package scanner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/infra/archive"
+)
+
+const (
+	// defaultProgressInterval は進捗通知の既定間隔を表す。
+	defaultProgressInterval = 100 * time.Millisecond
+	// maxDefaultWorkers は既定ワーカー数の上限を表す。
+	maxDefaultWorkers = 16
+)
+
+// Options は探索条件を表す。
+type Options struct {
+	// Workers は同時にディレクトリを読むワーカー数。0以下は既定値。
+	Workers int
+	// Match は収集対象のファイルか判定する。nilの場合は全ファイルを対象とする。
+	Match func(path string) bool
+	// ProgressInterval は進捗通知の間隔。0以下は既定値。
+	ProgressInterval time.Duration
+	// Index は更新日時が変わっていないディレクトリの読み直しを省く永続インデックス。nilの場合は使わない。
+	Index *Index
+	// Signature はMatchの判定条件を表す文字列。変わった場合はインデックスの記録を破棄する。
+	Signature string
+	// Filter は除外規則。nilの場合は除外しない。インデックスには除外前の一覧を記録する。
+	Filter *Filter
+	// Archives はZIPアーカイブを仮想フォルダとして扱う。
+	Archives bool
+}
+
+// Progress は探索の進捗を表す。
+type Progress struct {
+	Root     string
+	Dirs     int64
+	Found    int64
+	Errors   int64
+	Reused   int64
+	Excluded int64
+	Done     bool
+	Elapsed  time.Duration
+}
+
+// ProgressFunc は進捗通知を受け取る関数を表す。
+type ProgressFunc func(Progress)
+
+// Scanner はワーカープールでディレクトリを走査する。
+type Scanner struct {
+	opts Options
+}
+
+// New はScannerを生成する。
+func New(opts Options) *Scanner {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers()
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = defaultProgressInterval
+	}
+	return &Scanner{opts: opts}
+}
+
+// defaultWorkers は既定のワーカー数を返す。
+func defaultWorkers() int {
+	// NAS等の遅延が大きい環境を考慮してCPU数より多めに確保する。
+	workers := runtime.NumCPU() * 2
+	if workers > maxDefaultWorkers {
+		workers = maxDefaultWorkers
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// Scan は指定ルート配下の対象ファイルを収集する。
+// ctxがキャンセルされた場合は収集済みのパスとキャンセルエラーを返す。
+func (s *Scanner) Scan(ctx context.Context, root string, onProgress ProgressFunc) ([]string, error) {
+	if s == nil {
+		return nil, errors.New("scanner is nil")
+	}
+	if root == "" {
+		return nil, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	run := newScanRun(ctx, s.opts, root)
+	stopProgress := run.startProgress(onProgress)
+	run.execute()
+	stopProgress()
+
+	paths := run.paths
+	sortPaths(paths)
+	errs := run.errs
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		errs = append(errs, ctxErr)
+	}
+	return paths, errors.Join(errs...)
+}
+
+// scanRun は1回分の走査状態を保持する。
+type scanRun struct {
+	ctx   context.Context
+	opts  Options
+	root  string
+	start time.Time
+	queue *dirQueue
+
+	dirs   atomic.Int64
+	found  atomic.Int64
+	errCnt atomic.Int64
+	reused atomic.Int64
+
+	mu      sync.Mutex
+	paths   []string
+	errs    []error
+	visited map[string]struct{}
+	// realDirs はリンクを辿る場合に走査済みフォルダの実体パスを記録する。
+	realDirs *realDirSet
+	// linkDirs はリンクを辿る場合に後回しにしたリンクのフォルダを表す。
+	linkDirs []string
+}
+
+// newScanRun は走査状態を初期化する。
+func newScanRun(ctx context.Context, opts Options, root string) *scanRun {
+	run := &scanRun{
+		ctx:     ctx,
+		opts:    opts,
+		root:    root,
+		start:   time.Now(),
+		queue:   newDirQueue(),
+		visited: map[string]struct{}{},
+	}
+	if opts.Filter.FollowsLinks() {
+		run.realDirs = newRealDirSet()
+	}
+	return run
+}
+
+// execute はワーカーを起動して走査完了まで待機する。
+func (r *scanRun) execute() {
+	info, err := os.Stat(r.root)
+	if err != nil {
+		r.addError(err)
+		return
+	}
+	if !info.IsDir() && !(r.opts.Archives && archive.IsArchive(r.root)) {
+		// ファイル指定時は単体で判定する。
+		if r.match(r.root) && r.opts.Filter.Allow(r.root, false) {
+			r.addPath(r.root)
+		}
+		return
+	}
+
+	if r.opts.Index != nil {
+		r.opts.Index.prepareRoot(r.root, r.opts.Signature)
+	}
+	stopWatch := context.AfterFunc(r.ctx, r.queue.close)
+	defer stopWatch()
+
+	r.queue.push(r.root)
+	for {
+		r.runWorkers()
+		// リンク先は実体のパスで到達できるフォルダを走査し終えてから辿り、
+		// 同じモデルがリンク経由のパスで重複して見つからないようにする。
+		r.mu.Lock()
+		linkDirs := r.linkDirs
+		r.linkDirs = nil
+		r.mu.Unlock()
+		if len(linkDirs) == 0 || r.ctx.Err() != nil {
+			break
+		}
+		for _, dir := range linkDirs {
+			r.queue.push(dir)
+		}
+	}
+
+	if r.opts.Index != nil && r.ctx.Err() == nil {
+		// 削除されたディレクトリの記録を残さない。
+		r.opts.Index.retain(r.root, r.visited)
+	}
+}
+
+// runWorkers はワーカーを起動し、キューが空になるまで待機する。
+func (r *scanRun) runWorkers() {
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work()
+		}()
+	}
+	wg.Wait()
+}
+
+// work はキューからディレクトリを取り出して処理する。
+func (r *scanRun) work() {
+	for {
+		dir, ok := r.queue.pop()
+		if !ok {
+			return
+		}
+		r.visitDir(dir)
+		r.queue.done()
+	}
+}
+
+// visitDir は1ディレクトリ分のエントリを処理する。
+func (r *scanRun) visitDir(dir string) {
+	if r.ctx.Err() != nil {
+		return
+	}
+	if r.realDirs != nil && !r.realDirs.claim(dir) {
+		// 別のパスで走査済みの実体、またはリンクの循環のため辿らない。
+		return
+	}
+	listing, err := r.readDir(dir)
+	r.dirs.Add(1)
+	if err != nil {
+		r.addError(err)
+		// 読めたエントリがあれば処理を続ける。
+	}
+	files, subDirs := r.opts.Filter.apply(dir, listing)
+	for _, name := range subDirs {
+		subDir := filepath.Join(dir, name)
+		if r.realDirs != nil && r.opts.Filter.IsLink(subDir) {
+			r.mu.Lock()
+			r.linkDirs = append(r.linkDirs, subDir)
+			r.mu.Unlock()
+			continue
+		}
+		r.queue.push(subDir)
+	}
+	for _, name := range files {
+		r.addPath(filepath.Join(dir, name))
+	}
+}
+
+// readDir はディレクトリ直下の一覧を返す。
+// インデックスの更新日時が一致する場合はディレクトリを読み直さない。
+func (r *scanRun) readDir(dir string) (dirListing, error) {
+	if r.opts.Archives {
+		if archivePath, inner, ok := archive.SplitPath(dir); ok {
+			// アーカイブ内の一覧は更新日時単位でarchive側がキャッシュする。
+			return listArchiveDir(archivePath, inner, dir, r.opts.Match)
+		}
+	}
+	var modTime time.Time
+	if r.opts.Index != nil {
+		if info, statErr := os.Stat(dir); statErr == nil {
+			modTime = info.ModTime()
+			if record, ok := r.opts.Index.lookup(r.root, dir, modTime); ok {
+				r.reused.Add(1)
+				r.markVisited(dir)
+				return record.listing(), nil
+			}
+		}
+	}
+
+	listing, err := listDir(dir, r.opts.Match, r.opts.Archives)
+	if r.opts.Index != nil && err == nil && !modTime.IsZero() {
+		r.opts.Index.store(r.root, dir, modTime, listing)
+		r.markVisited(dir)
+	}
+	return listing, err
+}
+
+// dirListing は除外規則を適用する前のディレクトリ直下の一覧を表す。
+type dirListing struct {
+	files     []string
+	dirs      []string
+	hidden    []string
+	links     []string
+	hasIgnore bool
+}
+
+// listDir はディレクトリ直下の対象ファイル名とサブディレクトリ名を読み込む。
+// archivesがtrueの場合はZIPアーカイブをサブディレクトリとして扱い、アーカイブ内も読み込む。
+func listDir(dir string, match func(path string) bool, archives bool) (dirListing, error) {
+	if archives {
+		if archivePath, inner, ok := archive.SplitPath(dir); ok {
+			return listArchiveDir(archivePath, inner, dir, match)
+		}
+	}
+	var listing dirListing
+	entries, err := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			listing.dirs = append(listing.dirs, name)
+			if isHiddenEntry(entry) {
+				listing.hidden = append(listing.hidden, name)
+			}
+			continue
+		}
+		if isLinkEntry(entry) && isLinkedDir(filepath.Join(dir, name)) {
+			// リンクのフォルダは除外規則の設定に応じて辿るため区別して記録する。
+			listing.links = append(listing.links, name)
+			if isHiddenEntry(entry) {
+				listing.hidden = append(listing.hidden, name)
+			}
+			continue
+		}
+		if strings.EqualFold(name, IgnoreFileName) {
+			listing.hasIgnore = true
+			continue
+		}
+		if archives && archive.IsArchive(name) {
+			listing.dirs = append(listing.dirs, name)
+			if isHiddenEntry(entry) {
+				listing.hidden = append(listing.hidden, name)
+			}
+			continue
+		}
+		if match == nil || match(filepath.Join(dir, name)) {
+			listing.files = append(listing.files, name)
+		}
+	}
+	return listing, err
+}
+
+// listArchiveDir はアーカイブ内の指定フォルダ直下の一覧を読み込む。
+func listArchiveDir(archivePath string, inner string, dir string, match func(path string) bool) (dirListing, error) {
+	var listing dirListing
+	entries, err := archive.List(archivePath)
+	if err != nil {
+		return listing, err
+	}
+	parent := inner
+	if parent == "" {
+		parent = "."
+	}
+	for _, entry := range entries {
+		if !strings.EqualFold(path.Dir(entry.Name), parent) {
+			continue
+		}
+		name := path.Base(entry.Name)
+		if entry.IsDir {
+			listing.dirs = append(listing.dirs, name)
+			continue
+		}
+		if match == nil || match(filepath.Join(dir, name)) {
+			listing.files = append(listing.files, name)
+		}
+	}
+	return listing, nil
+}
+
+// markVisited は走査で到達したディレクトリを記録する。
+func (r *scanRun) markVisited(dir string) {
+	r.mu.Lock()
+	r.visited[indexKey(dir)] = struct{}{}
+	r.mu.Unlock()
+}
+
+// match は収集対象か判定する。
+func (r *scanRun) match(path string) bool {
+	if r.opts.Match == nil {
+		return true
+	}
+	return r.opts.Match(path)
+}
+
+// addPath は収集結果を追加する。
+func (r *scanRun) addPath(path string) {
+	r.found.Add(1)
+	r.mu.Lock()
+	r.paths = append(r.paths, path)
+	r.mu.Unlock()
+}
+
+// addError はエラーを追加する。
+func (r *scanRun) addError(err error) {
+	if err == nil {
+		return
+	}
+	r.errCnt.Add(1)
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+// snapshot は現在の進捗を返す。
+func (r *scanRun) snapshot(done bool) Progress {
+	return Progress{
+		Root:     r.root,
+		Dirs:     r.dirs.Load(),
+		Found:    r.found.Load(),
+		Errors:   r.errCnt.Load(),
+		Reused:   r.reused.Load(),
+		Excluded: int64(r.opts.Filter.ExcludedCount()),
+		Done:     done,
+		Elapsed:  time.Since(r.start),
+	}
+}
+
+// startProgress は定期的な進捗通知を開始し、停止関数を返す。
+func (r *scanRun) startProgress(onProgress ProgressFunc) func() {
+	if onProgress == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(r.opts.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				onProgress(r.snapshot(false))
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-finished
+		onProgress(r.snapshot(true))
+	}
+}
+
+// dirQueue はワーカー間で共有する未処理ディレクトリのキューを表す。
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []string
+	pending int
+	closed  bool
+}
+
+// newDirQueue はdirQueueを生成する。
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push は未処理ディレクトリを追加する。
+func (q *dirQueue) push(dir string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, dir)
+	q.pending++
+	q.cond.Signal()
+}
+
+// pop は未処理ディレクトリを取り出す。全件処理済みまたは停止時はfalseを返す。
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && q.pending > 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed || len(q.items) == 0 {
+		return "", false
+	}
+	// 深さ優先で取り出してキューの肥大化を抑える。
+	last := len(q.items) - 1
+	dir := q.items[last]
+	q.items = q.items[:last]
+	return dir, true
+}
+
+// done は取り出したディレクトリの処理完了を記録する。
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending--
+	if q.pending <= 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// close はキューを停止して待機中のワーカーを解放する。
+func (q *dirQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// sortPaths はパス配列を大文字小文字を無視して昇順に整列する。
+func sortPaths(values []string) {
+	if len(values) < 2 {
+		return
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return strings.ToLower(values[i]) < strings.ToLower(values[j])
+	})
+}
@@ -0,0 +1,200 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultWatchDebounce は変更通知をまとめる既定の待機時間を表す。
+	defaultWatchDebounce = 300 * time.Millisecond
+	// defaultPollInterval はポーリング監視の既定間隔を表す。
+	defaultPollInterval = 30 * time.Second
+	// watchEventBuffer は監視元から受け取るイベントのバッファ数を表す。
+	watchEventBuffer = 256
+)
+
+// errNativeWatchUnsupported はOSの変更通知が使えないことを表す。
+var errNativeWatchUnsupported = errors.New("native watch is not supported")
+
+// WatchOp は変更の種類を表す。
+type WatchOp int
+
+const (
+	// WatchCreate はファイルまたはフォルダの追加を表す。
+	WatchCreate WatchOp = iota + 1
+	// WatchRemove はファイルまたはフォルダの削除を表す。
+	WatchRemove
+	// WatchRename はファイルまたはフォルダの名前変更を表す。
+	WatchRename
+	// WatchOverflow は通知の取りこぼしが発生し、全体の再走査が必要なことを表す。
+	WatchOverflow
+)
+
+// WatchEvent は監視対象で発生した変更を表す。
+type WatchEvent struct {
+	Op      WatchOp
+	Path    string
+	OldPath string
+}
+
+// WatchOptions は監視条件を表す。
+type WatchOptions struct {
+	// Match はポーリング時に比較対象とするファイルか判定する。
+	Match func(path string) bool
+	// Debounce は変更通知をまとめる待機時間。0以下は既定値。
+	Debounce time.Duration
+	// PollInterval はポーリング監視の間隔。0以下は既定値。
+	PollInterval time.Duration
+	// ForcePolling はOSの変更通知を使わずポーリングで監視する。
+	ForcePolling bool
+	// Archives はポーリング時にZIPアーカイブ内も比較対象とする。
+	Archives bool
+	// OnFallback はOSの変更通知が監視中に失敗し、ポーリングへ切り替えた際に呼ばれる。nilの場合は呼ばない。
+	OnFallback func(root string, err error)
+}
+
+// WatchHandler はまとめられた変更通知を受け取る関数を表す。
+type WatchHandler func(root string, events []WatchEvent)
+
+// Watcher はルート配下の変更を監視する。
+type Watcher struct {
+	root    string
+	opts    WatchOptions
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	polling bool
+}
+
+// NewWatcher はWatcherを生成する。
+func NewWatcher(root string, opts WatchOptions) *Watcher {
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultWatchDebounce
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	return &Watcher{root: root, opts: opts}
+}
+
+// Root は監視対象のルートパスを返す。
+func (w *Watcher) Root() string {
+	if w == nil {
+		return ""
+	}
+	return w.root
+}
+
+// Polling はポーリングで監視しているか判定する。
+func (w *Watcher) Polling() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.polling
+}
+
+// Start は監視を開始する。OSの変更通知が使えない場合はポーリングへ切り替える。
+func (w *Watcher) Start(ctx context.Context, handler WatchHandler) error {
+	if w == nil {
+		return errors.New("watcher is nil")
+	}
+	if w.root == "" {
+		return errors.New("watch root is empty")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	w.Stop()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	events := make(chan WatchEvent, watchEventBuffer)
+	// 監視中の失敗による切り替えが開始処理と重ならないよう、状態の設定まで排他する。
+	w.mu.Lock()
+	polling := w.opts.ForcePolling
+	if !polling {
+		fallback := func(err error) {
+			w.fallbackToPolling(watchCtx, events, err)
+		}
+		if err := startNativeWatch(watchCtx, w.root, events, fallback); err != nil {
+			polling = true
+		}
+	}
+	if polling {
+		startPollWatch(watchCtx, w.root, w.opts, events)
+	}
+	w.cancel = cancel
+	w.polling = polling
+	w.mu.Unlock()
+
+	go w.dispatch(watchCtx, events, handler)
+	return nil
+}
+
+// fallbackToPolling はOSの変更通知が失敗した監視をポーリングへ切り替え、切り替えを通知する。
+func (w *Watcher) fallbackToPolling(ctx context.Context, events chan<- WatchEvent, err error) {
+	w.mu.Lock()
+	if ctx.Err() != nil {
+		w.mu.Unlock()
+		return
+	}
+	startPollWatch(ctx, w.root, w.opts, events)
+	w.polling = true
+	w.mu.Unlock()
+	if w.opts.OnFallback != nil {
+		w.opts.OnFallback(w.root, err)
+	}
+}
+
+// Stop は監視を停止する。処理中のハンドラの完了は待たない。
+func (w *Watcher) Stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	cancel := w.cancel
+	w.cancel = nil
+	w.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// dispatch は変更通知を一定時間まとめてハンドラへ渡す。
+func (w *Watcher) dispatch(ctx context.Context, events <-chan WatchEvent, handler WatchHandler) {
+	var pending []WatchEvent
+	timer := time.NewTimer(w.opts.Debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			pending = append(pending, event)
+			timer.Reset(w.opts.Debounce)
+		case <-timer.C:
+			if len(pending) == 0 || handler == nil {
+				pending = nil
+				continue
+			}
+			batch := pending
+			pending = nil
+			handler(w.root, batch)
+		}
+	}
+}
+
+// sendWatchEvent は停止済みでなければイベントを送信する。
+func sendWatchEvent(ctx context.Context, out chan<- WatchEvent, event WatchEvent) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- event:
+		return true
+	}
+}
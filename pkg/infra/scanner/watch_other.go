@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+// 指示: miu200521358
+package scanner
+
+import "context"
+
+// startNativeWatch はOSの変更通知が無い環境ではポーリングへ切り替えさせる。
+func startNativeWatch(_ context.Context, _ string, _ chan<- WatchEvent, _ func(error)) error {
+	return errNativeWatchUnsupported
+}
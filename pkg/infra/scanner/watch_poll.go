@@ -0,0 +1,57 @@
+// 指示: miu200521358
+package scanner
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// startPollWatch は定期走査の差分で変更を検出する監視を開始する。
+func startPollWatch(ctx context.Context, root string, opts WatchOptions, out chan<- WatchEvent) {
+	pollScanner := New(Options{Match: opts.Match, Archives: opts.Archives})
+	go func() {
+		previous, err := pollSnapshot(ctx, pollScanner, root)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, scanErr := pollSnapshot(ctx, pollScanner, root)
+			if scanErr != nil && ctx.Err() != nil {
+				return
+			}
+			for key, path := range current {
+				if _, ok := previous[key]; !ok {
+					if !sendWatchEvent(ctx, out, WatchEvent{Op: WatchCreate, Path: path}) {
+						return
+					}
+				}
+			}
+			for key, path := range previous {
+				if _, ok := current[key]; !ok {
+					if !sendWatchEvent(ctx, out, WatchEvent{Op: WatchRemove, Path: path}) {
+						return
+					}
+				}
+			}
+			previous = current
+		}
+	}()
+}
+
+// pollSnapshot はルート配下の対象ファイル一覧を取得する。
+func pollSnapshot(ctx context.Context, pollScanner *Scanner, root string) (map[string]string, error) {
+	paths, err := pollScanner.Scan(ctx, root, nil)
+	snapshot := make(map[string]string, len(paths))
+	for _, path := range paths {
+		snapshot[strings.ToLower(path)] = path
+	}
+	return snapshot, err
+}
@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+// 指示: miu200521358
+package scanner
+
+import (
+	"context"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// nativeWatchBufferSize は変更通知を受け取るバッファサイズを表す。
+	nativeWatchBufferSize = 64 * 1024
+	// nativeWatchFilter は監視する変更の種類を表す。
+	nativeWatchFilter = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME
+)
+
+// startNativeWatch はReadDirectoryChangesWでルート配下の監視を開始する。
+// 開始後に読み取りへ失敗した場合は、ハンドルを閉じてからfailedを呼び出す。
+func startNativeWatch(ctx context.Context, root string, out chan<- WatchEvent, failed func(error)) error {
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateFile(
+		rootPtr,
+		windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		// 待機中のReadDirectoryChangesWを中断する。
+		_ = windows.CancelIoEx(handle, nil)
+	})
+	go func() {
+		readErr := readNativeChanges(ctx, root, handle, out)
+		stop()
+		_ = windows.CloseHandle(handle)
+		if readErr != nil && ctx.Err() == nil && failed != nil {
+			failed(readErr)
+		}
+	}()
+	return nil
+}
+
+// readNativeChanges は停止されるか読み取りに失敗するまで変更通知を読み取り、イベントとして送信する。
+// 読み取りに失敗した場合は再走査を要求してからエラーを返す。
+func readNativeChanges(ctx context.Context, root string, handle windows.Handle, out chan<- WatchEvent) error {
+	buf := make([]byte, nativeWatchBufferSize)
+	oldPath := ""
+	for ctx.Err() == nil {
+		var size uint32
+		readErr := windows.ReadDirectoryChanges(handle, &buf[0], uint32(len(buf)), true, nativeWatchFilter, &size, nil, 0)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if readErr != nil || size == 0 {
+			// バッファ溢れや読み取りの失敗時は再走査を要求する。
+			if !sendWatchEvent(ctx, out, WatchEvent{Op: WatchOverflow, Path: root}) {
+				return nil
+			}
+			if readErr != nil {
+				return readErr
+			}
+			continue
+		}
+		for _, event := range decodeNotifyBuffer(root, buf[:size], &oldPath) {
+			if !sendWatchEvent(ctx, out, event) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// decodeNotifyBuffer はFILE_NOTIFY_INFORMATIONの列を変更イベントへ変換する。
+func decodeNotifyBuffer(root string, buf []byte, oldPath *string) []WatchEvent {
+	var events []WatchEvent
+	offset := uint32(0)
+	for int(offset)+int(unsafe.Sizeof(windows.FileNotifyInformation{})) <= len(buf) {
+		info := (*windows.FileNotifyInformation)(unsafe.Pointer(&buf[offset]))
+		nameLen := int(info.FileNameLength / 2)
+		name := windows.UTF16ToString(unsafe.Slice(&info.FileName, nameLen))
+		path := filepath.Join(root, name)
+		switch info.Action {
+		case windows.FILE_ACTION_ADDED:
+			events = append(events, WatchEvent{Op: WatchCreate, Path: path})
+		case windows.FILE_ACTION_REMOVED:
+			events = append(events, WatchEvent{Op: WatchRemove, Path: path})
+		case windows.FILE_ACTION_RENAMED_OLD_NAME:
+			*oldPath = path
+		case windows.FILE_ACTION_RENAMED_NEW_NAME:
+			events = append(events, WatchEvent{Op: WatchRename, Path: path, OldPath: *oldPath})
+			*oldPath = ""
+		}
+		if info.NextEntryOffset == 0 {
+			break
+		}
+		offset += info.NextEntryOffset
+	}
+	return events
+}
@@ -0,0 +1,130 @@
+// 指示: miu200521358
+package tagstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
+)
+
+const (
+	// storeVersion はタグデータベースの保存形式のバージョンを表す。
+	storeVersion = 1
+	// defaultFileName は既定の保存ファイル名を表す。
+	defaultFileName = "tree_model_tags.json"
+)
+
+// ErrStoreCorrupted はタグデータベースが読み込めないことを表す。
+var ErrStoreCorrupted = errors.New("tag store is corrupted")
+
+// Store はタグとメモをJSONファイルへ保存する。
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// storeFile はタグデータベースの保存形式を表す。
+type storeFile struct {
+	Version int                     `json:"version"`
+	Models  map[string]*storeRecord `json:"models"`
+}
+
+// storeRecord はモデル単位の記録を表す。
+type storeRecord struct {
+	Tags    []string `json:"tags,omitempty"`
+	Note    string   `json:"note,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	ModTime int64    `json:"mtime,omitempty"`
+}
+
+// NewStore はStoreを生成する。pathが空の場合は実行ファイルと同じフォルダに保存する。
+func NewStore(path string) *Store {
+	if path == "" {
+		if exePath, err := os.Executable(); err == nil && exePath != "" {
+			path = filepath.Join(filepath.Dir(exePath), defaultFileName)
+		}
+	}
+	return &Store{path: path}
+}
+
+// Path は保存先のパスを返す。
+func (s *Store) Path() string {
+	if s == nil {
+		return ""
+	}
+	return s.path
+}
+
+// Load は保存済みの記録を返す。ファイルが無い場合は空の記録を返す。
+func (s *Store) Load() (map[string]moutput.TagRecord, error) {
+	records := map[string]moutput.TagRecord{}
+	if s == nil || s.path == "" {
+		return records, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return records, err
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return records, fmt.Errorf("%w: %v", ErrStoreCorrupted, err)
+	}
+	if file.Version != storeVersion {
+		return records, fmt.Errorf("%w: unsupported version %d", ErrStoreCorrupted, file.Version)
+	}
+	for hash, record := range file.Models {
+		if record == nil {
+			continue
+		}
+		records[hash] = moutput.TagRecord{
+			Tags:    record.Tags,
+			Note:    record.Note,
+			Path:    record.Path,
+			Size:    record.Size,
+			ModTime: record.ModTime,
+		}
+	}
+	return records, nil
+}
+
+// Save は記録全体を保存する。書き込み途中で中断しても既存ファイルを壊さないよう一時ファイル経由で保存する。
+func (s *Store) Save(records map[string]moutput.TagRecord) error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+	file := storeFile{Version: storeVersion, Models: make(map[string]*storeRecord, len(records))}
+	for hash, record := range records {
+		file.Models[hash] = &storeRecord{
+			Tags:    record.Tags,
+			Note:    record.Note,
+			Path:    record.Path,
+			Size:    record.Size,
+			ModTime: record.ModTime,
+		}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,171 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
+)
+
+const (
+	// duplicateWorkers は内容ハッシュを並列に求めるワーカー数を表す。
+	duplicateWorkers = 4
+)
+
+// DuplicateGroup は内容が同一のファイルの組を表す。
+type DuplicateGroup struct {
+	Hash  string
+	Size  int64
+	Paths []string
+}
+
+// Wasted は重複によって余分に使われているバイト数を返す。
+func (g DuplicateGroup) Wasted() int64 {
+	if len(g.Paths) < 2 {
+		return 0
+	}
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// DuplicateProgress は重複検出の進捗を表す。Totalはサイズが一致してハッシュを求める件数。
+type DuplicateProgress struct {
+	Hashed int
+	Total  int
+}
+
+// DuplicateUsecaseDeps は重複検出用ユースケースの依存を表す。
+type DuplicateUsecaseDeps struct {
+	Hasher moutput.IContentHasher
+}
+
+// DuplicateUsecase は内容が同一のファイルを検出するユースケースを表す。
+type DuplicateUsecase struct {
+	hasher moutput.IContentHasher
+}
+
+// NewDuplicateUsecase は重複検出用ユースケースを生成する。
+func NewDuplicateUsecase(deps DuplicateUsecaseDeps) *DuplicateUsecase {
+	return &DuplicateUsecase{hasher: deps.Hasher}
+}
+
+// Find は指定ファイルのうち内容が同一のものを組にして返す。
+// サイズが一致するファイルのみ内容ハッシュを求める。組は無駄な容量の大きい順、組内のパスは名前順に並べる。
+// 読み込めないファイルは対象外とする。ctxが取り消された場合は ctx.Err() を返す。
+func (uc *DuplicateUsecase) Find(ctx context.Context, paths []string, progress func(DuplicateProgress)) ([]DuplicateGroup, error) {
+	if uc == nil || uc.hasher == nil || len(paths) == 0 {
+		return nil, nil
+	}
+	bySize := map[int64][]string{}
+	seen := map[string]struct{}{}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(filepath.Clean(path))
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		size, _, err := uc.hasher.Stat(path)
+		if err != nil || size == 0 {
+			continue
+		}
+		bySize[size] = append(bySize[size], path)
+	}
+	type candidate struct {
+		path string
+		size int64
+	}
+	var candidates []candidate
+	for size, sized := range bySize {
+		if len(sized) < 2 {
+			continue
+		}
+		for _, path := range sized {
+			candidates = append(candidates, candidate{path: path, size: size})
+		}
+	}
+
+	type hashed struct {
+		candidate
+		hash string
+		err  error
+	}
+	jobs := make(chan candidate)
+	results := make(chan hashed)
+	var wg sync.WaitGroup
+	for i := 0; i < duplicateWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				hash, err := uc.hasher.Hash(ctx, job.path)
+				select {
+				case results <- hashed{candidate: job, hash: hash, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, job := range candidates {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	byHash := map[string]*DuplicateGroup{}
+	done := 0
+	for result := range results {
+		done++
+		if progress != nil {
+			progress(DuplicateProgress{Hashed: done, Total: len(candidates)})
+		}
+		if result.err != nil {
+			continue
+		}
+		group, ok := byHash[result.hash]
+		if !ok {
+			group = &DuplicateGroup{Hash: result.hash, Size: result.size}
+			byHash[result.hash] = group
+		}
+		group.Paths = append(group.Paths, result.path)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := make([]DuplicateGroup, 0, len(byHash))
+	for _, group := range byHash {
+		if len(group.Paths) < 2 {
+			continue
+		}
+		sort.Slice(group.Paths, func(i, j int) bool {
+			return strings.ToLower(group.Paths[i]) < strings.ToLower(group.Paths[j])
+		})
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return strings.ToLower(groups[i].Paths[0]) < strings.ToLower(groups[j].Paths[0])
+	})
+	return groups, nil
+}
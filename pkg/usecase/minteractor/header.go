@@ -0,0 +1,351 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+const (
+	// maxHeaderTextLength はヘッダの文字列として読み込むバイト数の上限を表す。
+	maxHeaderTextLength = 1 << 20
+)
+
+const (
+	// FormatPmx はPMX形式を表す。
+	FormatPmx = "PMX"
+	// FormatPmd はPMD形式を表す。
+	FormatPmd = "PMD"
+)
+
+const (
+	// EncodingUTF16LE はUTF-16LEの文字コードを表す。
+	EncodingUTF16LE = "UTF-16LE"
+	// EncodingUTF8 はUTF-8の文字コードを表す。
+	EncodingUTF8 = "UTF-8"
+	// EncodingShiftJIS はShift_JISの文字コードを表す。
+	EncodingShiftJIS = "Shift_JIS"
+)
+
+var (
+	// ErrHeaderUnsupported はヘッダを読み取れない形式を表す。
+	ErrHeaderUnsupported = errors.New("unsupported model header")
+	// ErrHeaderTruncated はファイルが途中で終わっていることを表す。
+	ErrHeaderTruncated = errors.New("model file is truncated")
+	// ErrHeaderCorrupted はヘッダや件数が不正な値であることを表す。
+	ErrHeaderCorrupted = errors.New("model file is corrupted")
+)
+
+// HeaderError はヘッダの読み込みに失敗したファイルと箇所を表す。
+// Errは ErrHeaderUnsupported・ErrHeaderTruncated・ErrHeaderCorrupted またはファイルの読み込みエラーを含む。
+type HeaderError struct {
+	Path    string
+	Section string
+	Err     error
+}
+
+// Error はエラー内容を返す。
+func (e *HeaderError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Path, e.Section, e.Err)
+}
+
+// Unwrap は原因のエラーを返す。
+func (e *HeaderError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// ModelNames はモデルの日本語名と英語名を表す。
+type ModelNames struct {
+	Name        string
+	EnglishName string
+}
+
+// ModelHeader はモデルのヘッダ情報と各要素の件数を表す。
+type ModelHeader struct {
+	Format         string
+	Version        float32
+	Encoding       string
+	Name           string
+	EnglishName    string
+	Comment        string
+	EnglishComment string
+	VertexCount    int
+	FaceCount      int
+	MaterialCount  int
+	BoneCount      int
+	MorphCount     int
+	RigidBodyCount int
+	JointCount     int
+	// MorphNames はモーフの日本語名を定義順に表す。
+	MorphNames []string
+}
+
+// Names はモデル名を返す。
+func (h ModelHeader) Names() ModelNames {
+	return ModelNames{Name: h.Name, EnglishName: h.EnglishName}
+}
+
+// ReadModelHeader はPMX・PMDのヘッダと各要素の件数、モーフ名のみを読み込む。頂点などの内容は読み飛ばす。
+// PMDの拡張部(英名・剛体・ジョイント)が無い場合は、該当する値を空・0とする。
+func (uc *TreeViewerUsecase) ReadModelHeader(path string) (ModelHeader, error) {
+	return uc.readModelHeader(path, false)
+}
+
+// ReadModelNames はPMX・PMDのモデル名のみを読み込む。PMDの英語名はファイル末尾にあるため空とする。
+func (uc *TreeViewerUsecase) ReadModelNames(path string) (ModelNames, error) {
+	header, err := uc.readModelHeader(path, true)
+	if err != nil {
+		return ModelNames{}, err
+	}
+	return header.Names(), nil
+}
+
+// readModelHeader はファイルを開き、拡張子に応じてヘッダを読み込む。namesOnlyの場合はモデル名までで止める。
+func (uc *TreeViewerUsecase) readModelHeader(path string, namesOnly bool) (ModelHeader, error) {
+	var parse func(*headerReader, bool) (ModelHeader, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pmx":
+		parse = parsePmxHeader
+	case ".pmd":
+		parse = parsePmdHeader
+	default:
+		return ModelHeader{}, &HeaderError{Path: path, Section: "format", Err: ErrHeaderUnsupported}
+	}
+	reader, size, err := uc.openFile(path)
+	if err != nil {
+		return ModelHeader{}, err
+	}
+	defer reader.Close()
+	hr := &headerReader{r: bufio.NewReader(reader), remaining: size, section: "signature"}
+	return hr.run(path, namesOnly, parse)
+}
+
+// openFile はファイルを開き、サイズを返す。アーカイブ内の仮想パスは依存に設定した読み込み先で開く。
+func (uc *TreeViewerUsecase) openFile(path string) (io.ReadCloser, int64, error) {
+	if uc.files != nil {
+		reader, size, _, err := uc.files.Open(path)
+		return reader, size, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// statFile はファイルサイズと更新日時を返す。アーカイブ内の仮想パスは依存に設定した読み込み先で求める。
+func (uc *TreeViewerUsecase) statFile(path string) (int64, time.Time, error) {
+	if uc.files != nil {
+		size, modTime, err := uc.files.Stat(path)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return size, time.Unix(0, modTime), nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+// headerReader は残りバイト数を確認しながらヘッダを読み進める。
+type headerReader struct {
+	r         *bufio.Reader
+	remaining int64
+	// section は読み込み中の箇所を表す。エラーの報告に使う。
+	section string
+}
+
+// run はparseを実行し、失敗した場合は読み込み中の箇所を含むHeaderErrorを返す。
+// 件数や長さは読み込む前に残りバイト数と照合するため、不正な入力でもpanicしない。
+func (hr *headerReader) run(path string, namesOnly bool, parse func(*headerReader, bool) (ModelHeader, error)) (ModelHeader, error) {
+	header, err := parse(hr, namesOnly)
+	if err != nil {
+		return ModelHeader{}, &HeaderError{Path: path, Section: hr.section, Err: classifyHeaderError(err)}
+	}
+	return header, nil
+}
+
+// classifyHeaderError はファイル終端のエラーを ErrHeaderTruncated に変換する。
+func classifyHeaderError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrHeaderTruncated
+	}
+	return err
+}
+
+// corrupted は不正な値を表すエラーを返す。
+func corrupted(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrHeaderCorrupted, fmt.Sprintf(format, args...))
+}
+
+// atEOF はファイルを読み終えたか判定する。
+func (hr *headerReader) atEOF() bool {
+	return hr.remaining <= 0
+}
+
+// reserve は残りバイト数を確認して消費する。足りない場合は ErrHeaderTruncated を返す。
+func (hr *headerReader) reserve(n int64) error {
+	if n < 0 {
+		return corrupted("negative size %d", n)
+	}
+	if n > hr.remaining {
+		return ErrHeaderTruncated
+	}
+	hr.remaining -= n
+	return nil
+}
+
+// read は指定バイト数を読み込む。
+func (hr *headerReader) read(n int) ([]byte, error) {
+	if err := hr.reserve(int64(n)); err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(hr.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// skip は指定バイト数を読み飛ばす。
+func (hr *headerReader) skip(n int64) error {
+	if err := hr.reserve(n); err != nil {
+		return err
+	}
+	for n > 0 {
+		step := n
+		if step > 1<<30 {
+			step = 1 << 30
+		}
+		if _, err := hr.r.Discard(int(step)); err != nil {
+			return err
+		}
+		n -= step
+	}
+	return nil
+}
+
+// skipElements は固定長の要素をcount件読み飛ばす。
+func (hr *headerReader) skipElements(count int, size int) error {
+	return hr.skip(int64(count) * int64(size))
+}
+
+// byteValue は1バイトを読み込む。
+func (hr *headerReader) byteValue() (byte, error) {
+	data, err := hr.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+// uint16Value は2バイトの符号なし整数を読み込む。
+func (hr *headerReader) uint16Value() (int, error) {
+	data, err := hr.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint16(data)), nil
+}
+
+// float32Value は4バイトの浮動小数点数を読み込む。
+func (hr *headerReader) float32Value() (float32, error) {
+	data, err := hr.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(data)), nil
+}
+
+// count は4バイトの件数を読み込む。負の値は不正とする。
+func (hr *headerReader) count() (int, error) {
+	data, err := hr.read(4)
+	if err != nil {
+		return 0, err
+	}
+	value := int32(binary.LittleEndian.Uint32(data))
+	if value < 0 {
+		return 0, corrupted("negative count %d", value)
+	}
+	return int(value), nil
+}
+
+// pmxText はPMXの文字列を読み込む。encodingが1の場合はUTF-8、それ以外はUTF-16LEとする。
+func (hr *headerReader) pmxText(encoding byte) (string, error) {
+	length, err := hr.count()
+	if err != nil {
+		return "", err
+	}
+	if length > maxHeaderTextLength {
+		return "", corrupted("text too long %d", length)
+	}
+	data, err := hr.read(length)
+	if err != nil {
+		return "", err
+	}
+	if encoding == 1 {
+		return string(data), nil
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// skipPmxText はPMXの文字列を読み飛ばす。
+func (hr *headerReader) skipPmxText() error {
+	length, err := hr.count()
+	if err != nil {
+		return err
+	}
+	return hr.skip(int64(length))
+}
+
+// sjisText はShift_JISの固定長文字列を読み込む。NUL以降は無視する。
+func (hr *headerReader) sjisText(size int) (string, error) {
+	data, err := hr.read(size)
+	if err != nil {
+		return "", err
+	}
+	return decodeShiftJIS(data), nil
+}
+
+// decodeShiftJIS はNUL終端のShift_JIS文字列を変換する。変換できない場合はそのまま返す。
+func decodeShiftJIS(data []byte) string {
+	for i, b := range data {
+		if b == 0 {
+			data = data[:i]
+			break
+		}
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
@@ -0,0 +1,204 @@
+// 指示: miu200521358
+package minteractor
+
+const (
+	// pmdModelNameSize はPMDのモデル名のバイト数を表す。
+	pmdModelNameSize = 20
+	// pmdCommentSize はPMDのコメントのバイト数を表す。
+	pmdCommentSize = 256
+	// pmdVertexSize はPMDの頂点1件のサイズを表す。
+	pmdVertexSize = 38
+	// pmdMaterialSize はPMDの材質1件のサイズを表す。
+	pmdMaterialSize = 70
+	// pmdBoneSize はPMDのボーン1件のサイズを表す。
+	pmdBoneSize = 39
+	// pmdFrameNameSize はPMDの表示枠名のバイト数を表す。
+	pmdFrameNameSize = 50
+	// pmdToonTexturesSize はPMDのトゥーンテクスチャ名10件のサイズを表す。
+	pmdToonTexturesSize = 100 * 10
+	// pmdRigidBodySize はPMDの剛体1件のサイズを表す。
+	pmdRigidBodySize = 83
+	// pmdJointSize はPMDのジョイント1件のサイズを表す。
+	pmdJointSize = 124
+)
+
+// parsePmdHeader はPMDのヘッダと各要素の件数を読み込む。
+// 英名・トゥーン・物理の拡張部はファイル末尾で終わっていても正常とする。
+func parsePmdHeader(hr *headerReader, namesOnly bool) (ModelHeader, error) {
+	header := ModelHeader{Format: FormatPmd, Encoding: EncodingShiftJIS}
+	signature, err := hr.read(3)
+	if err != nil {
+		return header, err
+	}
+	if string(signature) != "Pmd" {
+		return header, ErrHeaderUnsupported
+	}
+	hr.section = "version"
+	if header.Version, err = hr.float32Value(); err != nil {
+		return header, err
+	}
+
+	hr.section = "name"
+	if header.Name, err = hr.sjisText(pmdModelNameSize); err != nil {
+		return header, err
+	}
+	if namesOnly {
+		return header, nil
+	}
+	hr.section = "comment"
+	if header.Comment, err = hr.sjisText(pmdCommentSize); err != nil {
+		return header, err
+	}
+
+	hr.section = "vertices"
+	if header.VertexCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(header.VertexCount, pmdVertexSize); err != nil {
+		return header, err
+	}
+
+	hr.section = "faces"
+	indexCount, err := hr.count()
+	if err != nil {
+		return header, err
+	}
+	if indexCount%3 != 0 {
+		return header, corrupted("face index count %d", indexCount)
+	}
+	header.FaceCount = indexCount / 3
+	if err := hr.skipElements(indexCount, 2); err != nil {
+		return header, err
+	}
+
+	hr.section = "materials"
+	if header.MaterialCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(header.MaterialCount, pmdMaterialSize); err != nil {
+		return header, err
+	}
+
+	hr.section = "bones"
+	if header.BoneCount, err = hr.uint16Value(); err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(header.BoneCount, pmdBoneSize); err != nil {
+		return header, err
+	}
+
+	hr.section = "ik"
+	ikCount, err := hr.uint16Value()
+	if err != nil {
+		return header, err
+	}
+	for i := 0; i < ikCount; i++ {
+		// ターゲット・エフェクタ
+		if err := hr.skip(2 + 2); err != nil {
+			return header, err
+		}
+		chainLength, err := hr.byteValue()
+		if err != nil {
+			return header, err
+		}
+		// ループ回数・角度制限・リンク
+		if err := hr.skip(int64(2 + 4 + int(chainLength)*2)); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "morphs"
+	if header.MorphCount, err = hr.uint16Value(); err != nil {
+		return header, err
+	}
+	header.MorphNames = make([]string, 0, header.MorphCount)
+	for i := 0; i < header.MorphCount; i++ {
+		name, err := hr.sjisText(pmdModelNameSize)
+		if err != nil {
+			return header, err
+		}
+		header.MorphNames = append(header.MorphNames, name)
+		vertexCount, err := hr.count()
+		if err != nil {
+			return header, err
+		}
+		// 種類・頂点
+		if err := hr.skip(1 + int64(vertexCount)*16); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "display frames"
+	morphFrameCount, err := hr.byteValue()
+	if err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(int(morphFrameCount), 2); err != nil {
+		return header, err
+	}
+	boneFrameCount, err := hr.byteValue()
+	if err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(int(boneFrameCount), pmdFrameNameSize); err != nil {
+		return header, err
+	}
+	boneFrameItemCount, err := hr.count()
+	if err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(boneFrameItemCount, 2+1); err != nil {
+		return header, err
+	}
+
+	if hr.atEOF() {
+		return header, nil
+	}
+	hr.section = "english"
+	hasEnglish, err := hr.byteValue()
+	if err != nil {
+		return header, err
+	}
+	if hasEnglish != 0 {
+		if header.EnglishName, err = hr.sjisText(pmdModelNameSize); err != nil {
+			return header, err
+		}
+		if header.EnglishComment, err = hr.sjisText(pmdCommentSize); err != nil {
+			return header, err
+		}
+		// ボーン名・モーフ名(baseを除く)・表示枠名
+		englishMorphCount := max(header.MorphCount-1, 0)
+		size := int64(header.BoneCount)*pmdModelNameSize + int64(englishMorphCount)*pmdModelNameSize + int64(boneFrameCount)*pmdFrameNameSize
+		if err := hr.skip(size); err != nil {
+			return header, err
+		}
+	}
+
+	if hr.atEOF() {
+		return header, nil
+	}
+	hr.section = "toon textures"
+	if err := hr.skip(pmdToonTexturesSize); err != nil {
+		return header, err
+	}
+
+	if hr.atEOF() {
+		return header, nil
+	}
+	hr.section = "rigid bodies"
+	if header.RigidBodyCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(header.RigidBodyCount, pmdRigidBodySize); err != nil {
+		return header, err
+	}
+
+	hr.section = "joints"
+	if header.JointCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	if err := hr.skipElements(header.JointCount, pmdJointSize); err != nil {
+		return header, err
+	}
+	return header, nil
+}
@@ -0,0 +1,480 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// pmxMinGlobalsCount はPMXのグローバル設定の最小件数を表す。
+	pmxMinGlobalsCount = 8
+	// pmxMaxAddUVCount はPMXの追加UV数の上限を表す。
+	pmxMaxAddUVCount = 4
+	// pmxMaterialFixedSize はPMXの材質のうち、名前・テクスチャ参照・メモ・頂点数を除く固定長部分のサイズを表す。
+	pmxMaterialFixedSize = 16 + 12 + 4 + 12 + 1 + 16 + 4
+	// pmxMaterialMorphSize はPMXの材質モーフの変化量のサイズを表す。
+	pmxMaterialMorphSize = 1 + 16 + 12 + 4 + 12 + 16 + 4 + 16 + 16 + 16
+	// pmxRigidBodyFixedSize はPMXの剛体のうち、名前とボーン参照を除く固定長部分のサイズを表す。
+	pmxRigidBodyFixedSize = 1 + 2 + 1 + 12 + 12 + 12 + 4*5 + 1
+	// pmxJointFixedSize はPMXのジョイントのうち、名前と剛体参照を除く固定長部分のサイズを表す。
+	pmxJointFixedSize = 1 + 12*8
+)
+
+// ボーンフラグ
+const (
+	pmxBoneTailIsBone     = 0x0001
+	pmxBoneIK             = 0x0020
+	pmxBoneInheritRotate  = 0x0100
+	pmxBoneInheritMove    = 0x0200
+	pmxBoneFixedAxis      = 0x0400
+	pmxBoneLocalAxis      = 0x0800
+	pmxBoneExternalParent = 0x2000
+)
+
+// pmxIndexSizes はPMXのグローバル設定に含まれる参照のバイト数を表す。
+type pmxIndexSizes struct {
+	addUV     int
+	vertex    int
+	texture   int
+	material  int
+	bone      int
+	morph     int
+	rigidBody int
+}
+
+// pmxPrefix はPMXのテクスチャ一覧までの読み込み結果を表す。
+type pmxPrefix struct {
+	header   ModelHeader
+	sizes    pmxIndexSizes
+	encoding byte
+	// textures はテクスチャの相対パスを表す。withTexturesを指定した場合のみ設定する。
+	textures []string
+}
+
+// ReadPmxTextures はPMXが参照するテクスチャの相対パスを読み込む。頂点と面は読み飛ばし、材質以降は読まない。
+// sizeはファイルサイズで、失敗した場合はヘッダの読み込みと同じHeaderErrorを返す。
+func ReadPmxTextures(path string, r io.Reader, size int64) ([]string, error) {
+	hr := &headerReader{r: bufio.NewReader(r), remaining: size, section: "signature"}
+	var textures []string
+	_, err := hr.run(path, false, func(hr *headerReader, _ bool) (ModelHeader, error) {
+		prefix, err := readPmxPrefix(hr, false, true)
+		textures = prefix.textures
+		return prefix.header, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return textures, nil
+}
+
+// parsePmxHeader はPMX 2.0/2.1のヘッダと各要素の件数を読み込む。表示枠とソフトボディは件数に含めない。
+func parsePmxHeader(hr *headerReader, namesOnly bool) (ModelHeader, error) {
+	prefix, err := readPmxPrefix(hr, namesOnly, false)
+	header, sizes, encoding := prefix.header, prefix.sizes, prefix.encoding
+	if err != nil || namesOnly {
+		return header, err
+	}
+
+	hr.section = "materials"
+	if header.MaterialCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	for i := 0; i < header.MaterialCount; i++ {
+		if err := skipPmxMaterial(hr, sizes); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "bones"
+	if header.BoneCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	for i := 0; i < header.BoneCount; i++ {
+		if err := skipPmxBone(hr, sizes); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "morphs"
+	if header.MorphCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	header.MorphNames = make([]string, 0, min(header.MorphCount, 1024))
+	for i := 0; i < header.MorphCount; i++ {
+		name, err := readPmxMorph(hr, sizes, encoding)
+		if err != nil {
+			return header, err
+		}
+		header.MorphNames = append(header.MorphNames, name)
+	}
+
+	hr.section = "display frames"
+	frameCount, err := hr.count()
+	if err != nil {
+		return header, err
+	}
+	for i := 0; i < frameCount; i++ {
+		if err := skipPmxDisplayFrame(hr, sizes); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "rigid bodies"
+	if header.RigidBodyCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	for i := 0; i < header.RigidBodyCount; i++ {
+		if err := skipPmxNames(hr); err != nil {
+			return header, err
+		}
+		if err := hr.skip(int64(sizes.bone + pmxRigidBodyFixedSize)); err != nil {
+			return header, err
+		}
+	}
+
+	hr.section = "joints"
+	if header.JointCount, err = hr.count(); err != nil {
+		return header, err
+	}
+	for i := 0; i < header.JointCount; i++ {
+		if err := skipPmxNames(hr); err != nil {
+			return header, err
+		}
+		if err := hr.skip(int64(sizes.rigidBody*2 + pmxJointFixedSize)); err != nil {
+			return header, err
+		}
+	}
+	return header, nil
+}
+
+// readPmxPrefix はPMXのシグネチャからテクスチャ一覧までを読み込む。namesOnlyの場合はモデル名までで止め、
+// withTexturesの場合はテクスチャの相対パスを読み込む。
+func readPmxPrefix(hr *headerReader, namesOnly bool, withTextures bool) (pmxPrefix, error) {
+	prefix := pmxPrefix{header: ModelHeader{Format: FormatPmx}}
+	header := &prefix.header
+	signature, err := hr.read(4)
+	if err != nil {
+		return prefix, err
+	}
+	if string(signature) != "PMX " {
+		return prefix, ErrHeaderUnsupported
+	}
+	hr.section = "version"
+	if header.Version, err = hr.float32Value(); err != nil {
+		return prefix, err
+	}
+	if header.Version != 2.0 && header.Version != 2.1 {
+		return prefix, corrupted("unknown pmx version %v", header.Version)
+	}
+
+	hr.section = "globals"
+	globalsCount, err := hr.byteValue()
+	if err != nil {
+		return prefix, err
+	}
+	if globalsCount < pmxMinGlobalsCount {
+		return prefix, corrupted("too few globals %d", globalsCount)
+	}
+	globals, err := hr.read(int(globalsCount))
+	if err != nil {
+		return prefix, err
+	}
+	encoding := globals[0]
+	prefix.encoding = encoding
+	switch encoding {
+	case 0:
+		header.Encoding = EncodingUTF16LE
+	case 1:
+		header.Encoding = EncodingUTF8
+	default:
+		return prefix, corrupted("unknown encoding %d", encoding)
+	}
+	prefix.sizes = pmxIndexSizes{
+		addUV:     int(globals[1]),
+		vertex:    int(globals[2]),
+		texture:   int(globals[3]),
+		material:  int(globals[4]),
+		bone:      int(globals[5]),
+		morph:     int(globals[6]),
+		rigidBody: int(globals[7]),
+	}
+	sizes := prefix.sizes
+	if err := sizes.validate(); err != nil {
+		return prefix, err
+	}
+
+	hr.section = "name"
+	if header.Name, err = hr.pmxText(encoding); err != nil {
+		return prefix, err
+	}
+	if header.EnglishName, err = hr.pmxText(encoding); err != nil {
+		return prefix, err
+	}
+	if namesOnly {
+		return prefix, nil
+	}
+	hr.section = "comment"
+	if header.Comment, err = hr.pmxText(encoding); err != nil {
+		return prefix, err
+	}
+	if header.EnglishComment, err = hr.pmxText(encoding); err != nil {
+		return prefix, err
+	}
+
+	hr.section = "vertices"
+	if header.VertexCount, err = hr.count(); err != nil {
+		return prefix, err
+	}
+	for i := 0; i < header.VertexCount; i++ {
+		if err := skipPmxVertex(hr, sizes); err != nil {
+			return prefix, err
+		}
+	}
+
+	hr.section = "faces"
+	indexCount, err := hr.count()
+	if err != nil {
+		return prefix, err
+	}
+	if indexCount%3 != 0 {
+		return prefix, corrupted("face index count %d", indexCount)
+	}
+	header.FaceCount = indexCount / 3
+	if err := hr.skipElements(indexCount, sizes.vertex); err != nil {
+		return prefix, err
+	}
+
+	hr.section = "textures"
+	textureCount, err := hr.count()
+	if err != nil {
+		return prefix, err
+	}
+	if withTextures {
+		prefix.textures = make([]string, 0, min(textureCount, 1024))
+	}
+	for i := 0; i < textureCount; i++ {
+		if !withTextures {
+			if err := hr.skipPmxText(); err != nil {
+				return prefix, err
+			}
+			continue
+		}
+		texture, err := hr.pmxText(encoding)
+		if err != nil {
+			return prefix, err
+		}
+		prefix.textures = append(prefix.textures, texture)
+	}
+	return prefix, nil
+}
+
+// validate は参照のバイト数が1・2・4のいずれかか判定する。
+func (s pmxIndexSizes) validate() error {
+	if s.addUV > pmxMaxAddUVCount {
+		return corrupted("too many additional uvs %d", s.addUV)
+	}
+	for _, size := range []int{s.vertex, s.texture, s.material, s.bone, s.morph, s.rigidBody} {
+		if size != 1 && size != 2 && size != 4 {
+			return corrupted("invalid index size %d", size)
+		}
+	}
+	return nil
+}
+
+// skipPmxNames は要素の日本語名と英語名を読み飛ばす。
+func skipPmxNames(hr *headerReader) error {
+	if err := hr.skipPmxText(); err != nil {
+		return err
+	}
+	return hr.skipPmxText()
+}
+
+// skipPmxVertex はPMXの頂点1件を読み飛ばす。
+func skipPmxVertex(hr *headerReader, sizes pmxIndexSizes) error {
+	// 位置・法線・UV・追加UV
+	if err := hr.skip(int64(12 + 12 + 8 + sizes.addUV*16)); err != nil {
+		return err
+	}
+	deformType, err := hr.byteValue()
+	if err != nil {
+		return err
+	}
+	var deformSize int
+	switch deformType {
+	case 0: // BDEF1
+		deformSize = sizes.bone
+	case 1: // BDEF2
+		deformSize = sizes.bone*2 + 4
+	case 2, 4: // BDEF4, QDEF
+		deformSize = sizes.bone*4 + 16
+	case 3: // SDEF
+		deformSize = sizes.bone*2 + 4 + 36
+	default:
+		return corrupted("invalid deform type %d", deformType)
+	}
+	// エッジ倍率
+	return hr.skip(int64(deformSize + 4))
+}
+
+// skipPmxMaterial はPMXの材質1件を読み飛ばす。
+func skipPmxMaterial(hr *headerReader, sizes pmxIndexSizes) error {
+	if err := skipPmxNames(hr); err != nil {
+		return err
+	}
+	// 色・描画フラグ・エッジ、テクスチャ・スフィア参照、スフィアモード
+	if err := hr.skip(int64(pmxMaterialFixedSize + sizes.texture*2 + 1)); err != nil {
+		return err
+	}
+	sharedToon, err := hr.byteValue()
+	if err != nil {
+		return err
+	}
+	toonSize := sizes.texture
+	if sharedToon != 0 {
+		toonSize = 1
+	}
+	if err := hr.skip(int64(toonSize)); err != nil {
+		return err
+	}
+	// メモ
+	if err := hr.skipPmxText(); err != nil {
+		return err
+	}
+	// 面頂点数
+	return hr.skip(4)
+}
+
+// skipPmxBone はPMXのボーン1件を読み飛ばす。
+func skipPmxBone(hr *headerReader, sizes pmxIndexSizes) error {
+	if err := skipPmxNames(hr); err != nil {
+		return err
+	}
+	// 位置・親ボーン・変形階層
+	if err := hr.skip(int64(12 + sizes.bone + 4)); err != nil {
+		return err
+	}
+	flags, err := hr.uint16Value()
+	if err != nil {
+		return err
+	}
+	size := 12
+	if flags&pmxBoneTailIsBone != 0 {
+		size = sizes.bone
+	}
+	if flags&(pmxBoneInheritRotate|pmxBoneInheritMove) != 0 {
+		size += sizes.bone + 4
+	}
+	if flags&pmxBoneFixedAxis != 0 {
+		size += 12
+	}
+	if flags&pmxBoneLocalAxis != 0 {
+		size += 24
+	}
+	if flags&pmxBoneExternalParent != 0 {
+		size += 4
+	}
+	if err := hr.skip(int64(size)); err != nil {
+		return err
+	}
+	if flags&pmxBoneIK == 0 {
+		return nil
+	}
+	// ターゲット・ループ回数・角度制限
+	if err := hr.skip(int64(sizes.bone + 4 + 4)); err != nil {
+		return err
+	}
+	linkCount, err := hr.count()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < linkCount; i++ {
+		if err := hr.skip(int64(sizes.bone)); err != nil {
+			return err
+		}
+		limited, err := hr.byteValue()
+		if err != nil {
+			return err
+		}
+		if limited != 0 {
+			if err := hr.skip(24); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPmxMorph はPMXのモーフ1件の日本語名を読み込み、残りを読み飛ばす。
+func readPmxMorph(hr *headerReader, sizes pmxIndexSizes, encoding byte) (string, error) {
+	name, err := hr.pmxText(encoding)
+	if err != nil {
+		return "", err
+	}
+	// 英語名・操作パネル
+	if err := hr.skipPmxText(); err != nil {
+		return "", err
+	}
+	if err := hr.skip(1); err != nil {
+		return "", err
+	}
+	morphType, err := hr.byteValue()
+	if err != nil {
+		return "", err
+	}
+	var offsetSize int
+	switch morphType {
+	case 0, 9: // グループ, フリップ
+		offsetSize = sizes.morph + 4
+	case 1: // 頂点
+		offsetSize = sizes.vertex + 12
+	case 2: // ボーン
+		offsetSize = sizes.bone + 12 + 16
+	case 3, 4, 5, 6, 7: // UV, 追加UV1-4
+		offsetSize = sizes.vertex + 16
+	case 8: // 材質
+		offsetSize = sizes.material + pmxMaterialMorphSize
+	case 10: // インパルス
+		offsetSize = sizes.rigidBody + 1 + 12 + 12
+	default:
+		return "", corrupted("invalid morph type %d", morphType)
+	}
+	offsetCount, err := hr.count()
+	if err != nil {
+		return "", err
+	}
+	return name, hr.skipElements(offsetCount, offsetSize)
+}
+
+// skipPmxDisplayFrame はPMXの表示枠1件を読み飛ばす。
+func skipPmxDisplayFrame(hr *headerReader, sizes pmxIndexSizes) error {
+	if err := skipPmxNames(hr); err != nil {
+		return err
+	}
+	// 特殊枠フラグ
+	if err := hr.skip(1); err != nil {
+		return err
+	}
+	itemCount, err := hr.count()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < itemCount; i++ {
+		itemType, err := hr.byteValue()
+		if err != nil {
+			return err
+		}
+		switch itemType {
+		case 0:
+			err = hr.skip(int64(sizes.bone))
+		case 1:
+			err = hr.skip(int64(sizes.morph))
+		default:
+			err = corrupted("invalid display item type %d", itemType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
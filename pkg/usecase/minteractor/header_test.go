@@ -0,0 +1,509 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// fixtureWriter はテスト用のモデルファイルを組み立て、各箇所の開始位置を記録する。
+type fixtureWriter struct {
+	buf      bytes.Buffer
+	sections []fixtureSection
+	// counts は件数を書き込んだ位置を箇所ごとに表す。
+	counts map[string]int
+	utf8   bool
+}
+
+// fixtureSection はモデルファイル内の箇所と開始位置を表す。
+type fixtureSection struct {
+	name   string
+	offset int
+}
+
+// mark は箇所の開始位置を記録する。
+func (w *fixtureWriter) mark(section string) {
+	w.sections = append(w.sections, fixtureSection{name: section, offset: w.buf.Len()})
+}
+
+// bytes はバイト列を書き込む。
+func (w *fixtureWriter) bytes(data ...byte) {
+	w.buf.Write(data)
+}
+
+// zeros は0をnバイト書き込む。
+func (w *fixtureWriter) zeros(n int) {
+	w.buf.Write(make([]byte, n))
+}
+
+// uint16 は2バイトの整数を書き込む。
+func (w *fixtureWriter) uint16(value int) {
+	_ = binary.Write(&w.buf, binary.LittleEndian, uint16(value))
+}
+
+// int32 は4バイトの整数を書き込む。
+func (w *fixtureWriter) int32(value int) {
+	_ = binary.Write(&w.buf, binary.LittleEndian, int32(value))
+}
+
+// float32 は4バイトの浮動小数点数を書き込む。
+func (w *fixtureWriter) float32(value float32) {
+	_ = binary.Write(&w.buf, binary.LittleEndian, math.Float32bits(value))
+}
+
+// count は件数を書き込み、後から書き換えられるよう位置を記録する。
+func (w *fixtureWriter) count(section string, value int) {
+	if w.counts == nil {
+		w.counts = map[string]int{}
+	}
+	if _, ok := w.counts[section]; !ok {
+		w.counts[section] = w.buf.Len()
+	}
+	w.int32(value)
+}
+
+// text はPMXの文字列を書き込む。
+func (w *fixtureWriter) text(value string) {
+	if w.utf8 {
+		w.int32(len(value))
+		w.buf.WriteString(value)
+		return
+	}
+	units := utf16.Encode([]rune(value))
+	w.int32(len(units) * 2)
+	for _, unit := range units {
+		w.uint16(int(unit))
+	}
+}
+
+// sjis はShift_JISの固定長文字列を書き込む。
+func (w *fixtureWriter) sjis(value string, size int) {
+	encoded, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(value))
+	if err != nil {
+		panic(err)
+	}
+	data := make([]byte, size)
+	copy(data, encoded)
+	w.buf.Write(data)
+}
+
+// buildPmx はPMXのテスト用ファイルを組み立てる。参照サイズは頂点2バイト、ボーン2バイト、その他1バイトとする。
+func buildPmx(version float32, utf8 bool) *fixtureWriter {
+	w := &fixtureWriter{utf8: utf8}
+	w.mark("signature")
+	w.bytes('P', 'M', 'X', ' ')
+	w.mark("version")
+	w.float32(version)
+	w.mark("globals")
+	encoding := byte(0)
+	if utf8 {
+		encoding = 1
+	}
+	w.bytes(8, encoding, 1, 2, 1, 1, 2, 1, 1)
+
+	w.mark("name")
+	w.text("初音ミク")
+	w.text("Hatsune Miku")
+	w.mark("comment")
+	w.text("コメント")
+	w.text("comment")
+
+	w.mark("vertices")
+	w.count("vertices", 2)
+	// BDEF1 (追加UV1件)
+	w.zeros(12 + 12 + 8 + 16)
+	w.bytes(0)
+	w.zeros(2 + 4)
+	// SDEF
+	w.zeros(12 + 12 + 8 + 16)
+	w.bytes(3)
+	w.zeros(2*2 + 4 + 36 + 4)
+
+	w.mark("faces")
+	w.count("faces", 3)
+	w.zeros(3 * 2)
+
+	w.mark("textures")
+	w.count("textures", 2)
+	w.text("tex/body.png")
+	w.text("toon.bmp")
+
+	w.mark("materials")
+	w.count("materials", 1)
+	w.text("材質")
+	w.text("material")
+	w.zeros(pmxMaterialFixedSize + 1*2 + 1)
+	// 個別トゥーン
+	w.bytes(0)
+	w.zeros(1)
+	w.text("メモ")
+	w.int32(3)
+
+	w.mark("bones")
+	w.count("bones", 2)
+	w.text("センター")
+	w.text("center")
+	w.zeros(12 + 2 + 4)
+	w.uint16(pmxBoneTailIsBone | pmxBoneInheritRotate | pmxBoneFixedAxis | pmxBoneLocalAxis | pmxBoneExternalParent)
+	w.zeros(2 + 2 + 4 + 12 + 24 + 4)
+	w.text("左足ＩＫ")
+	w.text("leg IK")
+	w.zeros(12 + 2 + 4)
+	w.uint16(pmxBoneIK)
+	w.zeros(12 + 2 + 4 + 4)
+	w.int32(2)
+	w.zeros(2)
+	w.bytes(1)
+	w.zeros(24)
+	w.zeros(2)
+	w.bytes(0)
+
+	w.mark("morphs")
+	morphCount := 3
+	if version >= 2.1 {
+		morphCount = 4
+	}
+	w.count("morphs", morphCount)
+	w.text("まばたき")
+	w.text("blink")
+	w.bytes(1, 1)
+	w.int32(2)
+	w.zeros(2 * (2 + 12))
+	w.text("ウィンク２")
+	w.text("wink")
+	w.bytes(1, 0)
+	w.int32(1)
+	w.zeros(1 + 4)
+	w.text("材質変化")
+	w.text("material")
+	w.bytes(0, 8)
+	w.int32(1)
+	w.zeros(1 + pmxMaterialMorphSize)
+	if version >= 2.1 {
+		w.text("インパルス")
+		w.text("impulse")
+		w.bytes(0, 10)
+		w.int32(1)
+		w.zeros(1 + 1 + 12 + 12)
+	}
+
+	w.mark("display frames")
+	w.count("display frames", 1)
+	w.text("Root")
+	w.text("Root")
+	w.bytes(1)
+	w.int32(2)
+	w.bytes(0)
+	w.zeros(2)
+	w.bytes(1)
+	w.zeros(1)
+
+	w.mark("rigid bodies")
+	w.count("rigid bodies", 1)
+	w.text("頭")
+	w.text("head")
+	w.zeros(2 + pmxRigidBodyFixedSize)
+
+	w.mark("joints")
+	w.count("joints", 1)
+	w.text("首")
+	w.text("neck")
+	w.zeros(1*2 + pmxJointFixedSize)
+	if version >= 2.1 {
+		// ソフトボディは読み込まない。
+		w.int32(0)
+	}
+	return w
+}
+
+// buildPmd はPMDのテスト用ファイルを組み立てる。withExtensionがfalseの場合は英名以降を含めない。
+func buildPmd(withExtension bool) *fixtureWriter {
+	w := &fixtureWriter{}
+	w.mark("signature")
+	w.bytes('P', 'm', 'd')
+	w.mark("version")
+	w.float32(1)
+	w.mark("name")
+	w.sjis("初音ミク", pmdModelNameSize)
+	w.mark("comment")
+	w.sjis("コメント", pmdCommentSize)
+
+	w.mark("vertices")
+	w.count("vertices", 3)
+	w.zeros(3 * pmdVertexSize)
+	w.mark("faces")
+	w.count("faces", 3)
+	w.zeros(3 * 2)
+	w.mark("materials")
+	w.count("materials", 1)
+	w.zeros(pmdMaterialSize)
+	w.mark("bones")
+	w.uint16(2)
+	w.zeros(2 * pmdBoneSize)
+	w.mark("ik")
+	w.uint16(1)
+	w.zeros(2 + 2)
+	w.bytes(2)
+	w.zeros(2 + 4 + 2*2)
+
+	w.mark("morphs")
+	w.uint16(2)
+	w.sjis("base", pmdModelNameSize)
+	w.int32(1)
+	w.bytes(0)
+	w.zeros(16)
+	w.sjis("まばたき", pmdModelNameSize)
+	w.int32(1)
+	w.bytes(1)
+	w.zeros(16)
+
+	w.mark("display frames")
+	w.bytes(1)
+	w.zeros(2)
+	w.bytes(1)
+	w.zeros(pmdFrameNameSize)
+	w.int32(1)
+	w.zeros(2 + 1)
+	if !withExtension {
+		return w
+	}
+
+	w.mark("english")
+	w.bytes(1)
+	w.sjis("Hatsune Miku", pmdModelNameSize)
+	w.sjis("comment", pmdCommentSize)
+	w.zeros(2*pmdModelNameSize + 1*pmdModelNameSize + 1*pmdFrameNameSize)
+	w.mark("toon textures")
+	w.zeros(pmdToonTexturesSize)
+	w.mark("rigid bodies")
+	w.count("rigid bodies", 2)
+	w.zeros(2 * pmdRigidBodySize)
+	w.mark("joints")
+	w.count("joints", 1)
+	w.zeros(pmdJointSize)
+	return w
+}
+
+// readFixtureHeader はファイルの内容からヘッダを読み込む。
+func readFixtureHeader(data []byte, parse func(*headerReader, bool) (ModelHeader, error), namesOnly bool) (ModelHeader, error) {
+	hr := &headerReader{r: bufio.NewReader(bytes.NewReader(data)), remaining: int64(len(data)), section: "signature"}
+	return hr.run("model", namesOnly, parse)
+}
+
+func TestReadModelHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		parse func(*headerReader, bool) (ModelHeader, error)
+		want  ModelHeader
+	}{
+		{
+			name:  "PMX 2.0 UTF-16",
+			data:  buildPmx(2.0, false).buf.Bytes(),
+			parse: parsePmxHeader,
+			want: ModelHeader{
+				Format: FormatPmx, Version: 2.0, Encoding: EncodingUTF16LE,
+				Name: "初音ミク", EnglishName: "Hatsune Miku", Comment: "コメント", EnglishComment: "comment",
+				VertexCount: 2, FaceCount: 1, MaterialCount: 1, BoneCount: 2, MorphCount: 3, RigidBodyCount: 1, JointCount: 1,
+				MorphNames: []string{"まばたき", "ウィンク２", "材質変化"},
+			},
+		},
+		{
+			name:  "PMX 2.1 UTF-8",
+			data:  buildPmx(2.1, true).buf.Bytes(),
+			parse: parsePmxHeader,
+			want: ModelHeader{
+				Format: FormatPmx, Version: 2.1, Encoding: EncodingUTF8,
+				Name: "初音ミク", EnglishName: "Hatsune Miku", Comment: "コメント", EnglishComment: "comment",
+				VertexCount: 2, FaceCount: 1, MaterialCount: 1, BoneCount: 2, MorphCount: 4, RigidBodyCount: 1, JointCount: 1,
+				MorphNames: []string{"まばたき", "ウィンク２", "材質変化", "インパルス"},
+			},
+		},
+		{
+			name:  "PMD",
+			data:  buildPmd(true).buf.Bytes(),
+			parse: parsePmdHeader,
+			want: ModelHeader{
+				Format: FormatPmd, Version: 1, Encoding: EncodingShiftJIS,
+				Name: "初音ミク", EnglishName: "Hatsune Miku", Comment: "コメント", EnglishComment: "comment",
+				VertexCount: 3, FaceCount: 1, MaterialCount: 1, BoneCount: 2, MorphCount: 2, RigidBodyCount: 2, JointCount: 1,
+				MorphNames: []string{"base", "まばたき"},
+			},
+		},
+		{
+			name:  "拡張部の無いPMD",
+			data:  buildPmd(false).buf.Bytes(),
+			parse: parsePmdHeader,
+			want: ModelHeader{
+				Format: FormatPmd, Version: 1, Encoding: EncodingShiftJIS,
+				Name: "初音ミク", Comment: "コメント",
+				VertexCount: 3, FaceCount: 1, MaterialCount: 1, BoneCount: 2, MorphCount: 2,
+				MorphNames: []string{"base", "まばたき"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := readFixtureHeader(tt.data, tt.parse, false)
+			if err != nil {
+				t.Fatalf("read header error = %v", err)
+			}
+			if !reflect.DeepEqual(header, tt.want) {
+				t.Errorf("header = %+v, want %+v", header, tt.want)
+			}
+			names, err := readFixtureHeader(tt.data, tt.parse, true)
+			if err != nil {
+				t.Fatalf("read names error = %v", err)
+			}
+			if names.Name != tt.want.Name {
+				t.Errorf("names only Name = %q, want %q", names.Name, tt.want.Name)
+			}
+		})
+	}
+}
+
+func TestReadModelHeaderTruncated(t *testing.T) {
+	fixtures := []struct {
+		name  string
+		file  *fixtureWriter
+		parse func(*headerReader, bool) (ModelHeader, error)
+	}{
+		{name: "PMX 2.0", file: buildPmx(2.0, false), parse: parsePmxHeader},
+		{name: "PMX 2.1", file: buildPmx(2.1, true), parse: parsePmxHeader},
+		{name: "PMD", file: buildPmd(true), parse: parsePmdHeader},
+	}
+	for _, fixture := range fixtures {
+		data := fixture.file.buf.Bytes()
+		for _, section := range fixture.file.sections {
+			// 各箇所の先頭1バイトのみを残して途中で終わらせる。
+			t.Run(fixture.name+"/"+section.name, func(t *testing.T) {
+				_, err := readFixtureHeader(data[:section.offset+1], fixture.parse, false)
+				var headerErr *HeaderError
+				if !errors.As(err, &headerErr) || !errors.Is(err, ErrHeaderTruncated) {
+					t.Fatalf("error = %v, want ErrHeaderTruncated", err)
+				}
+				if headerErr.Section != section.name {
+					t.Errorf("Section = %q, want %q", headerErr.Section, section.name)
+				}
+			})
+		}
+	}
+}
+
+func TestReadModelHeaderCorrupted(t *testing.T) {
+	// patch はファイルの複製の指定位置へ4バイトの値を書き込む。
+	patch := func(file *fixtureWriter, offset int, value int32) []byte {
+		data := bytes.Clone(file.buf.Bytes())
+		binary.LittleEndian.PutUint32(data[offset:], uint32(value))
+		return data
+	}
+	pmx := buildPmx(2.0, false)
+	pmd := buildPmd(true)
+	tests := []struct {
+		name    string
+		data    []byte
+		parse   func(*headerReader, bool) (ModelHeader, error)
+		section string
+	}{
+		{name: "PMXの負の頂点数", data: patch(pmx, pmx.counts["vertices"], -1), parse: parsePmxHeader, section: "vertices"},
+		{name: "PMXの負のモーフ数", data: patch(pmx, pmx.counts["morphs"], -5), parse: parsePmxHeader, section: "morphs"},
+		{name: "PMXの負の剛体数", data: patch(pmx, pmx.counts["rigid bodies"], math.MinInt32), parse: parsePmxHeader, section: "rigid bodies"},
+		{name: "PMXの長すぎるモデル名", data: patch(pmx, sectionOffset(pmx, "name"), maxHeaderTextLength+1), parse: parsePmxHeader, section: "name"},
+		{name: "PMXの負の文字列長", data: patch(pmx, sectionOffset(pmx, "comment"), -2), parse: parsePmxHeader, section: "comment"},
+		{name: "PMXの3の倍数でない面数", data: patch(pmx, pmx.counts["faces"], 4), parse: parsePmxHeader, section: "faces"},
+		{name: "PMXの未知の版", data: patch(pmx, sectionOffset(pmx, "version"), 0x40400000), parse: parsePmxHeader, section: "version"},
+		{name: "PMDの負の頂点数", data: patch(pmd, pmd.counts["vertices"], -1), parse: parsePmdHeader, section: "vertices"},
+		{name: "PMDの負のジョイント数", data: patch(pmd, pmd.counts["joints"], -1), parse: parsePmdHeader, section: "joints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFixtureHeader(tt.data, tt.parse, false)
+			var headerErr *HeaderError
+			if !errors.As(err, &headerErr) || !errors.Is(err, ErrHeaderCorrupted) {
+				t.Fatalf("error = %v, want ErrHeaderCorrupted", err)
+			}
+			if headerErr.Section != tt.section {
+				t.Errorf("Section = %q, want %q", headerErr.Section, tt.section)
+			}
+		})
+	}
+}
+
+func TestReadModelHeaderUnsupported(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		parse func(*headerReader, bool) (ModelHeader, error)
+	}{
+		{name: "PMXでないシグネチャ", data: []byte("Pmd 0000"), parse: parsePmxHeader},
+		{name: "PMDでないシグネチャ", data: []byte("PMX 0000"), parse: parsePmdHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readFixtureHeader(tt.data, tt.parse, false); !errors.Is(err, ErrHeaderUnsupported) {
+				t.Errorf("error = %v, want ErrHeaderUnsupported", err)
+			}
+		})
+	}
+}
+
+func TestReadModelHeaderNeverPanics(t *testing.T) {
+	// 全ての位置で途中終了・値の破損を与えても、panicせずに型付きのエラーを返すことを確かめる。
+	fixtures := []struct {
+		data  []byte
+		parse func(*headerReader, bool) (ModelHeader, error)
+	}{
+		{data: buildPmx(2.0, false).buf.Bytes(), parse: parsePmxHeader},
+		{data: buildPmx(2.1, true).buf.Bytes(), parse: parsePmxHeader},
+		{data: buildPmd(true).buf.Bytes(), parse: parsePmdHeader},
+	}
+	for _, fixture := range fixtures {
+		for offset := range fixture.data {
+			for _, value := range []byte{0x00, 0x7f, 0x80, 0xff} {
+				data := bytes.Clone(fixture.data)
+				data[offset] = value
+				for _, input := range [][]byte{data, data[:offset]} {
+					_, err := readFixtureHeader(input, fixture.parse, false)
+					if err != nil && !errors.Is(err, ErrHeaderTruncated) && !errors.Is(err, ErrHeaderCorrupted) && !errors.Is(err, ErrHeaderUnsupported) {
+						t.Fatalf("offset %d value %#x: untyped error %v", offset, value, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReadPmxTextures(t *testing.T) {
+	for _, utf8 := range []bool{false, true} {
+		data := buildPmx(2.0, utf8).buf.Bytes()
+		textures, err := ReadPmxTextures("model.pmx", bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("ReadPmxTextures() error = %v", err)
+		}
+		if want := []string{"tex/body.png", "toon.bmp"}; !reflect.DeepEqual(textures, want) {
+			t.Errorf("ReadPmxTextures() = %v, want %v", textures, want)
+		}
+	}
+	if _, err := ReadPmxTextures("model.pmx", strings.NewReader("PMX "), 4); !errors.Is(err, ErrHeaderTruncated) {
+		t.Errorf("ReadPmxTextures() truncated error = %v, want ErrHeaderTruncated", err)
+	}
+}
+
+// sectionOffset は箇所の開始位置を返す。
+func sectionOffset(file *fixtureWriter, name string) int {
+	for _, section := range file.sections {
+		if section.name == name {
+			return section.offset
+		}
+	}
+	panic("unknown section " + name)
+}
@@ -2,29 +2,47 @@
 package minteractor
 
 import (
+	"github.com/miu200521358/mlib_go/pkg/domain/model"
 	"github.com/miu200521358/mlib_go/pkg/usecase"
 	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
 )
 
-// LoadModel はモデルを読み込み、結果を返す。
+// LoadModel はモデルを読み込み、結果を返す。アーカイブ内のモデルは一時展開してから読み込む。
+// 読み込み用のリポジトリを指定しない場合は、ファイルサイズと更新日時が変わっていない読み込み済みのモデルを再利用する。
 func (uc *TreeViewerUsecase) LoadModel(rep moutput.IFileReader, path string) (*ModelLoadResult, error) {
-	repo := rep
-	if repo == nil {
-		repo = uc.modelReader
+	if rep != nil {
+		modelData, err := uc.readModel(rep, path)
+		if err != nil {
+			return nil, err
+		}
+		return &ModelLoadResult{Model: modelData}, nil
 	}
-	modelData, err := usecase.LoadModel(repo, path)
+	modelData, err := uc.loadModelCached(path, false)
 	if err != nil {
 		return nil, err
 	}
 	return &ModelLoadResult{Model: modelData}, nil
 }
 
-// LoadMotion はモーションを読み込み、最大フレーム情報を返す。
+// readModel はキャッシュを使わずにモデルを読み込む。
+func (uc *TreeViewerUsecase) readModel(repo moutput.IFileReader, path string) (*model.PmxModel, error) {
+	path, err := uc.resolveArchivePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return usecase.LoadModel(repo, path)
+}
+
+// LoadMotion はモーションを読み込み、最大フレーム情報を返す。アーカイブ内のモーションは一時展開してから読み込む。
 func (uc *TreeViewerUsecase) LoadMotion(rep moutput.IFileReader, path string) (*MotionLoadResult, error) {
 	repo := rep
 	if repo == nil {
 		repo = uc.motionReader
 	}
+	path, err := uc.resolveArchivePath(path)
+	if err != nil {
+		return nil, err
+	}
 	result, err := usecase.LoadMotionWithMeta(repo, path)
 	if err != nil {
 		return nil, err
@@ -39,3 +57,23 @@ func (uc *TreeViewerUsecase) LoadMotion(rep moutput.IFileReader, path string) (*
 func (uc *TreeViewerUsecase) CanLoadModelPath(path string) bool {
 	return usecase.CanLoadPath(uc.modelReader, path)
 }
+
+// ResolveLocalPath はアーカイブ内の仮想パスを一時展開したファイルのパスへ変換する。アーカイブ外のパスはそのまま返す。
+func (uc *TreeViewerUsecase) ResolveLocalPath(path string) (string, error) {
+	return uc.resolveArchivePath(path)
+}
+
+// resolveArchivePath はアーカイブ内の仮想パスを展開済みのパスへ変換する。
+func (uc *TreeViewerUsecase) resolveArchivePath(path string) (string, error) {
+	if uc.archiveResolver == nil {
+		return path, nil
+	}
+	localPath, ok, err := uc.archiveResolver.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return path, nil
+	}
+	return localPath, nil
+}
@@ -0,0 +1,243 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"container/list"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/miu200521358/mlib_go/pkg/domain/model"
+	"github.com/tiendc/go-deepcopy"
+)
+
+const (
+	// modelCacheMaxEntries はモデルキャッシュに保持する件数の上限を表す。
+	modelCacheMaxEntries = 16
+	// modelCacheMaxBytes はモデルキャッシュに保持するモデルの推定メモリ量の上限を表す。
+	modelCacheMaxBytes = int64(1) << 30
+	// modelMemoryFactor はファイルサイズから読み込み後のメモリ量を推定する倍率を表す。
+	modelMemoryFactor = 10
+)
+
+// cloneModel はモデルの複製を返す。キャッシュが保持するモデルは表示側へ渡さず、複製を渡す。
+var cloneModel = func(src *model.PmxModel) (*model.PmxModel, error) {
+	copied := &model.PmxModel{}
+	if err := deepcopy.Copy(copied, src); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// modelCacheEntry はキャッシュしたモデルと、読み込み時点のファイル情報を表す。
+type modelCacheEntry struct {
+	key     string
+	size    int64
+	modTime int64
+	bytes   int64
+	model   *model.PmxModel
+}
+
+// modelCache は読み込み済みのモデルを最近使った順に保持するキャッシュを表す。
+// 件数と推定メモリ量の上限を超えた場合は古いものから破棄する。
+type modelCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+// newModelCache はモデルキャッシュを生成する。
+func newModelCache(maxEntries int, maxBytes int64) *modelCache {
+	return &modelCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// modelCacheKey はパスの表記揺れを吸収したキャッシュのキーを返す。
+func modelCacheKey(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
+
+// get はファイルサイズと更新日時が一致するモデルの複製を返す。一致しない場合や複製できない場合は破棄してfalseを返す。
+// 表示側は受け取ったモデルを変更するため、保持しているモデルそのものは返さない。
+func (c *modelCache) get(path string, size, modTime int64) (*model.PmxModel, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[modelCacheKey(path)]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*modelCacheEntry)
+	if entry.size != size || entry.modTime != modTime {
+		c.remove(element)
+		return nil, false
+	}
+	copied, err := cloneModel(entry.model)
+	if err != nil {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return copied, true
+}
+
+// contains はファイルサイズと更新日時が一致するモデルを保持しているか判定する。使用順は変えない。
+func (c *modelCache) contains(path string, size, modTime int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[modelCacheKey(path)]
+	if !ok {
+		return false
+	}
+	entry := element.Value.(*modelCacheEntry)
+	return entry.size == size && entry.modTime == modTime
+}
+
+// put はモデルを先頭に追加し、上限を超えた分を古いものから破棄する。
+// 推定メモリ量が上限を超えるモデルは保持しない。追加したモデルはキャッシュが所有するため、呼び出し元は変更しない。
+func (c *modelCache) put(path string, size, modTime int64, modelData *model.PmxModel) {
+	if modelData == nil {
+		return
+	}
+	bytes := size * modelMemoryFactor
+	if bytes > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := modelCacheKey(path)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	entry := &modelCacheEntry{key: key, size: size, modTime: modTime, bytes: bytes, model: modelData}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += bytes
+	for c.order.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove はキャッシュからモデルを破棄する。ロックを取得した状態で呼び出す。
+func (c *modelCache) remove(element *list.Element) {
+	entry := element.Value.(*modelCacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.bytes
+}
+
+// stats は保持している件数と推定メモリ量を返す。
+func (c *modelCache) stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes
+}
+
+// modelLoad は読み込み中のモデルを表す。同じモデルの読み込みは完了を待って結果を共有する。
+type modelLoad struct {
+	done chan struct{}
+}
+
+// loadModelCached はキャッシュを確かめてからモデルを読み込み、読み込んだモデルをキャッシュへ追加する。
+// 同じモデルを読み込み中の場合は完了を待つ。prefetchは先読みからの呼び出しかを表し、先読みでは読み込み中のモデルを待たずに戻る。
+// 返すモデルはキャッシュが保持するものとは別の複製で、呼び出し元が変更してよい。先読みではモデルを返さない。
+func (uc *TreeViewerUsecase) loadModelCached(path string, prefetch bool) (*model.PmxModel, error) {
+	if uc.hasher == nil || uc.modelCache == nil {
+		return uc.readModel(uc.modelReader, path)
+	}
+	size, modTime, err := uc.hasher.Stat(path)
+	if err != nil {
+		// 状態を確かめられないファイルはキャッシュせず、読み込みのエラーをそのまま返す。
+		return uc.readModel(uc.modelReader, path)
+	}
+	key := modelCacheKey(path)
+	var own *modelLoad
+	for own == nil {
+		if modelData, ok := uc.modelCache.get(path, size, modTime); ok {
+			if !prefetch {
+				uc.logCache("モデルキャッシュ命中: %s", path)
+			}
+			return modelData, nil
+		}
+		uc.loadingMu.Lock()
+		current, loading := uc.loading[key]
+		if !loading {
+			own = &modelLoad{done: make(chan struct{})}
+			uc.loading[key] = own
+			uc.loadingMu.Unlock()
+			continue
+		}
+		uc.loadingMu.Unlock()
+		if prefetch {
+			return nil, nil
+		}
+		<-current.done
+	}
+	defer func() {
+		uc.loadingMu.Lock()
+		delete(uc.loading, key)
+		uc.loadingMu.Unlock()
+		close(own.done)
+	}()
+
+	if prefetch {
+		uc.logCache("モデルを先読みします: %s", path)
+	} else {
+		uc.logCache("モデルキャッシュ未命中: %s", path)
+	}
+	modelData, err := uc.readModel(uc.modelReader, path)
+	if err != nil {
+		return nil, err
+	}
+	if prefetch {
+		uc.modelCache.put(path, size, modTime, modelData)
+		return nil, nil
+	}
+	copied, err := cloneModel(modelData)
+	if err != nil {
+		// 複製できないモデルはキャッシュせず、読み込んだものをそのまま渡す。
+		uc.logCache("モデルを複製できないためキャッシュしません: %s (%s)", path, err.Error())
+		return modelData, nil
+	}
+	uc.modelCache.put(path, size, modTime, modelData)
+	return copied, nil
+}
+
+// PrefetchModels は指定のモデルを順にバックグラウンドで読み込み、キャッシュへ追加する。
+// 新たに呼び出された場合は、読み込み中のモデルを終えた時点で前回の先読みを打ち切る。
+func (uc *TreeViewerUsecase) PrefetchModels(paths []string) {
+	if uc == nil || uc.hasher == nil || uc.modelCache == nil || len(paths) == 0 {
+		return
+	}
+	seq := uc.prefetchSeq.Add(1)
+	targets := append([]string{}, paths...)
+	go func() {
+		for _, path := range targets {
+			if uc.prefetchSeq.Load() != seq {
+				return
+			}
+			if size, modTime, err := uc.hasher.Stat(path); err != nil || uc.modelCache.contains(path, size, modTime) {
+				continue
+			}
+			if _, err := uc.loadModelCached(path, true); err != nil {
+				uc.logCache("モデルの先読みに失敗しました: %s (%s)", path, err.Error())
+			}
+		}
+	}()
+}
+
+// logCache はモデルキャッシュの状態を添えてデバッグログを出力する。
+func (uc *TreeViewerUsecase) logCache(format string, path string, params ...any) {
+	if uc.logger == nil {
+		return
+	}
+	count, bytes := uc.modelCache.stats()
+	args := append([]any{path}, params...)
+	args = append(args, count, bytes>>20)
+	uc.logger.Debug(format+" (保持数=%d, 推定=%dMB)", args...)
+}
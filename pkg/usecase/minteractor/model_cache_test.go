@@ -0,0 +1,32 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"testing"
+
+	"github.com/miu200521358/mlib_go/pkg/domain/model"
+)
+
+func TestModelCacheGetReturnsCopy(t *testing.T) {
+	cache := newModelCache(modelCacheMaxEntries, modelCacheMaxBytes)
+	master := &model.PmxModel{}
+	cache.put(`C:/m/miku.pmx`, 100, 1, master)
+
+	first, ok := cache.get(`C:/M/Miku.pmx`, 100, 1)
+	if !ok || first == nil {
+		t.Fatalf("get() = %v, %v, want cached model", first, ok)
+	}
+	second, ok := cache.get(`C:/m/miku.pmx`, 100, 1)
+	if !ok || second == nil {
+		t.Fatalf("get() = %v, %v, want cached model", second, ok)
+	}
+	if first == master || second == master {
+		t.Errorf("get() returned the cached instance itself")
+	}
+	if first == second {
+		t.Errorf("get() returned the same instance twice")
+	}
+	if _, ok := cache.get(`C:/m/miku.pmx`, 200, 1); ok {
+		t.Errorf("get() with a different size hit the cache")
+	}
+}
@@ -0,0 +1,587 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ModelMetadata はクエリで照合するモデルの情報を表す。
+type ModelMetadata struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// Header はモデルのヘッダ情報。クエリがヘッダを使わない場合は読み込まない。
+	Header ModelHeader
+	// HeaderErr はヘッダの読み込みに失敗した場合のエラーを表す。
+	HeaderErr error
+	Tags      []string
+	HasNote   bool
+}
+
+// ReadModelMetadata はクエリで照合するファイルの情報を読み込む。
+// withHeaderの場合はヘッダも読み込み、読み込めない場合はHeaderErrに記録する。
+func (uc *TreeViewerUsecase) ReadModelMetadata(path string, withHeader bool) (ModelMetadata, error) {
+	size, modTime, err := uc.statFile(path)
+	if err != nil {
+		return ModelMetadata{Path: path}, err
+	}
+	meta := ModelMetadata{Path: path, Size: size, ModTime: modTime}
+	if withHeader {
+		meta.Header, meta.HeaderErr = uc.readModelHeader(path, false)
+	}
+	return meta, nil
+}
+
+// QueryError はクエリの誤りと、その位置(先頭からの文字数)を表す。
+type QueryError struct {
+	Pos     int
+	Message string
+}
+
+// Error はエラー内容を返す。位置は1始まりで表す。
+func (e *QueryError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("position %d: %s", e.Pos+1, e.Message)
+}
+
+// Query は解析済みのクエリを表す。
+// 例: bones>300 AND morph:"ウィンク２" AND NOT physics, author:"xxx" AND size<50MB
+type Query struct {
+	text        string
+	root        queryExpr
+	needsHeader bool
+}
+
+// ParseQuery はクエリ文字列を解析する。空文字の場合はnilを返す。
+// 条件は「項目 演算子 値」(演算子は : = != < <= > >=)、フラグ(physics・tagged・note)、
+// 項目名の無い文字列(ファイル名・モデル名の部分一致)で、AND・OR・NOTと括弧で組み合わせる。
+// ANDは省略できる。
+func ParseQuery(text string) (*Query, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != queryTokenEOF {
+		return nil, &QueryError{Pos: token.pos, Message: fmt.Sprintf("unexpected %q", token.text)}
+	}
+	return &Query{text: strings.TrimSpace(text), root: root, needsHeader: parser.needsHeader}, nil
+}
+
+// String はクエリ文字列を返す。
+func (q *Query) String() string {
+	if q == nil {
+		return ""
+	}
+	return q.text
+}
+
+// NeedsHeader はモデルのヘッダを使う条件を含むか判定する。
+func (q *Query) NeedsHeader() bool {
+	return q != nil && q.needsHeader
+}
+
+// Match はモデルがクエリに一致するか判定する。nilのクエリは全てに一致する。
+// ヘッダを使うクエリでは、ヘッダを読み込めなかったモデルは条件によらず一致しない。
+func (q *Query) Match(meta ModelMetadata) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+	if q.needsHeader && meta.HeaderErr != nil {
+		return false
+	}
+	return q.root.eval(meta)
+}
+
+// queryTokenKind は字句の種類を表す。
+type queryTokenKind int
+
+const (
+	queryTokenEOF queryTokenKind = iota
+	queryTokenWord
+	queryTokenString
+	queryTokenOperator
+	queryTokenOpen
+	queryTokenClose
+)
+
+// queryToken はクエリの字句を表す。
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+// isQueryDelimiter は単語の区切りとなる文字か判定する。
+func isQueryDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()<>=:!"`, r)
+}
+
+// tokenizeQuery はクエリ文字列を字句に分割する。
+func tokenizeQuery(text string) ([]queryToken, error) {
+	runes := []rune(text)
+	var tokens []queryToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryTokenOpen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryTokenClose, text: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var builder strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					builder.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				builder.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &QueryError{Pos: start, Message: "unterminated quoted string"}
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenString, text: builder.String(), pos: start})
+		case strings.ContainsRune("<>=:!", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' && r != ':' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &QueryError{Pos: i, Message: `"!" must be followed by "="`}
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenOperator, text: op, pos: i})
+			i += len([]rune(op))
+		default:
+			start := i
+			for i < len(runes) && !isQueryDelimiter(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenWord, text: string(runes[start:i]), pos: start})
+		}
+	}
+	return append(tokens, queryToken{kind: queryTokenEOF, pos: len(runes)}), nil
+}
+
+// queryParser は字句列から条件式を組み立てる。
+type queryParser struct {
+	tokens      []queryToken
+	index       int
+	needsHeader bool
+}
+
+// peek は次の字句を返す。
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.index]
+}
+
+// next は次の字句を返して読み進める。
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.index]
+	if token.kind != queryTokenEOF {
+		p.index++
+	}
+	return token
+}
+
+// isKeyword は次の字句が指定のキーワード(大文字小文字を区別しない)か判定する。
+func (p *queryParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == queryTokenWord && strings.EqualFold(token.text, keyword)
+}
+
+// parseOr は OR で区切った条件を解析する。
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd は AND で区切った条件を解析する。ANDが省略された並びもANDとする。
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword("AND") {
+			p.next()
+		} else if token := p.peek(); token.kind == queryTokenEOF || token.kind == queryTokenClose || p.isKeyword("OR") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+}
+
+// parseNot は NOT を前置した条件を解析する。
+func (p *queryParser) parseNot() (queryExpr, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary は括弧・条件・フラグ・文字列のいずれかを解析する。
+func (p *queryParser) parsePrimary() (queryExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case queryTokenOpen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != queryTokenClose {
+			return nil, &QueryError{Pos: closing.pos, Message: fmt.Sprintf("missing %q for %q at position %d", ")", "(", token.pos+1)}
+		}
+		return inner, nil
+	case queryTokenString:
+		p.needsHeader = true
+		return textExpr{value: strings.ToLower(token.text)}, nil
+	case queryTokenWord:
+		if keyword := strings.ToUpper(token.text); keyword == "AND" || keyword == "OR" {
+			return nil, &QueryError{Pos: token.pos, Message: fmt.Sprintf("condition expected before %s", keyword)}
+		}
+		if p.peek().kind == queryTokenOperator {
+			return p.parseCondition(token)
+		}
+		if flag, ok := queryFlags[strings.ToLower(token.text)]; ok {
+			p.needsHeader = p.needsHeader || flag.header
+			return flag, nil
+		}
+		p.needsHeader = true
+		return textExpr{value: strings.ToLower(token.text)}, nil
+	case queryTokenEOF:
+		return nil, &QueryError{Pos: token.pos, Message: "condition expected at end of query"}
+	default:
+		return nil, &QueryError{Pos: token.pos, Message: fmt.Sprintf("unexpected %q", token.text)}
+	}
+}
+
+// parseCondition は「項目 演算子 値」の条件を解析する。
+func (p *queryParser) parseCondition(name queryToken) (queryExpr, error) {
+	field, ok := queryFields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, &QueryError{Pos: name.pos, Message: fmt.Sprintf("unknown field %q (available: %s)", name.text, queryFieldNames())}
+	}
+	op := p.next()
+	value := p.next()
+	if value.kind != queryTokenWord && value.kind != queryTokenString {
+		return nil, &QueryError{Pos: value.pos, Message: fmt.Sprintf("value expected after %s%s", name.text, op.text)}
+	}
+	p.needsHeader = p.needsHeader || field.header
+	condition := conditionExpr{field: field, op: op.text}
+	switch field.kind {
+	case queryFieldText, queryFieldList:
+		if op.text != ":" && op.text != "=" && op.text != "!=" {
+			return nil, &QueryError{Pos: op.pos, Message: fmt.Sprintf("operator %q cannot be used with %s (use :, = or !=)", op.text, name.text)}
+		}
+		condition.text = strings.ToLower(value.text)
+	case queryFieldNumber:
+		number, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, &QueryError{Pos: value.pos, Message: fmt.Sprintf("%s needs a number, got %q", name.text, value.text)}
+		}
+		condition.number = number
+	case queryFieldSize:
+		size, err := parseQuerySize(value.text)
+		if err != nil {
+			return nil, &QueryError{Pos: value.pos, Message: fmt.Sprintf("%s needs a size such as 50MB, got %q", name.text, value.text)}
+		}
+		condition.number = size
+	case queryFieldDate:
+		date, err := time.ParseInLocation("2006-01-02", value.text, time.Local)
+		if err != nil {
+			return nil, &QueryError{Pos: value.pos, Message: fmt.Sprintf("%s needs a date such as 2024-01-31, got %q", name.text, value.text)}
+		}
+		condition.number = float64(date.Unix())
+	}
+	return condition, nil
+}
+
+// parseQuerySize は単位(B・KB・MB・GB、1024倍)付きのサイズをバイト数に変換する。
+func parseQuerySize(text string) (float64, error) {
+	upper := strings.ToUpper(text)
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.scale
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(upper, 64)
+	if err != nil {
+		return 0, err
+	}
+	return number * multiplier, nil
+}
+
+// queryExpr はクエリの条件式を表す。
+type queryExpr interface {
+	eval(meta ModelMetadata) bool
+}
+
+// andExpr は両方の条件に一致することを表す。
+type andExpr struct {
+	left, right queryExpr
+}
+
+// eval は両方の条件に一致するか判定する。
+func (e andExpr) eval(meta ModelMetadata) bool {
+	return e.left.eval(meta) && e.right.eval(meta)
+}
+
+// orExpr はいずれかの条件に一致することを表す。
+type orExpr struct {
+	left, right queryExpr
+}
+
+// eval はいずれかの条件に一致するか判定する。
+func (e orExpr) eval(meta ModelMetadata) bool {
+	return e.left.eval(meta) || e.right.eval(meta)
+}
+
+// notExpr は条件に一致しないことを表す。
+type notExpr struct {
+	inner queryExpr
+}
+
+// eval は内側の条件に一致しないか判定する。
+func (e notExpr) eval(meta ModelMetadata) bool {
+	return !e.inner.eval(meta)
+}
+
+// textExpr は項目名の無い文字列で、ファイル名・モデル名の部分一致を表す。
+type textExpr struct {
+	value string
+}
+
+// eval はファイル名・モデル名・英語名のいずれかが文字列を含むか判定する。
+func (e textExpr) eval(meta ModelMetadata) bool {
+	for _, text := range []string{filepath.Base(meta.Path), meta.Header.Name, meta.Header.EnglishName} {
+		if strings.Contains(strings.ToLower(text), e.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagExpr は値を持たない条件を表す。
+type flagExpr struct {
+	header bool
+	match  func(meta ModelMetadata) bool
+}
+
+// eval は値を持たない条件に一致するか判定する。
+func (e flagExpr) eval(meta ModelMetadata) bool {
+	return e.match(meta)
+}
+
+// queryFlags は値を持たない条件の一覧を表す。
+var queryFlags = map[string]flagExpr{
+	"physics": {header: true, match: func(meta ModelMetadata) bool { return meta.Header.RigidBodyCount > 0 }},
+	"tagged":  {match: func(meta ModelMetadata) bool { return len(meta.Tags) > 0 }},
+	"note":    {match: func(meta ModelMetadata) bool { return meta.HasNote }},
+}
+
+// queryFieldKind は項目の値の種類を表す。
+type queryFieldKind int
+
+const (
+	queryFieldText queryFieldKind = iota
+	queryFieldList
+	queryFieldNumber
+	queryFieldSize
+	queryFieldDate
+)
+
+// queryField は条件に使える項目を表す。
+type queryField struct {
+	name   string
+	kind   queryFieldKind
+	header bool
+	// values は文字列・一覧の項目の値を返す。
+	values func(meta ModelMetadata) []string
+	// number は数値・サイズ・日付の項目の値を返す。
+	number func(meta ModelMetadata) float64
+}
+
+// textField は文字列の項目を生成する。
+func textField(name string, header bool, value func(meta ModelMetadata) []string) *queryField {
+	return &queryField{name: name, kind: queryFieldText, header: header, values: value}
+}
+
+// countField はヘッダの件数の項目を生成する。
+func countField(name string, count func(header ModelHeader) int) *queryField {
+	return &queryField{name: name, kind: queryFieldNumber, header: true, number: func(meta ModelMetadata) float64 {
+		return float64(count(meta.Header))
+	}}
+}
+
+// queryFields は条件に使える項目を名前(別名を含む)で引く。
+var queryFields = func() map[string]*queryField {
+	comment := func(meta ModelMetadata) []string {
+		return []string{meta.Header.Comment, meta.Header.EnglishComment}
+	}
+	fields := []struct {
+		names []string
+		field *queryField
+	}{
+		{[]string{"name"}, textField("name", true, func(meta ModelMetadata) []string {
+			return []string{meta.Header.Name, meta.Header.EnglishName}
+		})},
+		{[]string{"comment"}, textField("comment", true, comment)},
+		// 作者名はコメントに書かれることが多いため、コメントと照合する。
+		{[]string{"author"}, textField("author", true, comment)},
+		{[]string{"file"}, textField("file", false, func(meta ModelMetadata) []string {
+			return []string{filepath.Base(meta.Path)}
+		})},
+		{[]string{"path"}, textField("path", false, func(meta ModelMetadata) []string {
+			return []string{meta.Path}
+		})},
+		{[]string{"ext"}, textField("ext", false, func(meta ModelMetadata) []string {
+			return []string{strings.TrimPrefix(filepath.Ext(meta.Path), ".")}
+		})},
+		{[]string{"format"}, textField("format", true, func(meta ModelMetadata) []string {
+			return []string{meta.Header.Format}
+		})},
+		{[]string{"tag", "tags"}, &queryField{name: "tag", kind: queryFieldList, values: func(meta ModelMetadata) []string {
+			return meta.Tags
+		}}},
+		{[]string{"morph"}, &queryField{name: "morph", kind: queryFieldList, header: true, values: func(meta ModelMetadata) []string {
+			return meta.Header.MorphNames
+		}}},
+		{[]string{"vertices", "verts"}, countField("vertices", func(h ModelHeader) int { return h.VertexCount })},
+		{[]string{"faces"}, countField("faces", func(h ModelHeader) int { return h.FaceCount })},
+		{[]string{"materials"}, countField("materials", func(h ModelHeader) int { return h.MaterialCount })},
+		{[]string{"bones"}, countField("bones", func(h ModelHeader) int { return h.BoneCount })},
+		{[]string{"morphs"}, countField("morphs", func(h ModelHeader) int { return h.MorphCount })},
+		{[]string{"rigidbodies", "rigids"}, countField("rigidbodies", func(h ModelHeader) int { return h.RigidBodyCount })},
+		{[]string{"joints"}, countField("joints", func(h ModelHeader) int { return h.JointCount })},
+		{[]string{"size"}, &queryField{name: "size", kind: queryFieldSize, number: func(meta ModelMetadata) float64 {
+			return float64(meta.Size)
+		}}},
+		{[]string{"modified"}, &queryField{name: "modified", kind: queryFieldDate, number: func(meta ModelMetadata) float64 {
+			return float64(meta.ModTime.Unix())
+		}}},
+	}
+	byName := map[string]*queryField{}
+	for _, entry := range fields {
+		for _, name := range entry.names {
+			byName[name] = entry.field
+		}
+	}
+	return byName
+}()
+
+// queryFieldNames は条件に使える項目名を返す。エラーの案内に使う。
+func queryFieldNames() string {
+	return "name, comment, author, file, path, ext, format, tag, morph, vertices, faces, materials, bones, morphs, rigidbodies, joints, size, modified"
+}
+
+// conditionExpr は「項目 演算子 値」の条件を表す。
+type conditionExpr struct {
+	field  *queryField
+	op     string
+	text   string
+	number float64
+}
+
+// eval は項目の値が演算子と値の条件を満たすか判定する。
+func (e conditionExpr) eval(meta ModelMetadata) bool {
+	if e.field.kind == queryFieldText || e.field.kind == queryFieldList {
+		matched := false
+		for _, value := range e.field.values(meta) {
+			value = strings.ToLower(value)
+			if (e.op == ":" && strings.Contains(value, e.text)) || (e.op != ":" && value == e.text) {
+				matched = true
+				break
+			}
+		}
+		if e.op == "!=" {
+			return !matched
+		}
+		return matched
+	}
+	value := e.field.number(meta)
+	if e.field.kind == queryFieldDate {
+		// 日付は指定日の0時から翌日0時までを同じ日とみなす。
+		dayEnd := e.number + 24*60*60
+		switch e.op {
+		case "<":
+			return value < e.number
+		case "<=":
+			return value < dayEnd
+		case ">":
+			return value >= dayEnd
+		case ">=":
+			return value >= e.number
+		default:
+			sameDay := value >= e.number && value < dayEnd
+			return sameDay == (e.op != "!=")
+		}
+	}
+	switch e.op {
+	case "<":
+		return value < e.number
+	case "<=":
+		return value <= e.number
+	case ">":
+		return value > e.number
+	case ">=":
+		return value >= e.number
+	case "!=":
+		return value != e.number
+	default:
+		return value == e.number
+	}
+}
@@ -0,0 +1,171 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantNil     bool
+		wantErrPos  int
+		wantErr     bool
+		needsHeader bool
+	}{
+		{name: "空文字", text: "  ", wantNil: true},
+		{name: "フラグのみ", text: "tagged", needsHeader: false},
+		{name: "ヘッダを使うフラグ", text: "physics", needsHeader: true},
+		{name: "ファイル項目", text: `file:"miku"`, needsHeader: false},
+		{name: "ヘッダ項目", text: "bones>300", needsHeader: true},
+		{name: "項目名の無い文字列", text: "miku", needsHeader: true},
+		{name: "AND省略とOR", text: "size<50MB tagged OR ext=pmd", needsHeader: false},
+		{name: "括弧とNOT", text: `NOT (morph:"ウィンク２" OR physics) AND modified>=2024-01-31`, needsHeader: true},
+		{name: "未知の項目", text: "height>3", wantErr: true, wantErrPos: 0},
+		{name: "数値でない値", text: "bones>many", wantErr: true, wantErrPos: 6},
+		{name: "文字列項目に比較演算子", text: "name<abc", wantErr: true, wantErrPos: 4},
+		{name: "閉じていない引用符", text: `name:"abc`, wantErr: true, wantErrPos: 5},
+		{name: "閉じていない括弧", text: "(tagged", wantErr: true, wantErrPos: 7},
+		{name: "単独の感嘆符", text: "name!abc", wantErr: true, wantErrPos: 4},
+		{name: "先頭のAND", text: "AND tagged", wantErr: true, wantErrPos: 0},
+		{name: "末尾のOR", text: "tagged OR", wantErr: true, wantErrPos: 9},
+		{name: "不正な日付", text: "modified<2024/01/31", wantErr: true, wantErrPos: 9},
+		{name: "不正なサイズ", text: "size<fiftyMB", wantErr: true, wantErrPos: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseQuery(tt.text)
+			if tt.wantErr {
+				var queryErr *QueryError
+				if !errors.As(err, &queryErr) {
+					t.Fatalf("ParseQuery(%q) error = %v, want QueryError", tt.text, err)
+				}
+				if queryErr.Pos != tt.wantErrPos {
+					t.Errorf("ParseQuery(%q) error pos = %d, want %d (%s)", tt.text, queryErr.Pos, tt.wantErrPos, queryErr.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.text, err)
+			}
+			if tt.wantNil {
+				if query != nil {
+					t.Fatalf("ParseQuery(%q) = %v, want nil", tt.text, query)
+				}
+				return
+			}
+			if query == nil {
+				t.Fatalf("ParseQuery(%q) = nil", tt.text)
+			}
+			if got := query.NeedsHeader(); got != tt.needsHeader {
+				t.Errorf("ParseQuery(%q).NeedsHeader() = %v, want %v", tt.text, got, tt.needsHeader)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	meta := ModelMetadata{
+		Path:    `C:\models\Miku\miku_v2.pmx`,
+		Size:    30 << 20,
+		ModTime: time.Date(2024, 1, 31, 15, 0, 0, 0, time.Local),
+		Header: ModelHeader{
+			Format:         FormatPmx,
+			Name:           "初音ミク",
+			EnglishName:    "Hatsune Miku",
+			Comment:        "モデル制作: 作者A",
+			VertexCount:    12000,
+			BoneCount:      350,
+			RigidBodyCount: 40,
+			MorphNames:     []string{"まばたき", "ウィンク２"},
+		},
+		Tags:    []string{"お気に入り", "衣装"},
+		HasNote: false,
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "", want: true},
+		{text: "miku", want: true},
+		{text: "初音", want: true},
+		{text: "rin", want: false},
+		{text: "bones>300", want: true},
+		{text: "bones>=350", want: true},
+		{text: "bones<350", want: false},
+		{text: "verts=12000", want: true},
+		{text: "physics", want: true},
+		{text: "NOT physics", want: false},
+		{text: "tagged", want: true},
+		{text: "note", want: false},
+		{text: `morph:"ウィンク"`, want: true},
+		{text: `morph="ウィンク"`, want: false},
+		{text: `morph="ウィンク２"`, want: true},
+		{text: "tag=衣装", want: true},
+		{text: "tag!=衣装", want: false},
+		{text: `author:"作者a"`, want: true},
+		{text: "ext=PMX", want: true},
+		{text: "format=pmd", want: false},
+		{text: "size<50MB", want: true},
+		{text: "size>30M", want: false},
+		{text: "size>=30MB", want: true},
+		{text: "modified=2024-01-31", want: true},
+		{text: "modified<=2024-01-31", want: true},
+		{text: "modified>2024-01-31", want: false},
+		{text: "modified<2024-01-31", want: false},
+		{text: "modified>=2024-02-01", want: false},
+		{text: "rin OR bones>300", want: true},
+		{text: "rin OR (note AND tagged)", want: false},
+		{text: "bones>300 tagged", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			query, err := ParseQuery(tt.text)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.text, err)
+			}
+			if got := query.Match(meta); got != tt.want {
+				t.Errorf("ParseQuery(%q).Match() = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMatchHeaderErr(t *testing.T) {
+	// ヘッダを読み込めないモデルは、ヘッダを使う条件では否定や0との比較でも一致しない。
+	meta := ModelMetadata{
+		Path:      `C:\models\broken.pmx`,
+		Size:      1 << 20,
+		ModTime:   time.Date(2024, 1, 31, 15, 0, 0, 0, time.Local),
+		HeaderErr: &HeaderError{Path: `C:\models\broken.pmx`, Section: "vertices", Err: ErrHeaderCorrupted},
+		Tags:      []string{"衣装"},
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "NOT physics", want: false},
+		{text: "bones<100", want: false},
+		{text: "verts=0", want: false},
+		{text: "broken", want: false},
+		{text: "tagged OR bones>0", want: false},
+		{text: "tagged", want: true},
+		{text: "file:broken", want: true},
+		{text: "size<2MB", want: true},
+		{text: "NOT note", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			query, err := ParseQuery(tt.text)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.text, err)
+			}
+			if got := query.Match(meta); got != tt.want {
+				t.Errorf("ParseQuery(%q).Match() = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
+)
+
+// ModelTags はモデルに付けたタグとメモを表す。
+type ModelTags struct {
+	Tags []string
+	Note string
+}
+
+// IsEmpty はタグもメモも無いか判定する。
+func (t ModelTags) IsEmpty() bool {
+	return len(t.Tags) == 0 && strings.TrimSpace(t.Note) == ""
+}
+
+// HasTag は指定タグを持つか判定する。大文字小文字は区別しない。
+func (t ModelTags) HasTag(tag string) bool {
+	for _, current := range t.Tags {
+		if strings.EqualFold(current, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelTagUsecaseDeps はタグ管理用ユースケースの依存を表す。
+type ModelTagUsecaseDeps struct {
+	Store  moutput.ITagStore
+	Hasher moutput.IContentHasher
+}
+
+// ModelTagUsecase はモデルのタグとメモを内容ハッシュ単位で管理するユースケースを表す。
+// 内容ハッシュで紐付けるため、ファイルを移動・改名してもタグを引き継ぐ。
+type ModelTagUsecase struct {
+	store  moutput.ITagStore
+	hasher moutput.IContentHasher
+
+	loadOnce sync.Once
+	loadErr  error
+
+	mu      sync.Mutex
+	records map[string]moutput.TagRecord
+	// paths は最後に確認したパス(小文字)から内容ハッシュを引く。
+	paths map[string]string
+	// sizes はファイルサイズごとの記録数。サイズが一致しないファイルはハッシュを求めずに判定する。
+	sizes map[int64]int
+	dirty bool
+}
+
+// NewModelTagUsecase はタグ管理用ユースケースを生成する。
+func NewModelTagUsecase(deps ModelTagUsecaseDeps) *ModelTagUsecase {
+	return &ModelTagUsecase{
+		store:   deps.Store,
+		hasher:  deps.Hasher,
+		records: map[string]moutput.TagRecord{},
+		paths:   map[string]string{},
+		sizes:   map[int64]int{},
+	}
+}
+
+// ParseTags は区切り文字(カンマ・読点・空白)で区切ったタグを重複無しで返す。大文字小文字違いは先に現れたものを残す。
+func ParseTags(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '、' || r == '，' || unicode.IsSpace(r)
+	})
+	tags := make([]string, 0, len(fields))
+	for _, field := range fields {
+		tag := strings.TrimSpace(field)
+		if tag == "" || (ModelTags{Tags: tags}).HasTag(tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Lookup は指定ファイルのタグとメモを返す。記録が無い場合は空を返す。
+// 記録時と異なるパス・内容で見つかった場合は、記録のパスや内容ハッシュを更新する。
+func (uc *ModelTagUsecase) Lookup(path string) (ModelTags, error) {
+	if uc == nil || uc.hasher == nil || path == "" {
+		return ModelTags{}, nil
+	}
+	if err := uc.ensureLoaded(); err != nil {
+		return ModelTags{}, err
+	}
+	size, modTime, err := uc.hasher.Stat(path)
+	if err != nil {
+		return ModelTags{}, err
+	}
+	key := strings.ToLower(path)
+	uc.mu.Lock()
+	knownHash, known := uc.paths[key]
+	if known {
+		if record := uc.records[knownHash]; record.Size == size && record.ModTime == modTime {
+			uc.mu.Unlock()
+			return modelTagsOf(record), nil
+		}
+	}
+	candidate := uc.sizes[size] > 0
+	uc.mu.Unlock()
+	if !known && !candidate {
+		return ModelTags{}, nil
+	}
+
+	hash, err := uc.hasher.Hash(context.Background(), path)
+	if err != nil {
+		return ModelTags{}, err
+	}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	record, ok := uc.records[hash]
+	switch {
+	case ok && !strings.EqualFold(record.Path, path) && uc.exists(record.Path):
+		// 複製されたファイル。記録のパスは元のファイルのまま残す。
+		return modelTagsOf(record), nil
+	case ok:
+		// 移動・改名されたファイル。最後に確認したパスを更新する。
+	case known:
+		// 同じパスのファイルが編集された場合は、新しい内容へ記録を引き継ぐ。
+		record = uc.records[knownHash]
+		uc.removeLocked(knownHash)
+	default:
+		return ModelTags{}, nil
+	}
+	record.Path = path
+	record.Size = size
+	record.ModTime = modTime
+	uc.putLocked(hash, record)
+	return modelTagsOf(record), nil
+}
+
+// exists は記録のパスにファイルが残っているか判定する。
+func (uc *ModelTagUsecase) exists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, _, err := uc.hasher.Stat(path)
+	return err == nil
+}
+
+// SetTags は指定ファイルのタグとメモを保存する。タグもメモも空の場合は記録を削除する。
+func (uc *ModelTagUsecase) SetTags(path string, tags ModelTags) error {
+	if uc == nil || uc.hasher == nil || path == "" {
+		return nil
+	}
+	if err := uc.ensureLoaded(); err != nil {
+		return err
+	}
+	size, modTime, err := uc.hasher.Stat(path)
+	if err != nil {
+		return err
+	}
+	hash, err := uc.hasher.Hash(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	uc.mu.Lock()
+	if knownHash, ok := uc.paths[strings.ToLower(path)]; ok && knownHash != hash {
+		// 編集前の内容の記録は、新しい内容の記録で置き換える。
+		uc.removeLocked(knownHash)
+	}
+	if tags.IsEmpty() {
+		uc.removeLocked(hash)
+	} else {
+		uc.putLocked(hash, moutput.TagRecord{
+			Tags:    ParseTags(strings.Join(tags.Tags, ",")),
+			Note:    strings.TrimSpace(tags.Note),
+			Path:    path,
+			Size:    size,
+			ModTime: modTime,
+		})
+	}
+	uc.mu.Unlock()
+	return uc.Save()
+}
+
+// AllTags は記録済みのタグを大文字小文字を無視した名前順で返す。
+func (uc *ModelTagUsecase) AllTags() []string {
+	if uc == nil {
+		return nil
+	}
+	if err := uc.ensureLoaded(); err != nil {
+		return nil
+	}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	var all ModelTags
+	for _, record := range uc.records {
+		for _, tag := range record.Tags {
+			if !all.HasTag(tag) {
+				all.Tags = append(all.Tags, tag)
+			}
+		}
+	}
+	sort.Slice(all.Tags, func(i, j int) bool {
+		return strings.ToLower(all.Tags[i]) < strings.ToLower(all.Tags[j])
+	})
+	return all.Tags
+}
+
+// Save は未保存の変更がある場合に記録を保存する。
+func (uc *ModelTagUsecase) Save() error {
+	if uc == nil || uc.store == nil {
+		return nil
+	}
+	uc.mu.Lock()
+	if !uc.dirty {
+		uc.mu.Unlock()
+		return nil
+	}
+	snapshot := make(map[string]moutput.TagRecord, len(uc.records))
+	for hash, record := range uc.records {
+		snapshot[hash] = record
+	}
+	uc.dirty = false
+	uc.mu.Unlock()
+	if err := uc.store.Save(snapshot); err != nil {
+		uc.mu.Lock()
+		uc.dirty = true
+		uc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// ensureLoaded は保存済みの記録を初回のみ読み込む。
+func (uc *ModelTagUsecase) ensureLoaded() error {
+	uc.loadOnce.Do(func() {
+		if uc.store == nil {
+			return
+		}
+		records, err := uc.store.Load()
+		uc.loadErr = err
+		uc.mu.Lock()
+		defer uc.mu.Unlock()
+		for hash, record := range records {
+			uc.putLocked(hash, record)
+		}
+		uc.dirty = false
+	})
+	return uc.loadErr
+}
+
+// putLocked は記録を追加・更新する。uc.muを保持して呼び出す。
+func (uc *ModelTagUsecase) putLocked(hash string, record moutput.TagRecord) {
+	uc.removeLocked(hash)
+	uc.records[hash] = record
+	uc.sizes[record.Size]++
+	if record.Path != "" {
+		uc.paths[strings.ToLower(record.Path)] = hash
+	}
+	uc.dirty = true
+}
+
+// removeLocked は記録を削除する。uc.muを保持して呼び出す。
+func (uc *ModelTagUsecase) removeLocked(hash string) {
+	record, ok := uc.records[hash]
+	if !ok {
+		return
+	}
+	delete(uc.records, hash)
+	if uc.sizes[record.Size]--; uc.sizes[record.Size] <= 0 {
+		delete(uc.sizes, record.Size)
+	}
+	key := strings.ToLower(record.Path)
+	if uc.paths[key] == hash {
+		delete(uc.paths, key)
+	}
+	uc.dirty = true
+}
+
+// modelTagsOf は記録をタグとメモに変換する。
+func modelTagsOf(record moutput.TagRecord) ModelTags {
+	return ModelTags{Tags: append([]string{}, record.Tags...), Note: record.Note}
+}
@@ -0,0 +1,229 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+var (
+	// prefixedVersionPattern は末尾の v1.0・ver2・Ver.1.2a・version 3 などの版表記を表す。
+	prefixedVersionPattern = regexp.MustCompile(`(?i)(?:^|[\s_\-.(\[])(?:v|ver\.?|version)\s*[_\-]?\s*(\d+(?:[._]\d+)*)([a-z]?)[)\]]?$`)
+	// bareVersionPattern は末尾の区切り付きの 1.2・1.2.3 などの版表記を表す。
+	// 先頭が4桁以上の 2024.01.01 などは日付とみなして版に含めない。
+	bareVersionPattern = regexp.MustCompile(`(?i)[\s_\-(\[](\d{1,3}(?:\.\d+)+)([a-z]?)[)\]]?$`)
+	// familySeparatorPattern は系統名の比較で無視する区切り文字を表す。
+	familySeparatorPattern = regexp.MustCompile(`[\s_\-.・]+`)
+)
+
+// ModelVersion はファイル名などから読み取った版を表す。
+type ModelVersion struct {
+	Parts  []int
+	Suffix string
+	// Text は読み取った版表記そのもの。
+	Text string
+}
+
+// IsZero は版表記が無いか判定する。
+func (v ModelVersion) IsZero() bool {
+	return len(v.Parts) == 0
+}
+
+// Compare は版を比較し、vが古い場合は負、新しい場合は正、同じ場合は0を返す。版表記が無いものを最も古いとする。
+func (v ModelVersion) Compare(other ModelVersion) int {
+	if v.IsZero() || other.IsZero() {
+		switch {
+		case v.IsZero() && other.IsZero():
+			return 0
+		case v.IsZero():
+			return -1
+		default:
+			return 1
+		}
+	}
+	for i := 0; i < max(len(v.Parts), len(other.Parts)); i++ {
+		left, right := 0, 0
+		if i < len(v.Parts) {
+			left = v.Parts[i]
+		}
+		if i < len(other.Parts) {
+			right = other.Parts[i]
+		}
+		if left != right {
+			if left < right {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(v.Suffix, other.Suffix)
+}
+
+// ParseModelVersion は名前の末尾の版表記を読み取り、版表記を除いた名前と版を返す。全角の英数字も扱う。
+func ParseModelVersion(name string) (string, ModelVersion, bool) {
+	normalized := strings.TrimSpace(width.Fold.String(name))
+	for _, pattern := range []*regexp.Regexp{prefixedVersionPattern, bareVersionPattern} {
+		loc := pattern.FindStringSubmatchIndex(normalized)
+		if loc == nil {
+			continue
+		}
+		digits := normalized[loc[2]:loc[3]]
+		version := ModelVersion{
+			Suffix: strings.ToLower(normalized[loc[4]:loc[5]]),
+			Text:   strings.Trim(normalized[loc[0]:loc[1]], " _-.()[]"),
+		}
+		for _, part := range strings.FieldsFunc(digits, func(r rune) bool { return r == '.' || r == '_' }) {
+			number, err := strconv.Atoi(part)
+			if err != nil {
+				return normalized, ModelVersion{}, false
+			}
+			version.Parts = append(version.Parts, number)
+		}
+		return strings.TrimRight(normalized[:loc[0]], " _-."), version, true
+	}
+	return normalized, ModelVersion{}, false
+}
+
+// VersionCandidate は系統の判定対象となるモデルを表す。
+type VersionCandidate struct {
+	Path string
+	// ModelName はモデル名(日本語)。空の場合はファイル名・フォルダ名のみで判定する。
+	ModelName string
+	ModTime   time.Time
+}
+
+// VersionMember は系統に含まれるモデルと、その版を表す。
+type VersionMember struct {
+	Path    string
+	Version ModelVersion
+	ModTime time.Time
+}
+
+// VersionFamily は同じモデルの異なる版の集まりを表す。Membersは新しい順に並べる。
+type VersionFamily struct {
+	Name    string
+	Members []VersionMember
+}
+
+// Newest は最も新しい版を返す。
+func (f VersionFamily) Newest() VersionMember {
+	if len(f.Members) == 0 {
+		return VersionMember{}
+	}
+	return f.Members[0]
+}
+
+// GroupVersions はモデル名とファイル名・フォルダ名の版表記から版の系統を求める。
+// モデル名とファイル名(いずれも版表記を除く)が共に一致するものを同じ系統とする。版をフォルダ名から読み取った場合は
+// フォルダ名(版表記を除く)も一致するものとする。同じモデル名の別のモデルを1つの系統にまとめないため、モデル名のみでは判定しない。
+// 版はファイル名、フォルダ名、モデル名の順に探す。版表記のあるモデルを含み、2件以上ある系統のみ返す。
+// 同じ版は更新日時の新しい方を新しいとみなす。系統は名前順に並べる。
+func GroupVersions(candidates []VersionCandidate) []VersionFamily {
+	families := map[string]*VersionFamily{}
+	versioned := map[string]bool{}
+	for _, candidate := range candidates {
+		name, key, member := versionMemberOf(candidate)
+		if key == "" {
+			continue
+		}
+		family, ok := families[key]
+		if !ok {
+			family = &VersionFamily{Name: name}
+			families[key] = family
+		}
+		family.Members = append(family.Members, member)
+		versioned[key] = versioned[key] || !member.Version.IsZero()
+	}
+	result := make([]VersionFamily, 0, len(families))
+	for key, family := range families {
+		if len(family.Members) < 2 || !versioned[key] {
+			continue
+		}
+		sort.SliceStable(family.Members, func(i, j int) bool {
+			left, right := family.Members[i], family.Members[j]
+			if compared := left.Version.Compare(right.Version); compared != 0 {
+				return compared > 0
+			}
+			if !left.ModTime.Equal(right.ModTime) {
+				return left.ModTime.After(right.ModTime)
+			}
+			return strings.ToLower(left.Path) < strings.ToLower(right.Path)
+		})
+		result = append(result, *family)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+	return result
+}
+
+// versionMemberOf はモデルの系統名と系統の判定に使うキー、版を求める。
+// 系統名はモデル名、モデル名が無い場合はファイル名とし、ファイル名と異なるモデル名には両方を併記する。
+func versionMemberOf(candidate VersionCandidate) (string, string, VersionMember) {
+	member := VersionMember{Path: candidate.Path, ModTime: candidate.ModTime}
+	fileName := strings.TrimSuffix(filepath.Base(candidate.Path), filepath.Ext(candidate.Path))
+	fileBase, fileVersion, fileOK := ParseModelVersion(fileName)
+	folderBase, folderVersion, folderOK := ParseModelVersion(filepath.Base(filepath.Dir(candidate.Path)))
+	modelBase, modelVersion, modelOK := ParseModelVersion(candidate.ModelName)
+	fileKey := familyKey(fileBase)
+	if fileKey == "" {
+		return "", "", member
+	}
+	keys := []string{familyKey(modelBase), fileKey}
+	switch {
+	case fileOK:
+		member.Version = fileVersion
+	case folderOK:
+		member.Version = folderVersion
+		// 同名のファイルを版ごとのフォルダに置く配布形態では、フォルダ名も系統の判定に使う。
+		keys = append(keys, familyKey(folderBase))
+	case modelOK:
+		member.Version = modelVersion
+	}
+	name := fileBase
+	if modelBase != "" {
+		name = modelBase
+		if keys[0] != fileKey {
+			name = modelBase + " / " + fileBase
+		}
+	}
+	return name, strings.Join(keys, "\x00"), member
+}
+
+// familyKey は大文字小文字と区切り文字の違いを無視した系統名を返す。
+func familyKey(name string) string {
+	return strings.TrimSpace(familySeparatorPattern.ReplaceAllString(strings.ToLower(name), " "))
+}
+
+// VersionReference は古い版が参照されている系統を表す。
+type VersionReference struct {
+	Family VersionFamily
+	// Stale は参照されている古い版。
+	Stale []VersionMember
+}
+
+// StaleReferences は最新版以外が参照されている系統を返す。referencedはパスが参照されているか判定する。
+func StaleReferences(families []VersionFamily, referenced func(path string) bool) []VersionReference {
+	if referenced == nil {
+		return nil
+	}
+	var references []VersionReference
+	for _, family := range families {
+		var stale []VersionMember
+		for _, member := range family.Members[1:] {
+			if referenced(member.Path) {
+				stale = append(stale, member)
+			}
+		}
+		if len(stale) > 0 {
+			references = append(references, VersionReference{Family: family, Stale: stale})
+		}
+	}
+	return references
+}
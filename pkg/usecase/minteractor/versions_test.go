@@ -0,0 +1,145 @@
+// 指示: miu200521358
+package minteractor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseModelVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantBase string
+		wantOK   bool
+		parts    []int
+		suffix   string
+		text     string
+	}{
+		{name: "miku_v1.0", wantBase: "miku", wantOK: true, parts: []int{1, 0}, text: "v1.0"},
+		{name: "miku ver2", wantBase: "miku", wantOK: true, parts: []int{2}, text: "ver2"},
+		{name: "miku Ver.1.2a", wantBase: "miku", wantOK: true, parts: []int{1, 2}, suffix: "a", text: "Ver.1.2a"},
+		{name: "miku version 3", wantBase: "miku", wantOK: true, parts: []int{3}, text: "version 3"},
+		{name: "miku(v1_2)", wantBase: "miku", wantOK: true, parts: []int{1, 2}, text: "v1_2"},
+		{name: "miku-1.2.3", wantBase: "miku", wantOK: true, parts: []int{1, 2, 3}, text: "1.2.3"},
+		{name: "miku [1.10]", wantBase: "miku", wantOK: true, parts: []int{1, 10}, text: "1.10"},
+		{name: "ミク_Ｖ２．０", wantBase: "ミク", wantOK: true, parts: []int{2, 0}, text: "V2.0"},
+		{name: "miku v2024.01.01", wantBase: "miku", wantOK: true, parts: []int{2024, 1, 1}, text: "v2024.01.01"},
+		{name: "miku 2024.01.01", wantBase: "miku 2024.01.01", wantOK: false},
+		{name: "miku_2024.1", wantBase: "miku_2024.1", wantOK: false},
+		{name: "miku2", wantBase: "miku2", wantOK: false},
+		{name: "miku 1", wantBase: "miku 1", wantOK: false},
+		{name: "level5", wantBase: "level5", wantOK: false},
+		{name: "dev1.0", wantBase: "dev1.0", wantOK: false},
+		{name: "", wantBase: "", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, version, ok := ParseModelVersion(tt.name)
+			if base != tt.wantBase || ok != tt.wantOK {
+				t.Fatalf("ParseModelVersion(%q) = %q, %v, want %q, %v", tt.name, base, ok, tt.wantBase, tt.wantOK)
+			}
+			if !reflect.DeepEqual(version.Parts, tt.parts) || version.Suffix != tt.suffix || version.Text != tt.text {
+				t.Errorf("ParseModelVersion(%q) version = %+v, want parts=%v suffix=%q text=%q", tt.name, version, tt.parts, tt.suffix, tt.text)
+			}
+		})
+	}
+}
+
+func TestModelVersionCompare(t *testing.T) {
+	version := func(suffix string, parts ...int) ModelVersion {
+		return ModelVersion{Parts: parts, Suffix: suffix}
+	}
+	tests := []struct {
+		name  string
+		left  ModelVersion
+		right ModelVersion
+		want  int
+	}{
+		{name: "同じ版", left: version("", 1, 2), right: version("", 1, 2), want: 0},
+		{name: "末尾の0は省略と同じ", left: version("", 1), right: version("", 1, 0), want: 0},
+		{name: "数値として比較", left: version("", 1, 10), right: version("", 1, 9), want: 1},
+		{name: "上位の桁を優先", left: version("", 1, 9, 9), right: version("", 2), want: -1},
+		{name: "桁数の多い方が新しい", left: version("", 1, 2, 1), right: version("", 1, 2), want: 1},
+		{name: "接尾辞", left: version("b", 1, 2), right: version("a", 1, 2), want: 1},
+		{name: "接尾辞無しが先", left: version("", 1, 2), right: version("a", 1, 2), want: -1},
+		{name: "版表記無しは最も古い", left: ModelVersion{}, right: version("", 0, 1), want: -1},
+		{name: "版表記無し同士", left: ModelVersion{}, right: ModelVersion{}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.left.Compare(tt.right); got != tt.want {
+				t.Errorf("Compare() = %d, want %d", got, tt.want)
+			}
+			if got := tt.right.Compare(tt.left); got != -tt.want {
+				t.Errorf("reverse Compare() = %d, want %d", got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupVersions(t *testing.T) {
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		candidates []VersionCandidate
+		want       map[string][]string
+	}{
+		{
+			name: "ファイル名の版",
+			candidates: []VersionCandidate{
+				{Path: `C:/m/miku_v1.0.pmx`, ModelName: "初音ミク"},
+				{Path: `C:/m/miku_v2.0.pmx`, ModelName: "初音ミク"},
+			},
+			want: map[string][]string{"初音ミク / miku": {`C:/m/miku_v2.0.pmx`, `C:/m/miku_v1.0.pmx`}},
+		},
+		{
+			name: "同じモデル名の別モデルはまとめない",
+			candidates: []VersionCandidate{
+				{Path: `C:/a/miku_v1.pmx`, ModelName: "初音ミク"},
+				{Path: `C:/a/miku_v2.pmx`, ModelName: "初音ミク"},
+				{Path: `C:/b/appearance_miku_v3.pmx`, ModelName: "初音ミク"},
+				{Path: `C:/c/tda_miku.pmx`, ModelName: "初音ミク"},
+			},
+			want: map[string][]string{"初音ミク / miku": {`C:/a/miku_v2.pmx`, `C:/a/miku_v1.pmx`}},
+		},
+		{
+			name: "フォルダ名の版",
+			candidates: []VersionCandidate{
+				{Path: `C:/m/Miku_v1/model.pmx`, ModTime: now},
+				{Path: `C:/m/Miku_v2/model.pmx`, ModTime: now},
+				{Path: `C:/m/Rin_v3/model.pmx`, ModTime: now},
+			},
+			want: map[string][]string{"model": {`C:/m/Miku_v2/model.pmx`, `C:/m/Miku_v1/model.pmx`}},
+		},
+		{
+			name: "日付は版としない",
+			candidates: []VersionCandidate{
+				{Path: `C:/m/stage 2023.12.01.pmx`},
+				{Path: `C:/m/stage 2024.01.01.pmx`},
+			},
+			want: map[string][]string{},
+		},
+		{
+			name: "同じ版は更新日時の新しい方を先にする",
+			candidates: []VersionCandidate{
+				{Path: `C:/a/rin v1.pmx`, ModTime: now},
+				{Path: `C:/b/rin v1.pmx`, ModTime: now.Add(time.Hour)},
+			},
+			want: map[string][]string{"rin": {`C:/b/rin v1.pmx`, `C:/a/rin v1.pmx`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string][]string{}
+			for _, family := range GroupVersions(tt.candidates) {
+				for _, member := range family.Members {
+					got[family.Name] = append(got[family.Name], member.Path)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GroupVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
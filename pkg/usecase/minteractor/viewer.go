@@ -1,24 +1,52 @@
 // 指示: miu200521358
 package minteractor
 
-import "github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/miu200521358/mlib_go/pkg/shared/base/logging"
+
+	"github.com/miu200521358/mu_tree_viewer/pkg/usecase/port/moutput"
+)
 
 // TreeViewerUsecaseDeps はツリービューア用ユースケースの依存を表す。
 type TreeViewerUsecaseDeps struct {
-	ModelReader  moutput.IFileReader
-	MotionReader moutput.IFileReader
+	ModelReader     moutput.IFileReader
+	MotionReader    moutput.IFileReader
+	ArchiveResolver moutput.IArchiveResolver
+	// Files はヘッダとファイル情報の読み込みに使う。未設定の場合はアーカイブ内のモデルを扱わない。
+	Files moutput.IFileOpener
+	// Hasher はモデルキャッシュの有効性をファイルサイズと更新日時で確かめるために使う。未設定の場合はキャッシュしない。
+	Hasher moutput.IContentHasher
+	// Logger はモデルキャッシュの命中・読み込みをデバッグログへ出力するために使う。
+	Logger logging.ILogger
 }
 
 // TreeViewerUsecase はツリービューアの入出力処理をまとめたユースケースを表す。
 type TreeViewerUsecase struct {
-	modelReader  moutput.IFileReader
-	motionReader moutput.IFileReader
+	modelReader     moutput.IFileReader
+	motionReader    moutput.IFileReader
+	archiveResolver moutput.IArchiveResolver
+	files           moutput.IFileOpener
+	hasher          moutput.IContentHasher
+	logger          logging.ILogger
+	modelCache      *modelCache
+	loadingMu       sync.Mutex
+	loading         map[string]*modelLoad
+	prefetchSeq     atomic.Uint64
 }
 
 // NewTreeViewerUsecase はツリービューア用ユースケースを生成する。
 func NewTreeViewerUsecase(deps TreeViewerUsecaseDeps) *TreeViewerUsecase {
 	return &TreeViewerUsecase{
-		modelReader:  deps.ModelReader,
-		motionReader: deps.MotionReader,
+		modelReader:     deps.ModelReader,
+		motionReader:    deps.MotionReader,
+		archiveResolver: deps.ArchiveResolver,
+		files:           deps.Files,
+		hasher:          deps.Hasher,
+		logger:          deps.Logger,
+		modelCache:      newModelCache(modelCacheMaxEntries, modelCacheMaxBytes),
+		loading:         map[string]*modelLoad{},
 	}
 }
@@ -1,7 +1,12 @@
 // 指示: miu200521358
 package moutput
 
-import "github.com/miu200521358/mlib_go/pkg/usecase/port/io"
+import (
+	"context"
+	stdio "io"
+
+	"github.com/miu200521358/mlib_go/pkg/usecase/port/io"
+)
 
 // IFileReader は入出力共通の読み込み契約を表す。
 type IFileReader = io.IFileReader
@@ -17,3 +22,45 @@ type ITextureValidator = io.ITextureValidator
 
 // SaveOptions は保存時のオプションを表す。
 type SaveOptions = io.SaveOptions
+
+// IArchiveResolver はアーカイブ内の仮想パスを読み込み可能なローカルパスへ変換する契約を表す。
+type IArchiveResolver interface {
+	// Resolve は仮想パスを展開済みのパスに変換する。アーカイブ内でない場合はokにfalseを返す。
+	Resolve(path string) (localPath string, ok bool, err error)
+}
+
+// TagRecord はモデルの内容ハッシュに紐付けて保存するタグとメモを表す。
+type TagRecord struct {
+	Tags []string
+	Note string
+	// Path は最後に確認したファイルのパス。移動後は内容ハッシュで見つけ直して更新する。
+	Path string
+	// Size は最後に確認したファイルサイズ。
+	Size int64
+	// ModTime は最後に確認したファイルの更新日時(UnixNano)。
+	ModTime int64
+}
+
+// ITagStore はタグとメモを内容ハッシュ単位で永続化する契約を表す。
+type ITagStore interface {
+	// Load は保存済みの記録を内容ハッシュをキーとして返す。
+	Load() (map[string]TagRecord, error)
+	// Save は記録全体を保存する。
+	Save(records map[string]TagRecord) error
+}
+
+// IContentHasher はファイル内容のハッシュを求める契約を表す。アーカイブ内の仮想パスも扱う。
+type IContentHasher interface {
+	// Stat はファイルサイズと更新日時(UnixNano)を返す。
+	Stat(path string) (size int64, modTime int64, err error)
+	// Hash はファイル内容全体のハッシュを返す。ctxが取り消された場合は読み込みを中断してエラーを返す。
+	Hash(ctx context.Context, path string) (string, error)
+}
+
+// IFileOpener はファイルを読み込み用に開く契約を表す。アーカイブ内の仮想パスも扱う。
+type IFileOpener interface {
+	// Stat はファイルサイズと更新日時(UnixNano)を返す。
+	Stat(path string) (size int64, modTime int64, err error)
+	// Open はファイルを開き、サイズと更新日時(UnixNano)を返す。
+	Open(path string) (reader stdio.ReadCloser, size int64, modTime int64, err error)
+}